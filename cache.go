@@ -0,0 +1,172 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache stores encoded responses for a CachingClient. Keys are hex encoded hashes, safe to use as file
+// names. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, and false if there is none or it has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key. A ttl of zero means the value does not expire.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// expiry returns the time a value stored now with ttl expires, or the zero time.
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires)
+}
+
+// LRUCache is an in-memory Cache that evicts the least recently used value once it holds capacity values.
+type LRUCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache returns an LRUCache holding up to capacity values. A capacity of zero or less means no limit.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := e.Value.(*lruItem)
+	if expired(item.expires) {
+		c.order.Remove(e)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(e)
+	return item.value, true, nil
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		item := e.Value.(*lruItem)
+		item.value, item.expires = value, expiry(ttl)
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&lruItem{key: key, value: value, expires: expiry(ttl)})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).key)
+	}
+	return nil
+}
+
+// Len returns the number of values in the cache, including expired ones not yet evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// DiskCache is a Cache that stores every value in its own file in a directory, so cached responses
+// survive restarts and can be shared between processes.
+type DiskCache struct {
+	dir string
+}
+
+type diskEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+var _ Cache = (*DiskCache)(nil)
+
+// NewDiskCache returns a DiskCache storing values in dir, which is created if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get implements Cache. Expired values are removed.
+func (c *DiskCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	path := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("invalid cache entry %s: %w", key, err)
+	}
+	if expired(entry.Expires) {
+		_ = os.Remove(path)
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Set implements Cache. The value is written to a temporary file first, so readers never see a partial
+// entry.
+func (c *DiskCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(diskEntry{Expires: expiry(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose calls skip the cache lookup of a CachingClient. The fresh
+// response still replaces the cached one.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+type cacheSampledKey struct{}
+
+// WithCacheSampled returns a context whose chat completions, completions and edits are cached by a
+// CachingClient whatever their temperature, like WithCacheAnyTemperature does for all calls.
+func WithCacheSampled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheSampledKey{}, true)
+}
+
+func cacheSampled(ctx context.Context) bool {
+	sampled, _ := ctx.Value(cacheSampledKey{}).(bool)
+	return sampled
+}
+
+// CachingOption are options that can be passed when creating a new caching client
+type CachingOption func(*CachingClient) *CachingClient
+
+// WithCacheTTL is a caching option that expires cached responses after ttl. The default is to keep them
+// until the Cache evicts them.
+func WithCacheTTL(ttl time.Duration) CachingOption {
+	return func(c *CachingClient) *CachingClient {
+		c.ttl = ttl
+		return c
+	}
+}
+
+// WithCacheAnyTemperature is a caching option that caches chat completions, completions and edits
+// whatever their temperature. They are sampled, so a cached response is one of many possible answers.
+func WithCacheAnyTemperature() CachingOption {
+	return func(c *CachingClient) *CachingClient {
+		c.anyTemperature = true
+		return c
+	}
+}
+
+// CachingClient is a Client that wraps another Client and serves repeated ChatCompletion, Completion,
+// Embeddings and Edits calls from a Cache. Calls are keyed by a hash of the method and the request,
+// ignoring Stream, so a cached chat completion or completion is also replayed to streaming callbacks
+// as synthesized chunks. A Temperature of 0 is not sent and the API samples at its default of 1, so chat
+// completions and completions are only cached with WithCacheAnyTemperature or a context from
+// WithCacheSampled. Edits are also cached when they set a temperature of zero, and embeddings always
+// are. Cache errors never fail a call; the call is sent to the wrapped client instead.
+type CachingClient struct {
+	client         Client
+	cache          Cache
+	ttl            time.Duration
+	anyTemperature bool
+}
+
+var _ Client = (*CachingClient)(nil)
+
+// NewCachingClient returns a CachingClient around client that stores responses in cache.
+func NewCachingClient(client Client, cache Cache, options ...CachingOption) *CachingClient {
+	c := &CachingClient{client: client, cache: cache}
+	for _, opt := range options {
+		c = opt(c)
+	}
+	return c
+}
+
+// cacheKey returns the hex encoded SHA-256 hash of method and the JSON encoding of request. The JSON
+// encoding of a struct is canonical: fields are in declaration order and map keys are sorted.
+func cacheKey(method string, request interface{}) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookup decodes the response cached under key into output.
+func (c *CachingClient) lookup(ctx context.Context, key string, output interface{}) bool {
+	if key == "" || cacheBypassed(ctx) {
+		return false
+	}
+	data, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return false
+	}
+	return json.Unmarshal(data, output) == nil
+}
+
+// store caches output under key.
+func (c *CachingClient) store(ctx context.Context, key string, output interface{}) {
+	if key == "" {
+		return
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		return
+	}
+	_ = c.cache.Set(ctx, key, data, c.ttl)
+}
+
+// cached serves a call from the cache under key, or calls fn and caches its response. An empty key
+// disables caching.
+func cached[Rsp any](ctx context.Context, c *CachingClient, key string, fn func() (*Rsp, error)) (*Rsp, error) {
+	output := new(Rsp)
+	if c.lookup(ctx, key, output) {
+		return output, nil
+	}
+	output, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, key, output)
+	return output, nil
+}
+
+// sampled reports whether sampled calls made with ctx may be cached.
+func (c *CachingClient) sampled(ctx context.Context) bool {
+	return c.anyTemperature || cacheSampled(ctx)
+}
+
+// chatCacheKey returns the cache key of a chat request, or "" if it must not be cached.
+func (c *CachingClient) chatCacheKey(ctx context.Context, request *ChatCompletionRequest) string {
+	if !c.sampled(ctx) {
+		return ""
+	}
+	req := *request
+	req.Model, req.Stream, req.StreamOptions = chatModel(request), false, nil
+	key, _ := cacheKey("ChatCompletion", &req)
+	return key
+}
+
+// completionCacheKey returns the cache key of a completion request, or "" if it must not be cached.
+// Completion and CompletionWithEngine call the same endpoint, so they share their entries.
+func (c *CachingClient) completionCacheKey(ctx context.Context, request *CompletionRequest) string {
+	if !c.sampled(ctx) {
+		return ""
+	}
+	req := *request
+	req.Stream, req.StreamOptions = false, nil
+	key, _ := cacheKey("Completion", &req)
+	return key
+}
+
+// Engines lists the engines. The call is not cached.
+func (c *CachingClient) Engines(ctx context.Context) (*EnginesResponse, error) {
+	return c.client.Engines(ctx)
+}
+
+// Engine retrieves an engine. The call is not cached.
+func (c *CachingClient) Engine(ctx context.Context, engine string) (*EngineObject, error) {
+	return c.client.Engine(ctx, engine)
+}
+
+// ChatCompletion creates a chat completion, or returns the cached one.
+func (c *CachingClient) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return cached(ctx, c, c.chatCacheKey(ctx, request), func() (*ChatCompletionResponse, error) {
+		return c.client.ChatCompletion(ctx, request)
+	})
+}
+
+// ChatCompletionStream streams a chat completion. A cached completion is replayed as one chunk per
+// choice followed by a final chunk with the finish reasons and usage; a streamed completion is cached
+// once the stream ends without error.
+func (c *CachingClient) ChatCompletionStream(ctx context.Context, request *ChatCompletionRequest, onData func(*ChatCompletionStreamResponse)) error {
+	key := c.chatCacheKey(ctx, request)
+	output := new(ChatCompletionResponse)
+	if c.lookup(ctx, key, output) {
+		replayChatCompletion(output, onData)
+		return nil
+	}
+	acc := &ChatCompletionResponse{Object: "chat.completion"}
+	err := c.client.ChatCompletionStream(ctx, request, func(rsp *ChatCompletionStreamResponse) {
+		accumulateChatCompletion(acc, rsp)
+		onData(rsp)
+	})
+	if err != nil {
+		return err
+	}
+	c.store(ctx, key, acc)
+	return nil
+}
+
+// Completion creates a completion, or returns the cached one.
+func (c *CachingClient) Completion(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return c.completion(ctx, request, c.client.Completion)
+}
+
+// CompletionStream streams a completion, replaying a cached one as synthesized chunks.
+func (c *CachingClient) CompletionStream(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return c.completionStream(ctx, request, onData, c.client.CompletionStream)
+}
+
+// CompletionWithEngine creates a completion with the default engine, or returns the cached one.
+func (c *CachingClient) CompletionWithEngine(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return c.completion(ctx, request, c.client.CompletionWithEngine)
+}
+
+// CompletionStreamWithEngine streams a completion with the default engine, replaying a cached one as
+// synthesized chunks.
+func (c *CachingClient) CompletionStreamWithEngine(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return c.completionStream(ctx, request, onData, c.client.CompletionStreamWithEngine)
+}
+
+func (c *CachingClient) completion(ctx context.Context, request *CompletionRequest,
+	fn func(context.Context, *CompletionRequest) (*CompletionResponse, error)) (*CompletionResponse, error) {
+	return cached(ctx, c, c.completionCacheKey(ctx, request), func() (*CompletionResponse, error) {
+		return fn(ctx, request)
+	})
+}
+
+func (c *CachingClient) completionStream(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse),
+	fn func(context.Context, *CompletionRequest, func(*CompletionResponse)) error) error {
+	key := c.completionCacheKey(ctx, request)
+	output := new(CompletionResponse)
+	if c.lookup(ctx, key, output) {
+		replayCompletion(output, onData)
+		return nil
+	}
+	acc := &CompletionResponse{Object: "text_completion"}
+	err := fn(ctx, request, func(rsp *CompletionResponse) {
+		accumulateCompletion(acc, rsp)
+		onData(rsp)
+	})
+	if err != nil {
+		return err
+	}
+	c.store(ctx, key, acc)
+	return nil
+}
+
+// Edits creates an edit, or returns the cached one. Edits are cached when they set a temperature of zero,
+// or like chat completions when sampled calls are cached.
+func (c *CachingClient) Edits(ctx context.Context, request *EditsRequest) (*EditsResponse, error) {
+	key := ""
+	if request.Temperature != nil && *request.Temperature == 0 || c.sampled(ctx) {
+		key, _ = cacheKey("Edits", request)
+	}
+	return cached(ctx, c, key, func() (*EditsResponse, error) {
+		return c.client.Edits(ctx, request)
+	})
+}
+
+// Search performs a search with the default engine. The call is not cached.
+func (c *CachingClient) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
+	return c.client.Search(ctx, request)
+}
+
+// SearchWithEngine performs a search with the specified engine. The call is not cached.
+func (c *CachingClient) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
+	return c.client.SearchWithEngine(ctx, engine, request)
+}
+
+// Embeddings creates embeddings, or returns the cached ones.
+func (c *CachingClient) Embeddings(ctx context.Context, request *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	key, _ := cacheKey("Embeddings", request)
+	return cached(ctx, c, key, func() (*EmbeddingsResponse, error) {
+		return c.client.Embeddings(ctx, request)
+	})
+}
+
+// Image creates images. The call is not cached.
+func (c *CachingClient) Image(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	return c.client.Image(ctx, request)
+}
+
+// Moderation classifies texts. The call is not cached.
+func (c *CachingClient) Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error) {
+	return c.client.Moderation(ctx, request)
+}
+
+// Transcription transcribes audio. The call is not cached.
+func (c *CachingClient) Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error) {
+	return c.client.Transcription(ctx, request)
+}
+
+// replayChatCompletion sends a chat completion to a streaming callback as synthesized chunks.
+func replayChatCompletion(rsp *ChatCompletionResponse, onData func(*ChatCompletionStreamResponse)) {
+	chunk := func(choices []ChatCompletionStreamResponseChoice) *ChatCompletionStreamResponse {
+		return &ChatCompletionStreamResponse{
+			ID:      rsp.ID,
+			Object:  "chat.completion.chunk",
+			Created: rsp.Created,
+			Model:   rsp.Model,
+			Choices: choices,
+		}
+	}
+	var final []ChatCompletionStreamResponseChoice
+	for _, choice := range rsp.Choices {
+		onData(chunk([]ChatCompletionStreamResponseChoice{{Index: choice.Index, Delta: choice.Message}}))
+		final = append(final, ChatCompletionStreamResponseChoice{Index: choice.Index, FinishReason: choice.FinishReason})
+	}
+	last := chunk(final)
+	last.Usage = rsp.Usage
+	onData(last)
+}
+
+// accumulateChatCompletion adds a streamed chunk to a chat completion.
+func accumulateChatCompletion(acc *ChatCompletionResponse, rsp *ChatCompletionStreamResponse) {
+	acc.ID, acc.Created, acc.Model = rsp.ID, rsp.Created, rsp.Model
+	if rsp.Usage.TotalTokens > 0 {
+		acc.Usage = rsp.Usage
+	}
+	for _, delta := range rsp.Choices {
+		for len(acc.Choices) <= delta.Index {
+			acc.Choices = append(acc.Choices, ChatCompletionResponseChoice{Index: len(acc.Choices)})
+		}
+		choice := &acc.Choices[delta.Index]
+		if delta.Delta.Role != "" {
+			choice.Message.Role = delta.Delta.Role
+		}
+		choice.Message.Content += delta.Delta.Content
+		if delta.FinishReason != "" {
+			choice.FinishReason = delta.FinishReason
+		}
+	}
+}
+
+// replayCompletion sends a completion to a streaming callback as one chunk per choice.
+func replayCompletion(rsp *CompletionResponse, onData func(*CompletionResponse)) {
+	for i, choice := range rsp.Choices {
+		chunk := &CompletionResponse{
+			ID:      rsp.ID,
+			Object:  rsp.Object,
+			Created: rsp.Created,
+			Model:   rsp.Model,
+			Choices: []CompletionResponseChoice{choice},
+		}
+		if i == len(rsp.Choices)-1 {
+			chunk.Usage = rsp.Usage
+		}
+		onData(chunk)
+	}
+}
+
+// accumulateCompletion adds a streamed chunk to a completion.
+func accumulateCompletion(acc *CompletionResponse, rsp *CompletionResponse) {
+	acc.ID, acc.Created, acc.Model = rsp.ID, rsp.Created, rsp.Model
+	if rsp.Usage.TotalTokens > 0 {
+		acc.Usage = rsp.Usage
+	}
+	for _, delta := range rsp.Choices {
+		for len(acc.Choices) <= delta.Index {
+			acc.Choices = append(acc.Choices, CompletionResponseChoice{Index: len(acc.Choices)})
+		}
+		choice := &acc.Choices[delta.Index]
+		choice.Text += delta.Text
+		if delta.FinishReason != "" {
+			choice.FinishReason = delta.FinishReason
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package gpt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func temperature(t float32) *float32 {
+	return &t
+}
+
+func TestCachingClientOptIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float32
+		options     []gpt.CachingOption
+		sampled     bool
+		calls       int
+	}{
+		{"not opted in", 0, nil, false, 2},
+		{"temperature above zero", 0.7, nil, false, 2},
+		{"any temperature", 0, []gpt.CachingOption{gpt.WithCacheAnyTemperature()}, false, 1},
+		{"temperature above zero with any temperature", 0.7, []gpt.CachingOption{gpt.WithCacheAnyTemperature()}, false, 1},
+		{"sampled context", 0.7, nil, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			client := gpt.NewCachingClient(server.Client(), gpt.NewLRUCache(16), tt.options...)
+			ctx := context.Background()
+			if tt.sampled {
+				ctx = gpt.WithCacheSampled(ctx)
+			}
+			request := &gpt.ChatCompletionRequest{
+				Model:       gpt.GPT4oMini,
+				Messages:    []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+				Temperature: tt.temperature,
+			}
+			completion := &gpt.CompletionRequest{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"hi"}, Temperature: tt.temperature}
+			for i := 0; i < 2; i++ {
+				if _, err := client.ChatCompletion(ctx, request); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := client.Completion(ctx, completion); err != nil {
+					t.Fatal(err)
+				}
+			}
+			server.AssertCalled(t, gpttest.EndpointChatCompletions, tt.calls)
+			server.AssertCalled(t, gpttest.EndpointCompletions, tt.calls)
+		})
+	}
+}
+
+func TestCachingClientEdits(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature *float32
+		options     []gpt.CachingOption
+		calls       int
+	}{
+		{"temperature zero", temperature(0), nil, 1},
+		{"default temperature", nil, nil, 2},
+		{"temperature above zero", temperature(0.7), nil, 2},
+		{"default temperature with any temperature", nil, []gpt.CachingOption{gpt.WithCacheAnyTemperature()}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			client := gpt.NewCachingClient(server.Client(), gpt.NewLRUCache(16), tt.options...)
+			edits := &gpt.EditsRequest{Model: "text-davinci-edit-001", Input: "a", Instruction: "b", Temperature: tt.temperature}
+			for i := 0; i < 2; i++ {
+				if _, err := client.Edits(context.Background(), edits); err != nil {
+					t.Fatal(err)
+				}
+			}
+			server.AssertCalled(t, gpttest.EndpointEdits, tt.calls)
+		})
+	}
+}
+
+func TestCachingClientCompletionsShareEntries(t *testing.T) {
+	server := gpttest.New(t)
+	client := gpt.NewCachingClient(server.Client(), gpt.NewLRUCache(16), gpt.WithCacheAnyTemperature())
+	request := &gpt.CompletionRequest{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"hi"}}
+	if _, err := client.Completion(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CompletionWithEngine(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	err := client.CompletionStreamWithEngine(context.Background(), request, func(*gpt.CompletionResponse) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AssertCalled(t, gpttest.EndpointCompletions, 1)
+}
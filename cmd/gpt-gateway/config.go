@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Defaults of the configuration file.
+const (
+	defaultListen    = ":8080"
+	defaultBaseURL   = "https://api.openai.com/v1"
+	defaultAPIKeyEnv = "OPENAI_API_KEY"
+	defaultTimeout   = 10 * time.Minute
+)
+
+// config is the configuration file of the gateway.
+type config struct {
+	// Listen is the address the gateway listens on
+	Listen   string   `json:"listen,omitempty"`
+	Upstream upstream `json:"upstream"`
+	// UsageLog is the JSONL file usage is appended to, "-" for standard output. The usage of the
+	// current day is read back on start, so quotas survive a restart.
+	UsageLog string `json:"usage_log,omitempty"`
+	// Callers are the services allowed to use the gateway, by name
+	Callers map[string]*caller `json:"callers"`
+}
+
+// upstream is the API the gateway forwards to.
+type upstream struct {
+	BaseURL string `json:"base_url,omitempty"`
+	OrgID   string `json:"org_id,omitempty"`
+	// APIKeyEnv is the environment variable holding the real API key
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// Timeout of a request including its streamed response, e.g. "10m"
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+// caller is a service using the gateway with an internal key.
+type caller struct {
+	// Key is the internal key of the caller, or KeySHA256 its SHA-256 in hex to keep it out of the file
+	Key       string `json:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty"`
+	// Models are the models the caller may use, a trailing * matching any suffix. Empty allows all.
+	Models []string `json:"models,omitempty"`
+	// RequestsPerMinute, TokensPerDay and BudgetPerDay in US dollars limit the caller; zero is no limit.
+	// Days are UTC days.
+	RequestsPerMinute int     `json:"requests_per_minute,omitempty"`
+	TokensPerDay      int64   `json:"tokens_per_day,omitempty"`
+	BudgetPerDay      float64 `json:"budget_per_day,omitempty"`
+
+	name string
+}
+
+// allows reports whether the caller may use model.
+func (c *caller) allows(model string) bool {
+	if len(c.Models) == 0 {
+		return true
+	}
+	for _, pattern := range c.Models {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern && strings.HasPrefix(model, prefix) || pattern == model {
+			return true
+		}
+	}
+	return false
+}
+
+// hashKey returns the SHA-256 of a key in hex, as used by key_sha256.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadConfig reads and checks the configuration file, filling in the defaults.
+func loadConfig(path string) (*config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	defer file.Close()
+	cfg := &config{}
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = defaultListen
+	}
+	if cfg.Upstream.BaseURL == "" {
+		cfg.Upstream.BaseURL = defaultBaseURL
+	}
+	if cfg.Upstream.APIKeyEnv == "" {
+		cfg.Upstream.APIKeyEnv = defaultAPIKeyEnv
+	}
+	cfg.Upstream.timeout = defaultTimeout
+	if cfg.Upstream.Timeout != "" {
+		if cfg.Upstream.timeout, err = time.ParseDuration(cfg.Upstream.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid upstream timeout: %w", err)
+		}
+	}
+	if len(cfg.Callers) == 0 {
+		return nil, fmt.Errorf("no callers configured in %s", path)
+	}
+	keys := make(map[string]string, len(cfg.Callers))
+	for name, c := range cfg.Callers {
+		if c == nil {
+			return nil, fmt.Errorf("caller %s: missing settings", name)
+		}
+		c.name = name
+		switch {
+		case c.Key != "" && c.KeySHA256 != "":
+			return nil, fmt.Errorf("caller %s: set key or key_sha256, not both", name)
+		case c.Key != "":
+			c.KeySHA256 = hashKey(c.Key)
+		case c.KeySHA256 == "":
+			return nil, fmt.Errorf("caller %s: missing key or key_sha256", name)
+		}
+		c.KeySHA256 = strings.ToLower(c.KeySHA256)
+		if digest, err := hex.DecodeString(c.KeySHA256); err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("caller %s: key_sha256 must be 64 hex digits", name)
+		}
+		if other, ok := keys[c.KeySHA256]; ok {
+			return nil, fmt.Errorf("callers %s and %s have the same key", other, name)
+		}
+		keys[c.KeySHA256] = name
+	}
+	return cfg, nil
+}
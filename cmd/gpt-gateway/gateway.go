@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+// maxBodyBytes limits the size of a request body.
+const maxBodyBytes = 8 << 20
+
+// imageModel is the model of image requests that don't name one.
+const imageModel = "dall-e-2"
+
+// defaultCompletionTokens is the max_tokens of the completions API.
+const defaultCompletionTokens = 16
+
+// gateway serves the OpenAI API to callers with internal keys, forwarding their requests upstream
+// with the real key.
+type gateway struct {
+	upstream *proxy
+	callers  map[string]*caller // by key_sha256
+	quotas   map[string]*quota  // by caller name
+	pricing  *gpt.Pricing
+	log      *usageLog
+	now      func() time.Time
+}
+
+// newGateway returns a gateway forwarding to upstream, writing usage to log. Usage of earlier entries
+// is counted against the daily quotas.
+func newGateway(cfg *config, upstream *proxy, log *usageLog, entries []usageEntry) *gateway {
+	g := &gateway{
+		upstream: upstream,
+		callers:  make(map[string]*caller, len(cfg.Callers)),
+		quotas:   make(map[string]*quota, len(cfg.Callers)),
+		pricing:  gpt.DefaultPricing(),
+		log:      log,
+		now:      time.Now,
+	}
+	for name, c := range cfg.Callers {
+		g.callers[c.KeySHA256] = c
+		g.quotas[name] = &quota{}
+	}
+	for _, e := range entries {
+		if q := g.quotas[e.Caller]; q != nil {
+			q.add(e.Time, int64(e.PromptTokens+e.CompletionTokens), e.Cost)
+		}
+	}
+	return g
+}
+
+// call is a request of a caller forwarded upstream.
+type call struct {
+	caller *caller
+	// method names the call in the usage log
+	method string
+	model  string
+	// promptTokens is the estimate counted when a response reports no usage
+	promptTokens int
+	// size is the size of the images of an image request
+	size string
+}
+
+// record counts the usage a response reported against the quota of its caller and logs it.
+func (g *gateway) record(c *call, r *reported) {
+	now := g.now()
+	e := usageEntry{Time: now.UTC(), Caller: c.caller.name, Method: c.method, Model: r.Model}
+	if e.Model == "" {
+		e.Model = c.model
+	}
+	switch {
+	case c.size != "":
+		e.Images = len(r.Data)
+		e.Cost = g.pricing.ImageCost(c.size, e.Images)
+	case r.Usage != nil:
+		cached := 0
+		if r.Usage.PromptTokensDetails != nil {
+			cached = r.Usage.PromptTokensDetails.CachedTokens
+		}
+		e.PromptTokens, e.CompletionTokens = r.Usage.PromptTokens, r.Usage.CompletionTokens
+		e.Cost = g.pricing.Cost(e.Model, e.PromptTokens, cached, e.CompletionTokens)
+	default:
+		e.PromptTokens = c.promptTokens
+		e.Cost = g.pricing.Cost(e.Model, e.PromptTokens, 0, 0)
+	}
+	g.quotas[c.caller.name].add(now, int64(e.PromptTokens+e.CompletionTokens), e.Cost)
+	if err := g.log.write(e); err != nil {
+		log.Printf("failed to write usage log: %v", err)
+	}
+}
+
+// handler returns the HTTP handler of the gateway.
+func (g *gateway) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/chat/completions", g.endpoint(g.chatCompletions))
+	mux.Handle("/v1/completions", g.endpoint(g.completions))
+	mux.Handle("/v1/embeddings", g.endpoint(g.embeddings))
+	mux.Handle("/v1/images/generations", g.endpoint(g.images))
+	mux.HandleFunc("/v1/usage", g.usage)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// apiError returns an error sent to the caller in the format of the OpenAI API.
+func apiError(status int, errType, message string) error {
+	return gpt.APIError{StatusCode: status, Type: errType, Message: message}
+}
+
+// statusWriter remembers the status of a response for the access log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// authenticate returns the caller of the key in the Authorization header.
+func (g *gateway) authenticate(r *http.Request) (*caller, error) {
+	key := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if key == "" {
+		return nil, apiError(http.StatusUnauthorized, "invalid_request_error", "missing API key, send it as Authorization: Bearer KEY")
+	}
+	c, ok := g.callers[hashKey(key)]
+	if !ok {
+		return nil, apiError(http.StatusUnauthorized, "invalid_request_error", "invalid API key")
+	}
+	return c, nil
+}
+
+// endpoint authenticates the caller of a POST request, hands it to handle and logs it.
+func (g *gateway) endpoint(handle func(w http.ResponseWriter, r *http.Request, c *caller) error) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := g.now()
+		w := &statusWriter{ResponseWriter: rw, status: http.StatusOK}
+		name := "-"
+		err := func() error {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				return apiError(http.StatusMethodNotAllowed, "invalid_request_error", "use POST")
+			}
+			c, err := g.authenticate(r)
+			if err != nil {
+				return err
+			}
+			name = c.name
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+			return handle(w, r, c)
+		}()
+		if err != nil {
+			writeError(w, err)
+		}
+		log.Printf("%s %s %s %d %s", name, r.Method, r.URL.Path, w.status, g.now().Sub(start).Round(time.Millisecond))
+	})
+}
+
+// writeError sends err as an OpenAI error response. Errors of the upstream API are passed on.
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr gpt.APIError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, context.Canceled):
+		// the caller went away
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		apiErr = gpt.APIError{StatusCode: http.StatusGatewayTimeout, Type: "timeout", Message: "upstream request timed out"}
+	default:
+		apiErr = gpt.APIError{StatusCode: http.StatusBadGateway, Type: "api_error", Message: "upstream request failed: " + err.Error()}
+	}
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = http.StatusBadGateway
+	}
+	writeJSON(w, apiErr.StatusCode, gpt.APIErrorResponse{Error: apiErr})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// requestFields are the fields of a request body the gateway reads. The body is forwarded as is.
+type requestFields struct {
+	Model               string             `json:"model"`
+	Stream              bool               `json:"stream"`
+	StreamOptions       *gpt.StreamOptions `json:"stream_options"`
+	MaxTokens           int                `json:"max_tokens"`
+	MaxCompletionTokens int                `json:"max_completion_tokens"`
+	N                   *int               `json:"n"`
+	Size                string             `json:"size"`
+}
+
+// choices returns the number of choices asked for.
+func (f *requestFields) choices() int {
+	if f.N == nil || *f.N < 1 {
+		return 1
+	}
+	return *f.N
+}
+
+// admit checks that the caller may use model and is within its quota, reserving the tokens and cost
+// the request may use at most. The returned release takes the reservation back once the usage of the
+// request is recorded.
+func (g *gateway) admit(w http.ResponseWriter, c *caller, model string, tokens int, cost float64) (release func(), err error) {
+	if model == "" {
+		return nil, apiError(http.StatusBadRequest, "invalid_request_error", "you must provide a model parameter")
+	}
+	if !c.allows(model) {
+		return nil, apiError(http.StatusForbidden, "invalid_request_error", fmt.Sprintf("model %s is not allowed for this key", model))
+	}
+	q := g.quotas[c.name]
+	r, retry, err := q.admit(c, g.now(), int64(tokens), cost)
+	if err != nil {
+		seconds := int(retry / time.Second)
+		if retry%time.Second != 0 {
+			seconds++
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		return nil, err
+	}
+	return func() { q.release(r) }, nil
+}
+
+// countPrompt estimates the tokens of the prompt field of a request for model.
+func countPrompt(model string, prompt json.RawMessage) int {
+	tokens, err := tokenizer.Count(model, string(prompt))
+	if err != nil {
+		return len(prompt) / 4
+	}
+	return tokens
+}
+
+// admitText admits a request for text of model with promptTokens, reserving them and the tokens of its
+// completions of up to maxTokens each. A request without maxTokens reserves its prompt only, as
+// reserving the rest of the context window would hold most of a quota for every such request.
+func (g *gateway) admitText(w http.ResponseWriter, c *caller, model string, promptTokens, maxTokens, choices int) (func(), error) {
+	completionTokens := maxTokens * choices
+	return g.admit(w, c, model, promptTokens+completionTokens, g.pricing.Cost(model, promptTokens, 0, completionTokens))
+}
+
+// forward sends a request upstream and passes the response on to the caller.
+func (g *gateway) forward(w http.ResponseWriter, r *http.Request, c *call, req *request) error {
+	body, err := req.upstreamBody()
+	if err != nil {
+		return err
+	}
+	rsp, err := g.upstream.post(r.Context(), strings.TrimPrefix(r.URL.Path, "/v1"), body)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if !req.Stream || rsp.StatusCode != http.StatusOK {
+		return g.reply(w, c, rsp)
+	}
+	return g.stream(w, c, rsp, req.includesUsage())
+}
+
+func (g *gateway) chatCompletions(w http.ResponseWriter, r *http.Request, c *caller) error {
+	req, err := readRequest(r)
+	if err != nil {
+		return err
+	}
+	maxTokens := req.MaxCompletionTokens
+	if maxTokens == 0 {
+		maxTokens = req.MaxTokens
+	}
+	promptTokens := countPrompt(req.Model, req.fields["messages"])
+	release, err := g.admitText(w, c, req.Model, promptTokens, maxTokens, req.choices())
+	if err != nil {
+		return err
+	}
+	defer release()
+	method := "ChatCompletion"
+	if req.Stream {
+		method = "ChatCompletionStream"
+	}
+	return g.forward(w, r, &call{caller: c, method: method, model: req.Model, promptTokens: promptTokens}, req)
+}
+
+func (g *gateway) completions(w http.ResponseWriter, r *http.Request, c *caller) error {
+	req, err := readRequest(r)
+	if err != nil {
+		return err
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultCompletionTokens
+	}
+	promptTokens := countPrompt(req.Model, req.fields["prompt"])
+	release, err := g.admitText(w, c, req.Model, promptTokens, maxTokens, req.choices())
+	if err != nil {
+		return err
+	}
+	defer release()
+	method := "Completion"
+	if req.Stream {
+		method = "CompletionStream"
+	}
+	return g.forward(w, r, &call{caller: c, method: method, model: req.Model, promptTokens: promptTokens}, req)
+}
+
+func (g *gateway) embeddings(w http.ResponseWriter, r *http.Request, c *caller) error {
+	req, err := readRequest(r)
+	if err != nil {
+		return err
+	}
+	promptTokens := countPrompt(req.Model, req.fields["input"])
+	release, err := g.admitText(w, c, req.Model, promptTokens, 0, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return g.forward(w, r, &call{caller: c, method: "Embeddings", model: req.Model, promptTokens: promptTokens}, req)
+}
+
+func (g *gateway) images(w http.ResponseWriter, r *http.Request, c *caller) error {
+	req, err := readRequest(r)
+	if err != nil {
+		return err
+	}
+	model, size := req.Model, req.Size
+	if model == "" {
+		model = imageModel
+	}
+	if size == "" {
+		size = gpt.CreateImageSize1024x1024
+	}
+	release, err := g.admit(w, c, model, 0, g.pricing.ImageCost(size, req.choices()))
+	if err != nil {
+		return err
+	}
+	defer release()
+	// image requests aren't streamed
+	req.Stream = false
+	return g.forward(w, r, &call{caller: c, method: "Image", model: model, size: size}, req)
+}
+
+// usage answers a caller with its usage of the day and its limits.
+func (g *gateway) usage(w http.ResponseWriter, r *http.Request) {
+	c, err := g.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	q := g.quotas[c.name]
+	q.mu.Lock()
+	q.rollover(g.now())
+	rsp := map[string]interface{}{
+		"caller":              c.name,
+		"day":                 q.day,
+		"tokens":              q.tokens,
+		"cost":                q.cost,
+		"requests_per_minute": c.RequestsPerMinute,
+		"tokens_per_day":      c.TokensPerDay,
+		"budget_per_day":      c.BudgetPerDay,
+		"models":              c.Models,
+	}
+	q.mu.Unlock()
+	writeJSON(w, http.StatusOK, rsp)
+}
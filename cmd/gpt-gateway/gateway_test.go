@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+const testKey = "gw-test"
+
+// newTestGateway returns a gateway for one caller with testKey, forwarding to a gpttest server.
+func newTestGateway(t *testing.T, c *caller) (*gpttest.Server, *httptest.Server) {
+	t.Helper()
+	c.name, c.KeySHA256 = "test", hashKey(testKey)
+	upstream := gpttest.New(t)
+	cfg := &config{Callers: map[string]*caller{"test": c}}
+	proxy := &proxy{baseURL: upstream.BaseURL(), credential: gpt.StaticCredential(gpttest.APIKey), client: upstream.Server.Client()}
+	server := httptest.NewServer(newGateway(cfg, proxy, nil, nil).handler())
+	t.Cleanup(server.Close)
+	return upstream, server
+}
+
+func post(t *testing.T, server *httptest.Server, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testKey)
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rsp.Body.Close() })
+	return rsp
+}
+
+// usageOnly reports whether the data of an event is the usage chunk ending a stream.
+func usageOnly(data string) bool {
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   json.RawMessage   `json:"usage"`
+	}
+	return json.Unmarshal([]byte(data), &chunk) == nil && len(chunk.Choices) == 0 && len(chunk.Usage) > 0 &&
+		string(chunk.Usage) != "null"
+}
+
+// events returns the data of the server-sent events of a response.
+func events(t *testing.T, rsp *http.Response) []string {
+	t.Helper()
+	var data []string
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestGatewayForwardsBodies(t *testing.T) {
+	tests := []struct {
+		name, path, endpoint, body string
+	}{
+		{"chat", "/v1/chat/completions", gpttest.EndpointChatCompletions,
+			`{"model":"gpt-4o-mini","messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}],"temperature":0,` +
+				`"top_p":0,"stop":"\n","tools":[{"type":"function","function":{"name":"f"}}],"seed":7,"x_unknown":{"a":[1,2]}}`},
+		{"completion", "/v1/completions", gpttest.EndpointCompletions,
+			`{"model":"gpt-3.5-turbo-instruct","prompt":"hi","temperature":0,"stop":"\n","echo":true,"suffix":"","best_of":2}`},
+		{"embeddings", "/v1/embeddings", gpttest.EndpointEmbeddings,
+			`{"model":"text-embedding-3-small","input":"hi","dimensions":8,"encoding_format":"base64"}`},
+		{"images", "/v1/images/generations", gpttest.EndpointImages,
+			`{"model":"dall-e-3","prompt":"a cat","n":1,"quality":"hd","style":"vivid"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, server := newTestGateway(t, &caller{})
+			upstream.Enqueue(tt.endpoint, gpttest.Response{Body: map[string]interface{}{
+				"object": "test", "model": "m", "data": []interface{}{}, "choices": []interface{}{},
+				"usage": map[string]int{"prompt_tokens": 1, "total_tokens": 1}, "system_fingerprint": "fp_test",
+			}})
+			rsp := post(t, server, tt.path, tt.body)
+			if rsp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", rsp.StatusCode)
+			}
+			var got map[string]interface{}
+			if err := json.NewDecoder(rsp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got["system_fingerprint"] != "fp_test" {
+				t.Errorf("response %v lost fields of the upstream response", got)
+			}
+			sent, ok := upstream.LastRequest(tt.endpoint)
+			if !ok {
+				t.Fatal("request not forwarded")
+			}
+			var want, forwarded map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.body), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := sent.Decode(&forwarded); err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range want {
+				w, _ := json.Marshal(value)
+				f, _ := json.Marshal(forwarded[name])
+				if !bytes.Equal(w, f) {
+					t.Errorf("%s forwarded as %s, want %s", name, f, w)
+				}
+			}
+			if len(forwarded) != len(want) {
+				t.Errorf("forwarded %s, want %s", sent.Body, tt.body)
+			}
+			upstream.AssertAuthorization(t, gpttest.APIKey)
+		})
+	}
+}
+
+func TestGatewayStreams(t *testing.T) {
+	tests := []struct {
+		name, path, endpoint, body string
+		usage                      bool
+	}{
+		{"chat", "/v1/chat/completions", gpttest.EndpointChatCompletions,
+			`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"stream":true,"stop":"\n"}`, false},
+		{"chat with usage", "/v1/chat/completions", gpttest.EndpointChatCompletions,
+			`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`, true},
+		{"completion", "/v1/completions", gpttest.EndpointCompletions,
+			`{"model":"gpt-3.5-turbo-instruct","prompt":"hi","stream":true}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, server := newTestGateway(t, &caller{})
+			rsp := post(t, server, tt.path, tt.body)
+			if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("status %d, content type %q", rsp.StatusCode, rsp.Header.Get("Content-Type"))
+			}
+			data := events(t, rsp)
+			if len(data) < 2 || data[len(data)-1] != "[DONE]" || strings.Count(strings.Join(data, "\n"), "[DONE]") != 1 {
+				t.Fatalf("events %q, want chunks ending with one [DONE]", data)
+			}
+			usage := 0
+			for _, d := range data[:len(data)-1] {
+				if usageOnly(d) {
+					usage++
+				}
+			}
+			if want := map[bool]int{false: 0, true: 1}[tt.usage]; usage != want {
+				t.Errorf("%d usage chunks in %q, want %d", usage, data, want)
+			}
+			sent, _ := upstream.LastRequest(tt.endpoint)
+			var body struct {
+				StreamOptions gpt.StreamOptions `json:"stream_options"`
+			}
+			if err := sent.Decode(&body); err != nil || !body.StreamOptions.IncludeUsage {
+				t.Errorf("stream sent without include_usage: %s", sent.Body)
+			}
+
+			usageRsp := post(t, server, "/v1/usage", "")
+			var quota struct {
+				Tokens int64 `json:"tokens"`
+			}
+			if err := json.NewDecoder(usageRsp.Body).Decode(&quota); err != nil || quota.Tokens == 0 {
+				t.Errorf("usage of the stream not counted: %+v, %v", quota, err)
+			}
+		})
+	}
+}
+
+func TestGatewayQuotaReservesConcurrentRequests(t *testing.T) {
+	upstream, server := newTestGateway(t, &caller{TokensPerDay: 1000})
+	started, finish := make(chan struct{}, 3), make(chan struct{})
+	upstream.Handle(gpttest.EndpointChatCompletions, func(req gpttest.Request) gpttest.Response {
+		started <- struct{}{}
+		<-finish
+		return gpttest.Response{}
+	})
+	body := `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"max_tokens":500}`
+	statuses := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			statuses <- post(t, server, "/v1/chat/completions", body).StatusCode
+		}()
+		<-started
+	}
+	rsp := post(t, server, "/v1/chat/completions", body)
+	var rejected gpt.APIErrorResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.StatusCode != http.StatusTooManyRequests || rsp.Header.Get("Retry-After") != "1" || rejected.Error.Type == "insufficient_quota" {
+		t.Errorf("request while two others reserve over 1000 tokens: status %d, Retry-After %q, error %+v",
+			rsp.StatusCode, rsp.Header.Get("Retry-After"), rejected.Error)
+	}
+	close(finish)
+	for i := 0; i < 2; i++ {
+		if status := <-statuses; status != http.StatusOK {
+			t.Errorf("request in flight: status %d", status)
+		}
+	}
+	upstream.AssertCalled(t, gpttest.EndpointChatCompletions, 2)
+
+	// the reservations are replaced by the few tokens actually used
+	if rsp := post(t, server, "/v1/chat/completions", body); rsp.StatusCode != http.StatusOK {
+		t.Errorf("request after the others finished: status %d", rsp.StatusCode)
+	}
+}
+
+func TestGatewayQuotaReservesPromptWithoutMaxTokens(t *testing.T) {
+	upstream, server := newTestGateway(t, &caller{TokensPerDay: 1000})
+	started, finish := make(chan struct{}, 8), make(chan struct{})
+	upstream.Handle(gpttest.EndpointChatCompletions, func(req gpttest.Request) gpttest.Response {
+		started <- struct{}{}
+		<-finish
+		return gpttest.Response{}
+	})
+	body := `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+	statuses := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			statuses <- post(t, server, "/v1/chat/completions", body).StatusCode
+		}()
+		<-started
+	}
+	close(finish)
+	for i := 0; i < 4; i++ {
+		if status := <-statuses; status != http.StatusOK {
+			t.Errorf("concurrent request without max_tokens: status %d", status)
+		}
+	}
+}
+
+func TestGatewayQuotaExhausted(t *testing.T) {
+	_, server := newTestGateway(t, &caller{TokensPerDay: 1})
+	body := `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+	if rsp := post(t, server, "/v1/chat/completions", body); rsp.StatusCode != http.StatusOK {
+		t.Fatalf("first request: status %d", rsp.StatusCode)
+	}
+	rsp := post(t, server, "/v1/chat/completions", body)
+	var rejected gpt.APIErrorResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	retry, _ := strconv.Atoi(rsp.Header.Get("Retry-After"))
+	if rsp.StatusCode != http.StatusTooManyRequests || rejected.Error.Type != "insufficient_quota" || retry <= 1 {
+		t.Errorf("request after the quota is used up: status %d, Retry-After %q, error %+v",
+			rsp.StatusCode, rsp.Header.Get("Retry-After"), rejected.Error)
+	}
+}
+
+func TestGatewayPassesUpstreamErrors(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(strconv.FormatBool(stream), func(t *testing.T) {
+			upstream, server := newTestGateway(t, &caller{})
+			upstream.Enqueue(gpttest.EndpointChatCompletions, gpttest.ErrorResponse(http.StatusBadRequest, "invalid_request_error", "bad tools"))
+			body := fmt.Sprintf(`{"model":"gpt-4o-mini","messages":[],"stream":%t}`, stream)
+			rsp := post(t, server, "/v1/chat/completions", body)
+			var got gpt.APIErrorResponse
+			if err := json.NewDecoder(rsp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if rsp.StatusCode != http.StatusBadRequest || got.Error.Message != "bad tools" {
+				t.Errorf("status %d, error %+v, want the upstream error", rsp.StatusCode, got.Error)
+			}
+		})
+	}
+}
+
+func TestGatewayRejects(t *testing.T) {
+	tests := []struct {
+		name, key, body string
+		status          int
+	}{
+		{"missing key", "", `{"model":"gpt-4o-mini"}`, http.StatusUnauthorized},
+		{"wrong key", "gw-other", `{"model":"gpt-4o-mini"}`, http.StatusUnauthorized},
+		{"model not allowed", testKey, `{"model":"gpt-4o"}`, http.StatusForbidden},
+		{"missing model", testKey, `{"messages":[]}`, http.StatusBadRequest},
+		{"invalid JSON", testKey, `{"model":`, http.StatusBadRequest},
+		{"not an object", testKey, `null`, http.StatusBadRequest},
+		{"wrong type", testKey, `{"model":"gpt-4o-mini","max_tokens":"10"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, server := newTestGateway(t, &caller{Models: []string{"gpt-4o-mini"}})
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+			var body gpt.APIErrorResponse
+			if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil || body.Error.Message == "" {
+				t.Errorf("error response %+v, %v", body, err)
+			}
+			if rsp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", rsp.StatusCode, tt.status)
+			}
+			upstream.AssertCalled(t, gpttest.EndpointChatCompletions, 0)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Command gpt-gateway is an OpenAI-compatible gateway, so services use the API with internal keys
+// instead of the real one. It serves /v1/chat/completions, /v1/completions, /v1/embeddings and
+// /v1/images/generations, streaming responses as server-sent events, and enforces a model allowlist
+// and quotas per caller while logging their usage:
+//
+//	OPENAI_API_KEY=sk-... gpt-gateway -config gpt-gateway.json
+//
+// The gateway is a reverse proxy: request and response bodies are passed on as they are, so callers can
+// use any field of the API. It reads the model and token limits of a request to admit it, and the usage
+// a response reports to count it; streams are asked for their usage, which is only passed on to callers
+// that ask for it too. Requests don't go through a gpt.Client, so its wrappers don't apply.
+//
+// The configuration file is JSON:
+//
+//	{
+//	  "listen": ":8080",
+//	  "upstream": {"api_key_env": "OPENAI_API_KEY", "timeout": "10m"},
+//	  "usage_log": "usage.jsonl",
+//	  "callers": {
+//	    "search": {
+//	      "key_sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+//	      "models": ["gpt-4o-mini", "text-embedding-3-*"],
+//	      "requests_per_minute": 600,
+//	      "tokens_per_day": 5000000,
+//	      "budget_per_day": 20
+//	    }
+//	  }
+//	}
+//
+// Run gpt-gateway -new-key to create a caller key with its key_sha256. Callers send their key as
+// Authorization: Bearer KEY, and can see their usage of the day at /v1/usage.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// shutdownTimeout is how long running requests may take to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	configPath := flag.String("config", "gpt-gateway.json", "configuration file")
+	listen := flag.String("listen", "", "address to listen on, overriding the configuration file")
+	newKey := flag.Bool("new-key", false, "print a new caller key and its key_sha256, then exit")
+	flag.Parse()
+	if *newKey {
+		key, err := generateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("key:        %s\nkey_sha256: %s\n", key, hashKey(key))
+		return
+	}
+	if err := run(*configPath, *listen); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generateKey returns a random caller key.
+func generateKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return "gw-" + hex.EncodeToString(b), nil
+}
+
+func run(configPath, listen string) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if listen != "" {
+		cfg.Listen = listen
+	}
+	if strings.TrimSpace(os.Getenv(cfg.Upstream.APIKeyEnv)) == "" {
+		return fmt.Errorf("missing API key in environment variable %s", cfg.Upstream.APIKeyEnv)
+	}
+	upstream := &proxy{
+		baseURL:    cfg.Upstream.BaseURL,
+		org:        cfg.Upstream.OrgID,
+		credential: gpt.EnvCredential(cfg.Upstream.APIKeyEnv),
+		client:     &http.Client{Timeout: cfg.Upstream.timeout},
+	}
+	usage, closer, entries, err := openUsageLog(cfg.UsageLog)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	g := newGateway(cfg, upstream, usage, entries)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           g.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		done <- server.Shutdown(shutdownCtx)
+	}()
+	log.Printf("gpt-gateway listening on %s for %d callers", cfg.Listen, len(cfg.Callers))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
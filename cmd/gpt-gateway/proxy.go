@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// forwardedHeaders are the headers of an upstream response passed on to the caller.
+var forwardedHeaders = []string{"Content-Type", "Retry-After", "X-Request-Id"}
+
+// proxy sends request bodies to the API as they are, with the real key. The gateway is a reverse proxy
+// rather than a user of gpt.Client, so callers can use any field of the API and get its responses as
+// they came.
+type proxy struct {
+	baseURL    string
+	org        string
+	credential gpt.CredentialProvider
+	client     *http.Client
+}
+
+// post sends body to the endpoint at path of the API, such as /chat/completions.
+func (p *proxy) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.baseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.credential.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if p.org != "" {
+		req.Header.Set("OpenAI-Organization", p.org)
+	}
+	return p.client.Do(req)
+}
+
+// request is the body of a request of a caller, a JSON object.
+type request struct {
+	data   []byte
+	fields map[string]json.RawMessage
+	requestFields
+}
+
+// readRequest reads the body of a request, decoding the fields the gateway uses.
+func readRequest(r *http.Request) (*request, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apiError(http.StatusBadRequest, "invalid_request_error", "failed to read body: "+err.Error())
+	}
+	req := &request{data: data}
+	if err := json.Unmarshal(data, &req.fields); err != nil {
+		return nil, apiError(http.StatusBadRequest, "invalid_request_error", "invalid JSON body: "+err.Error())
+	}
+	if req.fields == nil {
+		return nil, apiError(http.StatusBadRequest, "invalid_request_error", "the body must be a JSON object")
+	}
+	if err := json.Unmarshal(data, &req.requestFields); err != nil {
+		return nil, apiError(http.StatusBadRequest, "invalid_request_error", "invalid request: "+err.Error())
+	}
+	return req, nil
+}
+
+// includesUsage reports whether the caller asked for the usage chunk ending a stream.
+func (r *request) includesUsage() bool {
+	return r.StreamOptions != nil && r.StreamOptions.IncludeUsage
+}
+
+// upstreamBody returns the body to send upstream. It is the body of the caller, except that streams
+// ask for their usage so it can be counted.
+func (r *request) upstreamBody() ([]byte, error) {
+	if !r.Stream || r.includesUsage() {
+		return r.data, nil
+	}
+	options := map[string]json.RawMessage{}
+	if value, ok := r.fields["stream_options"]; ok && !bytes.Equal(value, []byte("null")) {
+		if err := json.Unmarshal(value, &options); err != nil {
+			return nil, apiError(http.StatusBadRequest, "invalid_request_error", "invalid stream_options: "+err.Error())
+		}
+	}
+	options["include_usage"] = json.RawMessage("true")
+	fields := make(map[string]json.RawMessage, len(r.fields)+1)
+	for name, value := range r.fields {
+		fields[name] = value
+	}
+	var err error
+	if fields["stream_options"], err = json.Marshal(options); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// reported is what a response or a chunk of a stream reports about its usage.
+type reported struct {
+	Model   string            `json:"model"`
+	Usage   *apiUsage         `json:"usage"`
+	Data    []json.RawMessage `json:"data"`
+	Choices []json.RawMessage `json:"choices"`
+}
+
+// apiUsage is the usage object of the API. Embeddings report prompt tokens only.
+type apiUsage struct {
+	PromptTokens        int                      `json:"prompt_tokens"`
+	CompletionTokens    int                      `json:"completion_tokens"`
+	PromptTokensDetails *gpt.PromptTokensDetails `json:"prompt_tokens_details"`
+}
+
+// copyHeaders passes the forwarded headers of an upstream response on to w.
+func copyHeaders(w http.ResponseWriter, rsp *http.Response) {
+	for _, name := range forwardedHeaders {
+		if value := rsp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+}
+
+// reply passes an upstream response on to the caller as it came, recording the usage of a successful one.
+func (g *gateway) reply(w http.ResponseWriter, c *call, rsp *http.Response) error {
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read upstream response: %w", err)
+	}
+	if rsp.StatusCode == http.StatusOK {
+		var r reported
+		if err := json.Unmarshal(data, &r); err != nil {
+			log.Printf("failed to read usage of %s: %v", c.method, err)
+		}
+		g.record(c, &r)
+	}
+	copyHeaders(w, rsp)
+	w.WriteHeader(rsp.StatusCode)
+	_, err = w.Write(data)
+	return err
+}
+
+// stream passes the server-sent events of an upstream stream on to the caller as they come, except the
+// usage chunk the gateway asked for when the caller didn't. The usage is recorded when the stream ends.
+func (g *gateway) stream(w http.ResponseWriter, c *call, rsp *http.Response, forwardUsage bool) error {
+	copyHeaders(w, rsp)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var total reported
+	defer func() { g.record(c, &total) }()
+	reader := bufio.NewReader(rsp.Body)
+	// skip drops the lines of an event up to the blank line ending it
+	skip := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if data, ok := eventData(line); ok && !bytes.Equal(data, []byte("[DONE]")) {
+			var chunk reported
+			if json.Unmarshal(data, &chunk) == nil {
+				if total.Model == "" {
+					total.Model = chunk.Model
+				}
+				if chunk.Usage != nil {
+					total.Usage = chunk.Usage
+					skip = !forwardUsage && len(chunk.Choices) == 0
+				}
+			}
+		}
+		if !skip && len(line) > 0 {
+			if _, err := w.Write(line); err != nil {
+				return nil
+			}
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			skip = false
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("stream of %s ended with error: %v", c.method, err)
+			}
+			return nil
+		}
+	}
+}
+
+// eventData returns the data of a data line of a server-sent event.
+func eventData(line []byte) ([]byte, bool) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return nil, false
+	}
+	return bytes.TrimSpace(line[len("data:"):]), true
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// quota is what a caller used, checked against its limits.
+type quota struct {
+	mu sync.Mutex
+	// requests are the times of the requests admitted in the last minute
+	requests []time.Time
+	// day is the UTC day tokens and cost are counted for
+	day    string
+	tokens int64
+	cost   float64
+	// reservedTokens and reservedCost are reserved by the requests in flight
+	reservedTokens int64
+	reservedCost   float64
+}
+
+// reservedRetry is when to retry a request rejected for the reservations of requests in flight, which
+// are mostly taken back when they finish.
+const reservedRetry = time.Second
+
+// rollover starts counting a new day.
+func (q *quota) rollover(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); day != q.day {
+		q.day, q.tokens, q.cost, q.reservedTokens, q.reservedCost = day, 0, 0, 0, 0
+	}
+}
+
+// reservation is the usage a request may have at most, counted against the quota of its day until its
+// usage is known.
+type reservation struct {
+	day    string
+	tokens int64
+	cost   float64
+}
+
+// admit counts a request of c that may use up to tokens and cost, reserving them until release, or
+// returns the error rejecting it and when to retry. Reserving keeps concurrent requests from exceeding
+// the daily quotas together. A request is only told to retry tomorrow once the usage of the day
+// exhausts a quota; while reservations of requests in flight fill it, it is told to retry shortly.
+func (q *quota) admit(c *caller, now time.Time, tokens int64, cost float64) (reservation, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	switch {
+	case c.TokensPerDay > 0 && q.tokens >= c.TokensPerDay:
+		return reservation{}, untilTomorrow(now), apiError(http.StatusTooManyRequests, "insufficient_quota",
+			fmt.Sprintf("daily token quota of %d exhausted", c.TokensPerDay))
+	case c.BudgetPerDay > 0 && q.cost >= c.BudgetPerDay:
+		return reservation{}, untilTomorrow(now), apiError(http.StatusTooManyRequests, "insufficient_quota",
+			fmt.Sprintf("daily budget of $%.2f exhausted", c.BudgetPerDay))
+	case c.TokensPerDay > 0 && q.tokens+q.reservedTokens >= c.TokensPerDay:
+		return reservation{}, reservedRetry, apiError(http.StatusTooManyRequests, "tokens",
+			fmt.Sprintf("the rest of the daily token quota of %d is reserved by requests in flight", c.TokensPerDay))
+	case c.BudgetPerDay > 0 && q.cost+q.reservedCost >= c.BudgetPerDay:
+		return reservation{}, reservedRetry, apiError(http.StatusTooManyRequests, "tokens",
+			fmt.Sprintf("the rest of the daily budget of $%.2f is reserved by requests in flight", c.BudgetPerDay))
+	}
+	if c.RequestsPerMinute > 0 {
+		start := 0
+		for start < len(q.requests) && now.Sub(q.requests[start]) >= time.Minute {
+			start++
+		}
+		q.requests = q.requests[start:]
+		if len(q.requests) >= c.RequestsPerMinute {
+			return reservation{}, q.requests[0].Add(time.Minute).Sub(now), apiError(http.StatusTooManyRequests, "requests",
+				fmt.Sprintf("rate limit of %d requests per minute reached", c.RequestsPerMinute))
+		}
+		q.requests = append(q.requests, now)
+	}
+	q.reservedTokens += tokens
+	q.reservedCost += cost
+	return reservation{day: q.day, tokens: tokens, cost: cost}, 0, nil
+}
+
+// release takes back a reservation once the usage of its request is added, or the request failed.
+func (q *quota) release(r reservation) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r.day == q.day {
+		q.reservedTokens -= r.tokens
+		q.reservedCost -= r.cost
+	}
+}
+
+// add counts the usage of a request made at t. Usage of a day before the counted one is ignored.
+func (q *quota) add(t time.Time, tokens int64, cost float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// dates in this format sort like strings
+	day := t.UTC().Format("2006-01-02")
+	if day > q.day {
+		q.rollover(t)
+	}
+	if day == q.day {
+		q.tokens += tokens
+		q.cost += cost
+	}
+}
+
+func untilTomorrow(now time.Time) time.Duration {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+// usageEntry is a line of the usage log.
+type usageEntry struct {
+	Time             time.Time `json:"time"`
+	Caller           string    `json:"caller"`
+	Method           string    `json:"method"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Images           int       `json:"images,omitempty"`
+	// Cost is the list price of the request in US dollars
+	Cost float64 `json:"cost"`
+}
+
+// usageLog appends usage entries as JSON lines.
+type usageLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (l *usageLog) write(e usageEntry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(e)
+}
+
+// openUsageLog opens the usage log for appending and returns the entries it already holds.
+func openUsageLog(path string) (*usageLog, io.Closer, []usageEntry, error) {
+	switch path {
+	case "":
+		return nil, io.NopCloser(nil), nil, nil
+	case "-":
+		return &usageLog{enc: json.NewEncoder(os.Stdout)}, io.NopCloser(nil), nil, nil
+	}
+	entries, err := readUsageLog(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	return &usageLog{enc: json.NewEncoder(file)}, file, entries, nil
+}
+
+func readUsageLog(path string) ([]usageEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	defer file.Close()
+	var entries []usageEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e usageEntry
+		// a line cut off by a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return entries, nil
+}
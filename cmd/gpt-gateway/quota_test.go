@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+func TestQuotaAdmit(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		at     time.Duration
+		tokens int64
+		cost   float64
+		// release takes back the reservation of the step this many steps before, add adds usage first
+		release int
+		add     int64
+		ok      bool
+		// reserved is whether a rejected request is rejected for the reservations of requests in flight
+		reserved bool
+	}
+	tests := []struct {
+		name   string
+		caller caller
+		steps  []step
+	}{
+		{"no limits", caller{}, []step{{tokens: 1 << 40, ok: true}, {tokens: 1 << 40, ok: true}}},
+		{"token quota", caller{TokensPerDay: 100}, []step{
+			{add: 60, ok: true},
+			{add: 40, ok: false},
+		}},
+		{"concurrent requests reserve tokens", caller{TokensPerDay: 100}, []step{
+			{tokens: 60, ok: true},
+			{tokens: 60, ok: true},
+			{tokens: 1, ok: false, reserved: true},
+		}},
+		{"release takes back the reservation", caller{TokensPerDay: 100}, []step{
+			{tokens: 100, ok: true},
+			{tokens: 1, ok: false, reserved: true},
+			{release: 2, add: 10, tokens: 80, ok: true},
+			{tokens: 10, ok: true},
+			{tokens: 1, ok: false, reserved: true},
+		}},
+		{"budget", caller{BudgetPerDay: 1}, []step{
+			{cost: 0.6, ok: true},
+			{cost: 0.6, ok: true},
+			{cost: 0.1, ok: false, reserved: true},
+		}},
+		{"new day", caller{TokensPerDay: 100}, []step{
+			{tokens: 100, ok: true},
+			{at: 11 * time.Hour, tokens: 1, ok: false, reserved: true},
+			{at: 12 * time.Hour, tokens: 100, ok: true},
+			{at: 12 * time.Hour, release: 3, tokens: 1, ok: false, reserved: true},
+		}},
+		{"requests per minute", caller{RequestsPerMinute: 2}, []step{
+			{ok: true},
+			{at: 30 * time.Second, ok: true},
+			{at: 59 * time.Second, ok: false},
+			{at: time.Minute, ok: true},
+			{at: time.Minute, ok: false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &quota{}
+			reservations := make([]reservation, len(tt.steps))
+			for i, s := range tt.steps {
+				now := day.Add(s.at)
+				if s.add > 0 {
+					q.add(now, s.add, 0)
+				}
+				if s.release > 0 {
+					q.release(reservations[i-s.release])
+				}
+				r, retry, err := q.admit(&tt.caller, now, s.tokens, s.cost)
+				if (err == nil) != s.ok {
+					t.Fatalf("step %d: admit error = %v, want admitted %v", i, err, s.ok)
+				}
+				if err != nil && retry <= 0 {
+					t.Errorf("step %d: retry after %v", i, retry)
+				}
+				var apiErr gpt.APIError
+				if err != nil && errors.As(err, &apiErr) && (apiErr.Type == "tokens") != s.reserved {
+					t.Errorf("step %d: error %v, want rejected for reservations %v", i, err, s.reserved)
+				}
+				if s.reserved && retry != reservedRetry {
+					t.Errorf("step %d: retry after %v, want %v", i, retry, reservedRetry)
+				}
+				reservations[i] = r
+			}
+		})
+	}
+}
+
+func TestQuotaAddIgnoresEarlierDays(t *testing.T) {
+	q := &quota{}
+	today := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	q.add(today, 10, 0.1)
+	q.add(today.Add(-24*time.Hour), 1000, 10)
+	if q.tokens != 10 || q.cost != 0.1 {
+		t.Errorf("quota counts %d tokens and $%v, want the usage of today only", q.tokens, q.cost)
+	}
+	q.add(today.Add(24*time.Hour), 5, 0.05)
+	if q.day != "2024-05-03" || q.tokens != 5 {
+		t.Errorf("quota of %s counts %d tokens, want 5 on 2024-05-03", q.day, q.tokens)
+	}
+}
+
+func TestUntilTomorrow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 30, 0, time.FixedZone("CEST", 2*60*60))
+	if got := untilTomorrow(now); got != 2*time.Hour+30*time.Second {
+		t.Errorf("untilTomorrow = %v, want the time to midnight UTC", got)
+	}
+}
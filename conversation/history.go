@@ -0,0 +1,174 @@
+// Package conversation keeps the message history of a chat and fits it into the model's context window
+// before every request, so long conversations don't fail with context-length errors.
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+// Define message roles
+const (
+	RoleSystem    = "system"    // RoleSystem instructs the model
+	RoleUser      = "user"      // RoleUser is a message from the user
+	RoleAssistant = "assistant" // RoleAssistant is a reply from the model
+)
+
+// DefaultReservedTokens is the room left for the reply when a request doesn't set MaxTokens.
+const DefaultReservedTokens = 1024
+
+// DefaultContextWindow is the context window assumed for models the tokenizer doesn't know, such as
+// custom or self-hosted models and Azure deployment names.
+const DefaultContextWindow = 8192
+
+// ErrContextWindowExceeded is returned when the pinned messages and the latest turn don't fit the context
+// window on their own.
+var ErrContextWindowExceeded = errors.New("conversation does not fit the context window")
+
+// History is the message history of a chat. The zero value is ready to use and drops the oldest turns
+// when the conversation outgrows the context window. A History is not safe for concurrent use.
+type History struct {
+	// Messages is the full history, including messages that no longer fit the context window
+	Messages []gpt.ChatCompletionRequestMessage
+	// Strategy fits the messages into the context window. Defaults to DropOldest.
+	Strategy Strategy
+	// ReservedTokens is the room left for the reply when the request doesn't set MaxTokens.
+	// Defaults to DefaultReservedTokens.
+	ReservedTokens int
+	// ContextWindow overrides the context window of the model, in tokens. Defaults to the window the
+	// tokenizer knows for the model, or DefaultContextWindow.
+	ContextWindow int
+}
+
+// New returns a history that starts with a system prompt, if one is given.
+func New(system string, strategy Strategy) *History {
+	h := &History{Strategy: strategy}
+	if system != "" {
+		h.Add(RoleSystem, system)
+	}
+	return h
+}
+
+// Add appends a message to the history.
+func (h *History) Add(role, content string) {
+	h.Messages = append(h.Messages, gpt.ChatCompletionRequestMessage{Role: role, Content: content})
+}
+
+// Reset removes every message except the system messages.
+func (h *History) Reset() {
+	var kept []gpt.ChatCompletionRequestMessage
+	for _, msg := range h.Messages {
+		if msg.Role == RoleSystem {
+			kept = append(kept, msg)
+		}
+	}
+	h.Messages = kept
+}
+
+// Fit returns the messages to send to a model whose reply may use up to reserved tokens.
+func (h *History) Fit(ctx context.Context, model string, reserved int) ([]gpt.ChatCompletionRequestMessage, error) {
+	if reserved <= 0 {
+		reserved = h.ReservedTokens
+	}
+	if reserved <= 0 {
+		reserved = DefaultReservedTokens
+	}
+	count := func(messages []gpt.ChatCompletionRequestMessage) int {
+		return h.count(model, messages)
+	}
+	strategy := h.Strategy
+	if strategy == nil {
+		strategy = DropOldest()
+	}
+	return strategy.Fit(ctx, h.Messages, h.Window(model)-reserved, count)
+}
+
+// Window returns the context window of a model in tokens.
+func (h *History) Window(model string) int {
+	if h.ContextWindow > 0 {
+		return h.ContextWindow
+	}
+	if model == "" {
+		model = gpt.GPT3Dot5Turbo
+	}
+	if window, err := tokenizer.ContextWindow(model); err == nil {
+		return window
+	}
+	return DefaultContextWindow
+}
+
+// Tokens returns the prompt tokens of the whole history for a model.
+func (h *History) Tokens(model string) int {
+	return h.count(model, h.Messages)
+}
+
+func (h *History) count(model string, messages []gpt.ChatCompletionRequestMessage) int {
+	n, _ := tokenizer.CountChatTokens(countedModel(model), messages)
+	return n
+}
+
+// countedModel returns the model to count tokens for. Models without a known encoding are counted as
+// GPT-4, with cl100k_base.
+func countedModel(model string) string {
+	if model == "" {
+		return gpt.GPT3Dot5Turbo
+	}
+	if _, err := tokenizer.EncodingNameForModel(model); err != nil {
+		return gpt.GPT4
+	}
+	return model
+}
+
+// ChatCompletion appends the user message, sends the fitted history with the request's other settings
+// and appends the reply to the history.
+func (h *History) ChatCompletion(ctx context.Context, client gpt.Client, request *gpt.ChatCompletionRequest, content string) (*gpt.ChatCompletionResponse, error) {
+	if err := h.prepare(ctx, request, content); err != nil {
+		return nil, err
+	}
+	rsp, err := client.ChatCompletion(ctx, request)
+	if err != nil {
+		h.Messages = h.Messages[:len(h.Messages)-1]
+		return nil, err
+	}
+	if len(rsp.Choices) > 0 {
+		h.Add(RoleAssistant, rsp.Choices[0].Message.Content)
+	}
+	return rsp, nil
+}
+
+// ChatCompletionStream is like ChatCompletion but streams the reply to onData. The reply received so far
+// is appended to the history even if the stream fails part way.
+func (h *History) ChatCompletionStream(ctx context.Context, client gpt.Client, request *gpt.ChatCompletionRequest, content string, onData func(*gpt.ChatCompletionStreamResponse)) error {
+	if err := h.prepare(ctx, request, content); err != nil {
+		return err
+	}
+	var reply strings.Builder
+	err := client.ChatCompletionStream(ctx, request, func(rsp *gpt.ChatCompletionStreamResponse) {
+		if len(rsp.Choices) > 0 {
+			reply.WriteString(rsp.Choices[0].Delta.Content)
+		}
+		onData(rsp)
+	})
+	if reply.Len() > 0 {
+		h.Add(RoleAssistant, reply.String())
+	} else if err != nil {
+		h.Messages = h.Messages[:len(h.Messages)-1]
+	}
+	return err
+}
+
+func (h *History) prepare(ctx context.Context, request *gpt.ChatCompletionRequest, content string) error {
+	h.Add(RoleUser, content)
+	messages, err := h.Fit(ctx, request.Model, request.MaxTokens)
+	if err != nil {
+		h.Messages = h.Messages[:len(h.Messages)-1]
+		return fmt.Errorf("failed to fit conversation: %w", err)
+	}
+	request.Messages = messages
+	return nil
+}
@@ -0,0 +1,145 @@
+package conversation_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/conversation"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+const reserved = 100
+
+func msg(role, content string) gpt.ChatCompletionRequestMessage {
+	return gpt.ChatCompletionRequestMessage{Role: role, Content: content}
+}
+
+// chat is a conversation of three turns after a system prompt.
+var chat = []gpt.ChatCompletionRequestMessage{
+	msg(conversation.RoleSystem, "You are terse."),
+	msg(conversation.RoleUser, "What is the capital of France?"),
+	msg(conversation.RoleAssistant, "Paris."),
+	msg(conversation.RoleUser, "And of Italy?"),
+	msg(conversation.RoleAssistant, "Rome."),
+	msg(conversation.RoleUser, "And of Spain?"),
+}
+
+// windowFor returns a context window that fits exactly messages and the reserved tokens.
+func windowFor(t *testing.T, messages []gpt.ChatCompletionRequestMessage) int {
+	n, err := tokenizer.CountChatTokens(gpt.GPT4, messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n + reserved
+}
+
+func pick(indexes ...int) []gpt.ChatCompletionRequestMessage {
+	messages := make([]gpt.ChatCompletionRequestMessage, 0, len(indexes))
+	for _, i := range indexes {
+		messages = append(messages, chat[i])
+	}
+	return messages
+}
+
+func TestHistoryFit(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy conversation.Strategy
+		window   []gpt.ChatCompletionRequestMessage
+		want     []gpt.ChatCompletionRequestMessage
+		err      error
+	}{
+		{"everything fits", nil, chat, chat, nil},
+		{"drops the oldest turn", nil, pick(0, 3, 4, 5), pick(0, 3, 4, 5), nil},
+		{"keeps the latest turn", conversation.DropOldest(), pick(0, 5), pick(0, 5), nil},
+		{"sliding window drops turns that fit", conversation.SlidingWindow(2), chat, pick(0, 3, 4, 5), nil},
+		{"latest turn too long", nil, pick(0), nil, conversation.ErrContextWindowExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &conversation.History{
+				Messages:      chat,
+				Strategy:      tt.strategy,
+				ContextWindow: windowFor(t, tt.window),
+			}
+			got, err := h.Fit(context.Background(), gpt.GPT4, reserved)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Fit error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryUnknownModel(t *testing.T) {
+	h := &conversation.History{Messages: chat}
+	if got := h.Window("my-llama-deployment"); got != conversation.DefaultContextWindow {
+		t.Errorf("Window = %d, want %d", got, conversation.DefaultContextWindow)
+	}
+	want, err := tokenizer.CountChatTokens(gpt.GPT4, chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Tokens("my-llama-deployment"); got != want {
+		t.Errorf("Tokens = %d, want %d counted with cl100k_base", got, want)
+	}
+	messages, err := h.Fit(context.Background(), "my-llama-deployment", 0)
+	if err != nil || !reflect.DeepEqual(messages, chat) {
+		t.Errorf("Fit = %v, %v, want the whole history", messages, err)
+	}
+
+	h.ContextWindow = windowFor(t, pick(0, 5))
+	messages, err = h.Fit(context.Background(), "my-llama-deployment", reserved)
+	if err != nil || !reflect.DeepEqual(messages, pick(0, 5)) {
+		t.Errorf("Fit with ContextWindow = %v, %v, want the latest turn", messages, err)
+	}
+}
+
+func TestHistoryWindow(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"", 16385},
+		{gpt.GPT4, 8192},
+		{gpt.GPT4o, 128000},
+		{"azure-gpt4o-deployment", conversation.DefaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := (&conversation.History{}).Window(tt.model); got != tt.want {
+			t.Errorf("Window(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizer(t *testing.T) {
+	server := gpttest.New(t)
+	server.Enqueue(gpttest.EndpointChatCompletions, gpttest.Response{Body: map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": "Asked for capitals."}}},
+	}})
+	summary := msg(conversation.RoleSystem, "Summary of the earlier conversation: Asked for capitals.")
+	want := []gpt.ChatCompletionRequestMessage{chat[0], summary, chat[5]}
+	h := &conversation.History{
+		Messages:      chat,
+		Strategy:      conversation.Summarize(server.Client(), gpt.GPT3Dot5Turbo),
+		ContextWindow: windowFor(t, want),
+	}
+	got, err := h.Fit(context.Background(), gpt.GPT4, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fit = %v, want %v", got, want)
+	}
+	request, _ := server.LastRequest(gpttest.EndpointChatCompletions)
+	if !strings.Contains(string(request.Body), "And of Italy?") || strings.Contains(string(request.Body), "And of Spain?") {
+		t.Errorf("summary request should hold the evicted turns only: %s", request.Body)
+	}
+}
@@ -0,0 +1,214 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// CountFunc returns the prompt tokens of a list of messages.
+type CountFunc func(messages []gpt.ChatCompletionRequestMessage) int
+
+// Strategy fits a conversation into a token budget.
+type Strategy interface {
+	// Fit returns the messages to send so that count(messages) <= budget. The history passed in only
+	// grows between calls, unless it is reset.
+	Fit(ctx context.Context, history []gpt.ChatCompletionRequestMessage, budget int, count CountFunc) ([]gpt.ChatCompletionRequestMessage, error)
+}
+
+// turns splits the non-system messages of history into turns, each starting at a user message. It
+// returns the index ranges [start, end) of the turns.
+func turns(history []gpt.ChatCompletionRequestMessage) [][2]int {
+	var result [][2]int
+	for i, msg := range history {
+		if msg.Role == RoleSystem {
+			continue
+		}
+		if msg.Role == RoleUser || len(result) == 0 {
+			result = append(result, [2]int{i, i + 1})
+			continue
+		}
+		result[len(result)-1][1] = i + 1
+	}
+	return result
+}
+
+// without returns history without the non-system messages before index from. System messages stay pinned
+// in place.
+func without(history []gpt.ChatCompletionRequestMessage, from int) []gpt.ChatCompletionRequestMessage {
+	messages := make([]gpt.ChatCompletionRequestMessage, 0, len(history))
+	for i, msg := range history {
+		if i >= from || msg.Role == RoleSystem {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// dropOldest removes the oldest turns until the history fits, always keeping the latest turn.
+func dropOldest(history []gpt.ChatCompletionRequestMessage, budget int, count CountFunc) ([]gpt.ChatCompletionRequestMessage, error) {
+	all := turns(history)
+	for i := 0; i < len(all); i++ {
+		messages := without(history, all[i][0])
+		if count(messages) <= budget {
+			return messages, nil
+		}
+	}
+	if len(all) == 0 && count(history) <= budget {
+		return history, nil
+	}
+	return nil, ErrContextWindowExceeded
+}
+
+// DropOldest returns a Strategy that drops the oldest turns first. System messages are never dropped.
+func DropOldest() Strategy {
+	return dropOldestStrategy{}
+}
+
+type dropOldestStrategy struct{}
+
+func (dropOldestStrategy) Fit(_ context.Context, history []gpt.ChatCompletionRequestMessage, budget int, count CountFunc) ([]gpt.ChatCompletionRequestMessage, error) {
+	return dropOldest(history, budget, count)
+}
+
+// SlidingWindow returns a Strategy that keeps at most the last n turns, dropping older ones even when
+// they would fit. System messages are never dropped.
+func SlidingWindow(n int) Strategy {
+	return slidingWindowStrategy(n)
+}
+
+type slidingWindowStrategy int
+
+func (s slidingWindowStrategy) Fit(_ context.Context, history []gpt.ChatCompletionRequestMessage, budget int, count CountFunc) ([]gpt.ChatCompletionRequestMessage, error) {
+	if all := turns(history); len(all) > int(s) && s > 0 {
+		history = without(history, all[len(all)-int(s)][0])
+	}
+	return dropOldest(history, budget, count)
+}
+
+// DefaultSummaryPrompt is the instruction used to summarize evicted turns.
+const DefaultSummaryPrompt = "Summarize the following conversation in a few sentences. Keep the facts, " +
+	"decisions and open questions needed to continue it."
+
+// summaryPrefix starts the system message carrying the summary.
+const summaryPrefix = "Summary of the earlier conversation: "
+
+// Summarizer is a Strategy that replaces turns that no longer fit with a summary produced by a secondary
+// chat completion. It keeps the summary between calls, so each Summarizer belongs to a single History.
+type Summarizer struct {
+	// Client is used for the summary requests
+	Client gpt.Client
+	// Model is the model used for summaries. Defaults to gpt-3.5-turbo.
+	Model string
+	// Prompt is the summarization instruction. Defaults to DefaultSummaryPrompt.
+	Prompt string
+	// MaxTokens limits the length of the summary. Defaults to 256.
+	MaxTokens int
+
+	// covered is the index in the history up to which non-system messages are summarized
+	covered int
+	summary string
+}
+
+// Summarize returns a Summarizer using client and model.
+func Summarize(client gpt.Client, model string) *Summarizer {
+	return &Summarizer{Client: client, Model: model}
+}
+
+// Fit implements Strategy.
+func (s *Summarizer) Fit(ctx context.Context, history []gpt.ChatCompletionRequestMessage, budget int, count CountFunc) ([]gpt.ChatCompletionRequestMessage, error) {
+	if s.covered > len(history) {
+		s.covered, s.summary = 0, ""
+	}
+	maxTokens := s.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 256
+	}
+	all := turns(history)
+	for _, turn := range all {
+		start := turn[0]
+		if start < s.covered {
+			continue
+		}
+		messages := s.withSummary(without(history, start), s.summary)
+		if count(messages) > budget {
+			continue
+		}
+		if evicted(history[s.covered:start]) {
+			summary, err := s.summarize(ctx, history[s.covered:start], maxTokens)
+			if err != nil {
+				return nil, err
+			}
+			s.covered, s.summary = start, summary
+			// the new summary may be longer, in which case the next turn is evicted as well
+			if messages = s.withSummary(without(history, start), s.summary); count(messages) > budget {
+				continue
+			}
+		}
+		return messages, nil
+	}
+	if len(all) == 0 && count(history) <= budget {
+		return history, nil
+	}
+	return nil, ErrContextWindowExceeded
+}
+
+// evicted reports whether messages has non-system messages, which are dropped from the history.
+func evicted(messages []gpt.ChatCompletionRequestMessage) bool {
+	for _, msg := range messages {
+		if msg.Role != RoleSystem {
+			return true
+		}
+	}
+	return false
+}
+
+// withSummary inserts the summary after the leading system messages.
+func (s *Summarizer) withSummary(messages []gpt.ChatCompletionRequestMessage, summary string) []gpt.ChatCompletionRequestMessage {
+	if summary == "" {
+		return messages
+	}
+	i := 0
+	for i < len(messages) && messages[i].Role == RoleSystem {
+		i++
+	}
+	result := make([]gpt.ChatCompletionRequestMessage, 0, len(messages)+1)
+	result = append(result, messages[:i]...)
+	result = append(result, gpt.ChatCompletionRequestMessage{Role: RoleSystem, Content: summaryPrefix + summary})
+	return append(result, messages[i:]...)
+}
+
+// summarize folds evicted messages into the running summary.
+func (s *Summarizer) summarize(ctx context.Context, evicted []gpt.ChatCompletionRequestMessage, maxTokens int) (string, error) {
+	var transcript strings.Builder
+	if s.summary != "" {
+		fmt.Fprintf(&transcript, "%s%s\n\n", summaryPrefix, s.summary)
+	}
+	for _, msg := range evicted {
+		if msg.Role == RoleSystem {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+	}
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	rsp, err := s.Client.ChatCompletion(ctx, &gpt.ChatCompletionRequest{
+		Model: s.Model,
+		Messages: []gpt.ChatCompletionRequestMessage{
+			{Role: RoleSystem, Content: prompt},
+			{Role: RoleUser, Content: transcript.String()},
+		},
+		MaxTokens: maxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(rsp.Choices) == 0 {
+		return s.summary, nil
+	}
+	return strings.TrimSpace(rsp.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,141 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialProvider supplies the bearer token sent with every API request. The client asks the
+// provider for a token each time it builds a request, so implementations are free to rotate keys.
+type CredentialProvider interface {
+	// Token returns the API key or token to use for the next request.
+	Token(ctx context.Context) (string, error)
+}
+
+// CredentialInvalidator is implemented by credential providers that cache their token. When the API
+// rejects a request with 401 the client calls Invalidate and retries the request once with a fresh token.
+type CredentialInvalidator interface {
+	Invalidate()
+}
+
+// ErrEmptyCredential is returned by the built-in providers when they resolve to an empty token.
+var ErrEmptyCredential = errors.New("empty api credential")
+
+// StaticCredential returns a CredentialProvider that always returns the given key.
+func StaticCredential(apiKey string) CredentialProvider {
+	return staticCredential(apiKey)
+}
+
+type staticCredential string
+
+func (s staticCredential) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// EnvCredential returns a CredentialProvider that reads the token from the named environment
+// variable on every request.
+func EnvCredential(name string) CredentialProvider {
+	return envCredential(name)
+}
+
+type envCredential string
+
+func (e envCredential) Token(context.Context) (string, error) {
+	token := strings.TrimSpace(os.Getenv(string(e)))
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s: %w", string(e), ErrEmptyCredential)
+	}
+	return token, nil
+}
+
+// FileCredential returns a CredentialProvider that reads the token from a file. The file is watched
+// for modifications and re-read whenever its size or modification time changes, which makes it
+// suitable for secrets mounted by an external manager.
+func FileCredential(path string) CredentialProvider {
+	return &fileCredential{path: path}
+}
+
+type fileCredential struct {
+	path    string
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func (f *fileCredential) Token(context.Context) (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat credential file: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("credential file %s: %w", f.path, ErrEmptyCredential)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return f.token, nil
+}
+
+// Invalidate forces the file to be re-read on the next call to Token.
+func (f *fileCredential) Invalidate() {
+	f.mu.Lock()
+	f.token = ""
+	f.mu.Unlock()
+}
+
+// RefreshFunc fetches a new token together with the time it expires. A zero expiry means the token
+// is valid until it is invalidated.
+type RefreshFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// CachedCredential returns a CredentialProvider that caches the token returned by refresh and calls
+// it again once the token is within leeway of its expiry, or after the API has rejected it.
+func CachedCredential(refresh RefreshFunc, leeway time.Duration) CredentialProvider {
+	return &cachedCredential{refresh: refresh, leeway: leeway}
+}
+
+type cachedCredential struct {
+	refresh RefreshFunc
+	leeway  time.Duration
+	mu      sync.Mutex
+	token   string
+	expiry  time.Time
+}
+
+func (c *cachedCredential) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Add(c.leeway).Before(c.expiry)) {
+		return c.token, nil
+	}
+	token, expiry, err := c.refresh(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh credential: %w", err)
+	}
+	if token == "" {
+		return "", ErrEmptyCredential
+	}
+	c.token, c.expiry = token, expiry
+	return c.token, nil
+}
+
+// Invalidate drops the cached token so the next call to Token refreshes it.
+func (c *cachedCredential) Invalidate() {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+}
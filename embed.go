@@ -0,0 +1,297 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Define EmbedAll defaults
+const (
+	DefaultEmbedBatchSize   = 2048   // DefaultEmbedBatchSize is the maximum number of inputs per request
+	DefaultEmbedBatchTokens = 300000 // DefaultEmbedBatchTokens is the maximum number of tokens per request
+	DefaultEmbedConcurrency = 4      // DefaultEmbedConcurrency is the number of requests in flight
+	DefaultEmbedRetries     = 2      // DefaultEmbedRetries is the number of times a failed batch is resent
+)
+
+// EmbedOptions configures EmbedAll. The zero value uses the defaults.
+type EmbedOptions struct {
+	// Model is ID of the model to use. Defaults to text-embedding-ada-002.
+	Model string
+	// User is sent with every request, see EmbeddingsRequest.User
+	User string
+	// EncodingFormat and Dimensions are sent with every request, see EmbeddingsRequest
+	EncodingFormat string
+	Dimensions     int
+	// BatchSize is the maximum number of inputs per request. Defaults to DefaultEmbedBatchSize.
+	BatchSize int
+	// BatchTokens is the maximum number of tokens per request, as counted by CountTokens.
+	// Defaults to DefaultEmbedBatchTokens.
+	BatchTokens int
+	// CountTokens counts the tokens of an input. The default is a heuristic of one token per three bytes,
+	// which overestimates English text; the tokenizer package gives exact counts.
+	CountTokens func(input string) int
+	// Concurrency is the number of requests in flight. Defaults to DefaultEmbedConcurrency.
+	Concurrency int
+	// Retries is the number of times a batch that failed with a retryable error is resent.
+	// Defaults to DefaultEmbedRetries; use a negative value to disable retries.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for every further retry. Defaults to 500ms.
+	Backoff time.Duration
+}
+
+func (o EmbedOptions) withDefaults() EmbedOptions {
+	if o.Model == "" {
+		o.Model = TextEmbeddingAda002
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultEmbedBatchSize
+	}
+	if o.BatchTokens <= 0 {
+		o.BatchTokens = DefaultEmbedBatchTokens
+	}
+	if o.CountTokens == nil {
+		o.CountTokens = func(input string) int { return len(input)/3 + 1 }
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultEmbedConcurrency
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultEmbedRetries
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 500 * time.Millisecond
+	}
+	return o
+}
+
+// embedBatch is a range [start, end) of the inputs sent in one request.
+type embedBatch struct {
+	start, end int
+}
+
+// embedBatches splits inputs into batches within the size and token limits. An input over the token
+// limit is sent on its own.
+func embedBatches(inputs []string, opts EmbedOptions) []embedBatch {
+	var batches []embedBatch
+	start, tokens := 0, 0
+	for i, input := range inputs {
+		n := opts.CountTokens(input)
+		if i > start && (i-start >= opts.BatchSize || tokens+n > opts.BatchTokens) {
+			batches = append(batches, embedBatch{start, i})
+			start, tokens = i, 0
+		}
+		tokens += n
+	}
+	if start < len(inputs) {
+		batches = append(batches, embedBatch{start, len(inputs)})
+	}
+	return batches
+}
+
+// EmbedAll creates embeddings for any number of inputs. The inputs are split into batches by count and
+// token budget, the batches are sent concurrently and failed batches are retried. The results are in
+// the order of inputs, with Index set to the position in inputs, and Usage is the sum over all
+// requests. The first batch that fails for good cancels the others and its error is returned.
+func EmbedAll(ctx context.Context, client Client, inputs []string, opts EmbedOptions) (*EmbeddingsResponse, error) {
+	opts = opts.withDefaults()
+	output := &EmbeddingsResponse{Object: "list", Data: make([]EmbeddingsResult, len(inputs))}
+	if len(inputs) == 0 {
+		return output, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, opts.Concurrency)
+	)
+	for _, batch := range embedBatches(inputs, opts) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(batch embedBatch) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rsp, err := embedWithRetry(ctx, client, &EmbeddingsRequest{
+				Input:          inputs[batch.start:batch.end],
+				Model:          opts.Model,
+				EncodingFormat: opts.EncodingFormat,
+				Dimensions:     opts.Dimensions,
+				User:           opts.User,
+			}, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				err = checkIndexes(rsp.Data, batch.end-batch.start)
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to embed inputs %d to %d: %w", batch.start, batch.end-1, err)
+					cancel()
+				}
+				return
+			}
+			for _, result := range rsp.Data {
+				result.Index += batch.start
+				output.Data[result.Index] = result
+			}
+			output.Usage.PromptTokens += rsp.Usage.PromptTokens
+			output.Usage.TotalTokens += rsp.Usage.TotalTokens
+		}(batch)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// checkIndexes checks that the results of a request for n inputs have each index from 0 to n-1 once.
+func checkIndexes(results []EmbeddingsResult, n int) error {
+	if len(results) != n {
+		return fmt.Errorf("embeddings response has %d results for %d inputs", len(results), n)
+	}
+	seen := make([]bool, n)
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= n {
+			return fmt.Errorf("embeddings response has index %d for %d inputs", result.Index, n)
+		}
+		if seen[result.Index] {
+			return fmt.Errorf("embeddings response has index %d twice", result.Index)
+		}
+		seen[result.Index] = true
+	}
+	return nil
+}
+
+// embedWithRetry sends a request, resending it with exponential backoff while it fails with a retryable
+// error.
+func embedWithRetry(ctx context.Context, client Client, request *EmbeddingsRequest, opts EmbedOptions) (*EmbeddingsResponse, error) {
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		rsp, err := client.Embeddings(ctx, request)
+		if err == nil || attempt >= opts.Retries || !IsRetryable(err) {
+			return rsp, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// Float32 returns the embedding as float32s. For embeddings requested with EmbeddingEncodingBase64 this
+// is the decoded vector itself; otherwise Embedding is converted on every call.
+func (r EmbeddingsResult) Float32() []float32 {
+	if r.embedding32 != nil || r.Embedding == nil {
+		return r.embedding32
+	}
+	v := make([]float32, len(r.Embedding))
+	for i, x := range r.Embedding {
+		v[i] = float32(x)
+	}
+	return v
+}
+
+// Float64 returns the embedding as float64s, converting the vector of a base64 encoded embedding.
+func (r EmbeddingsResult) Float64() []float64 {
+	if r.Embedding != nil || r.embedding32 == nil {
+		return r.Embedding
+	}
+	v := make([]float64, len(r.embedding32))
+	for i, x := range r.embedding32 {
+		v[i] = float64(x)
+	}
+	return v
+}
+
+// embeddingsResultJSON is the wire format of EmbeddingsResult, whose embedding is either an array of
+// numbers or a base64 string.
+type embeddingsResultJSON struct {
+	Object    string          `json:"object"`
+	Embedding json.RawMessage `json:"embedding"`
+	Index     int             `json:"index"`
+}
+
+// UnmarshalJSON decodes an embedding in either encoding format.
+func (r *EmbeddingsResult) UnmarshalJSON(data []byte) error {
+	var raw embeddingsResultJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = EmbeddingsResult{Object: raw.Object, Index: raw.Index}
+	if len(raw.Embedding) > 0 && raw.Embedding[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(raw.Embedding, &encoded); err != nil {
+			return err
+		}
+		v, err := DecodeEmbeddingBase64(encoded)
+		if err != nil {
+			return err
+		}
+		r.embedding32 = v
+		return nil
+	}
+	return json.Unmarshal(raw.Embedding, &r.Embedding)
+}
+
+// MarshalJSON encodes a base64 encoded embedding back to base64, so it survives a round trip.
+func (r EmbeddingsResult) MarshalJSON() ([]byte, error) {
+	raw := embeddingsResultJSON{Object: r.Object, Index: r.Index}
+	var err error
+	if r.Embedding == nil && r.embedding32 != nil {
+		raw.Embedding, err = json.Marshal(EncodeEmbeddingBase64(r.embedding32))
+	} else {
+		raw.Embedding, err = json.Marshal(r.Embedding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(raw)
+}
+
+// DecodeEmbeddingBase64 decodes an embedding returned with EmbeddingEncodingBase64.
+func DecodeEmbeddingBase64(encoded string) ([]float32, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 embedding: %w", err)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid base64 embedding: %d bytes is not a multiple of 4", len(data))
+	}
+	v := make([]float32, len(data)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return v, nil
+}
+
+// EncodeEmbeddingBase64 encodes an embedding the way the API does for EmbeddingEncodingBase64.
+func EncodeEmbeddingBase64(v []float32) string {
+	data := make([]byte, len(v)*4)
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,217 @@
+package gpt_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+// embeddingsResponse answers an embeddings request with the default vectors of its inputs, listed in
+// the given order of their indexes.
+func embeddingsResponse(t *testing.T, req gpttest.Request, order func(n int) []int) gpttest.Response {
+	var request gpt.EmbeddingsRequest
+	if err := req.Decode(&request); err != nil {
+		t.Error(err)
+	}
+	indexes := order(len(request.Input))
+	data := make([]map[string]interface{}, len(indexes))
+	for i, index := range indexes {
+		input := ""
+		if index >= 0 && index < len(request.Input) {
+			input = request.Input[index]
+		}
+		data[i] = map[string]interface{}{"object": "embedding", "embedding": gpttest.Embedding(input), "index": index}
+	}
+	return gpttest.Response{Body: map[string]interface{}{
+		"object": "list", "data": data, "usage": gpt.EmbeddingsUsage{PromptTokens: len(indexes), TotalTokens: len(indexes)},
+	}}
+}
+
+func reversed(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = n - 1 - i
+	}
+	return indexes
+}
+
+func TestEmbedAllOrdersResults(t *testing.T) {
+	inputs := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff", "g"}
+	tests := []struct {
+		name     string
+		opts     gpt.EmbedOptions
+		requests int
+	}{
+		{"one batch", gpt.EmbedOptions{}, 1},
+		{"batch size", gpt.EmbedOptions{BatchSize: 2, Concurrency: 3}, 4},
+		{"batch tokens", gpt.EmbedOptions{BatchTokens: 10, CountTokens: func(input string) int { return len(input) }, Concurrency: 2}, 3},
+		{"input over the token limit", gpt.EmbedOptions{BatchTokens: 1, CountTokens: func(input string) int { return len(input) }}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Handle(gpttest.EndpointEmbeddings, func(req gpttest.Request) gpttest.Response {
+				rsp := embeddingsResponse(t, req, reversed)
+				// the first batch finishes last
+				if strings.Contains(string(req.Body), `"a"`) {
+					rsp.Delay = 20 * time.Millisecond
+				}
+				return rsp
+			})
+			rsp, err := gpt.EmbedAll(context.Background(), server.Client(), inputs, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.AssertCalled(t, gpttest.EndpointEmbeddings, tt.requests)
+			if len(rsp.Data) != len(inputs) {
+				t.Fatalf("%d results for %d inputs", len(rsp.Data), len(inputs))
+			}
+			for i, result := range rsp.Data {
+				if result.Index != i || !reflect.DeepEqual(result.Float64(), gpttest.Embedding(inputs[i])) {
+					t.Errorf("result %d has index %d and the embedding of another input", i, result.Index)
+				}
+			}
+			if rsp.Usage.PromptTokens != len(inputs) || rsp.Usage.TotalTokens != len(inputs) {
+				t.Errorf("usage %+v, want the sum over the batches", rsp.Usage)
+			}
+		})
+	}
+}
+
+func TestEmbedAllRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []gpttest.Response
+		retries  int
+		calls    int
+		fails    bool
+	}{
+		{"retryable error", []gpttest.Response{gpttest.RateLimited(0)}, 0, 2, false},
+		{"until retries run out", []gpttest.Response{gpttest.RateLimited(0), gpttest.RateLimited(0), gpttest.RateLimited(0)}, 0, 3, true},
+		{"more retries", []gpttest.Response{gpttest.RateLimited(0), gpttest.RateLimited(0), gpttest.RateLimited(0)}, 3, 4, false},
+		{"retries disabled", []gpttest.Response{gpttest.RateLimited(0)}, -1, 1, true},
+		{"error that isn't retryable", []gpttest.Response{gpttest.ErrorResponse(http.StatusBadRequest, "invalid_request_error", "bad")}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Enqueue(gpttest.EndpointEmbeddings, tt.failures...)
+			opts := gpt.EmbedOptions{Retries: tt.retries, Backoff: time.Millisecond}
+			_, err := gpt.EmbedAll(context.Background(), server.Client(), []string{"a", "b"}, opts)
+			if (err != nil) != tt.fails {
+				t.Errorf("error %v, want failure %v", err, tt.fails)
+			}
+			server.AssertCalled(t, gpttest.EndpointEmbeddings, tt.calls)
+		})
+	}
+}
+
+func TestEmbedAllChecksIndexes(t *testing.T) {
+	tests := []struct {
+		name  string
+		order func(n int) []int
+		want  string
+	}{
+		{"index out of range", func(n int) []int { return []int{0, n} }, "index 2 for 2 inputs"},
+		{"negative index", func(n int) []int { return []int{-1, 1} }, "index -1 for 2 inputs"},
+		{"duplicate index", func(n int) []int { return []int{1, 1} }, "index 1 twice"},
+		{"missing result", func(n int) []int { return []int{0} }, "1 results for 2 inputs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Handle(gpttest.EndpointEmbeddings, func(req gpttest.Request) gpttest.Response {
+				return embeddingsResponse(t, req, tt.order)
+			})
+			opts := gpt.EmbedOptions{BatchSize: 2}
+			_, err := gpt.EmbedAll(context.Background(), server.Client(), []string{"a", "b", "c", "d"}, opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+func TestEmbeddingsResultJSON(t *testing.T) {
+	vector := []float32{0.5, -1.25, 3}
+	tests := []struct {
+		name, json string
+		dimensions int
+	}{
+		{"floats", `{"object":"embedding","embedding":[0.5,-1.25,3],"index":2}`, 3},
+		{"base64", fmt.Sprintf(`{"object":"embedding","embedding":%q,"index":2}`, gpt.EncodeEmbeddingBase64(vector)), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result gpt.EmbeddingsResult
+			if err := json.Unmarshal([]byte(tt.json), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Index != 2 || !reflect.DeepEqual(result.Float32(), vector) || len(result.Float64()) != tt.dimensions {
+				t.Errorf("decoded %+v, want index 2 and %v", result, vector)
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("encoded %s, want %s", data, tt.json)
+			}
+		})
+	}
+	var result gpt.EmbeddingsResult
+	if err := json.Unmarshal([]byte(`{"embedding":"AAA="}`), &result); err == nil {
+		t.Error("decoded base64 that isn't a multiple of 4 bytes")
+	}
+}
+
+func TestEmbeddingsDimensionsAndEncoding(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		dimensions int
+		want       int
+	}{
+		{"default", "", 0, gpttest.EmbeddingDimensions},
+		{"floats with dimensions", gpt.EmbeddingEncodingFloat, 4, 4},
+		{"base64", gpt.EmbeddingEncodingBase64, 0, gpttest.EmbeddingDimensions},
+		{"base64 with dimensions", gpt.EmbeddingEncodingBase64, 8, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			opts := gpt.EmbedOptions{EncodingFormat: tt.format, Dimensions: tt.dimensions, BatchSize: 1}
+			rsp, err := gpt.EmbedAll(context.Background(), server.Client(), []string{"a", "b"}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var request gpt.EmbeddingsRequest
+			if req, _ := server.LastRequest(gpttest.EndpointEmbeddings); req.Decode(&request) != nil ||
+				request.EncodingFormat != tt.format || request.Dimensions != tt.dimensions {
+				t.Errorf("request %+v, want encoding format %q and %d dimensions", request, tt.format, tt.dimensions)
+			}
+			for i, result := range rsp.Data {
+				want := gpttest.EmbeddingWithDimensions([]string{"a", "b"}[i], tt.dimensions)
+				if len(want) != tt.want || len(result.Float32()) != tt.want {
+					t.Fatalf("result %d has %d dimensions, want %d", i, len(result.Float32()), tt.want)
+				}
+				if base64 := tt.format == gpt.EmbeddingEncodingBase64; (result.Embedding == nil) != base64 {
+					t.Errorf("result %d has float64 embedding %v, want base64 %v", i, result.Embedding, base64)
+				}
+				for j, v := range result.Float64() {
+					if float32(v) != float32(want[j]) {
+						t.Errorf("result %d is %v, want %v", i, result.Float64(), want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// IsRetryable reports whether a request that failed with err may succeed if it is sent again: network
+// errors and timeouts, rate limits other than an exhausted quota, and server side errors are retryable,
+// while invalid requests, authentication failures and cancellations are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return apiErr.Type != insufficientQuotaType
+		case apiErr.StatusCode == http.StatusRequestTimeout:
+			return true
+		default:
+			return apiErr.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/spf13/cobra"
+)
+
+// editModel is the model of the edit command.
+const editModel = "text-davinci-edit-001"
+
+// interruptible returns the context of a command, canceled by Ctrl-C.
+func interruptible(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(cmd.Context(), os.Interrupt)
+}
+
+// readInputs returns the non-empty lines of a file, or of the text piped to in for "-" or no file.
+func readInputs(file string, in io.Reader) ([]string, error) {
+	if file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		defer f.Close()
+		in = f
+	} else if in = piped(in); in == nil {
+		return nil, nil
+	}
+	var inputs []string
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return inputs, nil
+}
+
+// preview returns text on a single line, cut to n characters.
+func preview(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n-1]) + "…"
+}
+
+func newModelsCmd(opts *options) *cobra.Command {
+	var out *output
+	cmd := &cobra.Command{
+		Use:   "models [MODEL]",
+		Short: "List the available models, or show one.",
+		Example: `  chatgpt models
+  chatgpt models gpt-4o --format json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			var engines []gpt.EngineObject
+			var rsp interface{}
+			if len(args) == 1 {
+				engine, err := client.Engine(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				engines, rsp = []gpt.EngineObject{*engine}, engine
+			} else {
+				list, err := client.Engines(ctx)
+				if err != nil {
+					return err
+				}
+				engines, rsp = list.Data, list
+				sort.Slice(engines, func(i, j int) bool { return engines[i].ID < engines[j].ID })
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				if out.format == formatJSON {
+					return writeJSON(w, rsp)
+				}
+				tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "MODEL\tOWNER\tREADY")
+				for _, e := range engines {
+					fmt.Fprintf(tw, "%s\t%s\t%t\n", e.ID, e.Owner, e.Ready)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+	out = addOutputFlags(cmd, formatText, formatJSON)
+	return cmd
+}
+
+func newEmbedCmd(opts *options) *cobra.Command {
+	var (
+		out        *output
+		inputFile  string
+		dimensions int
+	)
+	cmd := &cobra.Command{
+		Use:   "embed [TEXT...]",
+		Short: "Create embeddings of texts.",
+		Long: "Create embeddings of texts. Every argument is embedded, or every line of the input file or of the " +
+			"text piped to standard input. The model is " + gpt.TextEmbedding3Small + " unless --model is given.",
+		Example: `  chatgpt embed "first text" "second text"
+  chatgpt embed -i lines.txt -f npy -o vectors.npy
+  cat lines.txt | chatgpt embed -f csv --dimensions 256`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			inputs := args
+			if len(inputs) == 0 || inputFile != "" {
+				lines, err := readInputs(inputFile, cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				inputs = append(inputs, lines...)
+			}
+			if len(inputs) == 0 {
+				return usageError{errors.New("no text given, pass it as arguments, with --input or on standard input")}
+			}
+			if out.format == formatNpy && (out.path == "" || out.path == "-") && isTerminal(cmd.OutOrStdout()) {
+				return usageError{errors.New("npy is a binary format, write it to a file with --output")}
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			rsp, err := client.Embeddings(ctx, &gpt.EmbeddingsRequest{
+				Input:      inputs,
+				Model:      opts.modelFor(cmd, gpt.TextEmbedding3Small),
+				Dimensions: dimensions,
+			})
+			if err != nil {
+				return err
+			}
+			vectors := make([][]float32, len(inputs))
+			for _, result := range rsp.Data {
+				if result.Index >= 0 && result.Index < len(vectors) {
+					vectors[result.Index] = result.Float32()
+				}
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				switch out.format {
+				case formatCSV:
+					return writeCSV(w, inputs, vectors)
+				case formatNpy:
+					return writeNpy(w, vectors)
+				}
+				return writeJSON(w, rsp)
+			})
+		},
+	}
+	out = addOutputFlags(cmd, formatJSON, formatCSV, formatNpy)
+	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "file with a text to embed on every line, - for standard input")
+	cmd.Flags().IntVar(&dimensions, "dimensions", 0, "dimensions of the embeddings, 0 for the model default")
+	return cmd
+}
+
+func newImageCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Generate images.",
+	}
+	var (
+		out    *output
+		n      int
+		size   string
+		dir    string
+		prefix string
+	)
+	generate := &cobra.Command{
+		Use:   "generate PROMPT...",
+		Short: "Generate images from a prompt and save them.",
+		Long: "Generate images from a prompt and save them as PNG files in the output directory, " +
+			"printing their paths.",
+		Example: `  chatgpt image generate "a gopher reading a book"
+  chatgpt image generate -n 2 --size 512x512 --dir out "a watercolor lighthouse"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			rsp, err := client.Image(ctx, &gpt.ImageRequest{
+				Prompt:         strings.Join(args, " "),
+				N:              n,
+				Size:           size,
+				ResponseFormat: gpt.CreateImageResponseFormatB64JSON,
+			})
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to save images: %w", err)
+			}
+			type savedImage struct {
+				File string `json:"file"`
+				URL  string `json:"url,omitempty"`
+			}
+			saved := make([]savedImage, 0, len(rsp.Data))
+			for i, image := range rsp.Data {
+				path := filepath.Join(dir, fmt.Sprintf("%s-%d-%d.png", prefix, rsp.Created, i+1))
+				if err := saveImage(ctx, path, image); err != nil {
+					return err
+				}
+				saved = append(saved, savedImage{File: path, URL: image.URL})
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				if out.format == formatJSON {
+					return writeJSON(w, saved)
+				}
+				for _, image := range saved {
+					fmt.Fprintln(w, image.File)
+				}
+				return nil
+			})
+		},
+	}
+	out = addOutputFlags(generate, formatText, formatJSON)
+	generate.Flags().IntVarP(&n, "count", "n", 1, "number of images")
+	generate.Flags().StringVar(&size, "size", gpt.CreateImageSize1024x1024, "size of the images: 256x256, 512x512 or 1024x1024")
+	generate.Flags().StringVar(&dir, "dir", ".", "directory to save the images in")
+	generate.Flags().StringVar(&prefix, "prefix", "image", "beginning of the image file names")
+	cmd.AddCommand(generate)
+	return cmd
+}
+
+// saveImage writes an image of a response to path, downloading it if the response has its URL only.
+func saveImage(ctx context.Context, path string, image gpt.ImageResponseDataInner) error {
+	var data []byte
+	switch {
+	case image.B64JSON != "":
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(image.B64JSON); err != nil {
+			return fmt.Errorf("failed to decode image: %w", err)
+		}
+	case image.URL != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, image.URL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to download image: %w", err)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to download image: %w", err)
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to download image: %s", rsp.Status)
+		}
+		if data, err = io.ReadAll(rsp.Body); err != nil {
+			return fmt.Errorf("failed to download image: %w", err)
+		}
+	default:
+		return errors.New("response has no image data")
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	return nil
+}
+
+func newEditCmd(opts *options) *cobra.Command {
+	var (
+		out       *output
+		inputFile string
+	)
+	cmd := &cobra.Command{
+		Use:   "edit INSTRUCTION...",
+		Short: "Edit a text following an instruction.",
+		Long: "Edit the text of the input file, or piped to standard input, following an instruction. " +
+			"The model is " + editModel + " unless --model is given.",
+		Example: `  chatgpt edit "Fix the spelling mistakes" -i draft.txt
+  echo "teh quick brwon fox" | chatgpt edit "Fix the spelling mistakes"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			var in io.Reader
+			if inputFile != "" && inputFile != "-" {
+				f, err := os.Open(inputFile)
+				if err != nil {
+					return fmt.Errorf("failed to read input: %w", err)
+				}
+				defer f.Close()
+				in = f
+			} else if in = piped(cmd.InOrStdin()); in == nil {
+				return usageError{errors.New("no text to edit given, pass it with --input or on standard input")}
+			}
+			input, err := io.ReadAll(in)
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			request := &gpt.EditsRequest{
+				Model:       opts.modelFor(cmd, editModel),
+				Input:       string(input),
+				Instruction: strings.Join(args, " "),
+			}
+			if cmd.Flags().Changed("temperature") {
+				request.Temperature = &opts.temperature
+			}
+			rsp, err := client.Edits(ctx, request)
+			if err != nil {
+				return err
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				if out.format == formatJSON {
+					return writeJSON(w, rsp)
+				}
+				if len(rsp.Choices) > 0 {
+					fmt.Fprintln(w, strings.TrimRight(rsp.Choices[0].Text, "\n"))
+				}
+				return nil
+			})
+		},
+	}
+	out = addOutputFlags(cmd, formatText, formatJSON)
+	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "file with the text to edit, - for standard input")
+	return cmd
+}
+
+func newModerateCmd(opts *options) *cobra.Command {
+	var out *output
+	cmd := &cobra.Command{
+		Use:   "moderate [TEXT...]",
+		Short: "Check whether texts violate the usage policies.",
+		Long: "Check whether texts violate the usage policies. Every argument is checked, or the text piped " +
+			"to standard input as a whole.",
+		Example: `  chatgpt moderate "some text" "another text"
+  chatgpt moderate --format json < comment.txt`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			inputs := args
+			if in := piped(cmd.InOrStdin()); len(inputs) == 0 && in != nil {
+				input, err := io.ReadAll(in)
+				if err != nil {
+					return fmt.Errorf("failed to read input: %w", err)
+				}
+				if text := strings.TrimSpace(string(input)); text != "" {
+					inputs = []string{text}
+				}
+			}
+			if len(inputs) == 0 {
+				return usageError{errors.New("no text given, pass it as arguments or on standard input")}
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			rsp, err := client.Moderation(ctx, &gpt.ModerationRequest{Input: inputs, Model: opts.modelFor(cmd, "")})
+			if err != nil {
+				return err
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				if out.format == formatJSON {
+					return writeJSON(w, rsp)
+				}
+				tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "FLAGGED\tCATEGORIES\tINPUT")
+				for i, result := range rsp.Results {
+					var categories []string
+					for category, flagged := range result.Categories {
+						if flagged {
+							categories = append(categories, category)
+						}
+					}
+					sort.Strings(categories)
+					flagged, list := "no", "-"
+					if result.Flagged {
+						flagged = "yes"
+					}
+					if len(categories) > 0 {
+						list = strings.Join(categories, ", ")
+					}
+					input := ""
+					if i < len(inputs) {
+						input = preview(inputs[i], 50)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", flagged, list, input)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+	out = addOutputFlags(cmd, formatText, formatJSON)
+	return cmd
+}
+
+func newTranscribeCmd(opts *options) *cobra.Command {
+	var (
+		out      *output
+		language string
+		prompt   string
+	)
+	cmd := &cobra.Command{
+		Use:   "transcribe FILE",
+		Short: "Transcribe an audio file.",
+		Long: "Transcribe an audio file, such as mp3, mp4, m4a, wav or webm. The model is " + gpt.Whisper1 +
+			" unless --model is given.",
+		Example: `  chatgpt transcribe meeting.m4a
+  chatgpt transcribe talk.mp3 --language en --format srt -o talk.srt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := out.validate(); err != nil {
+				return err
+			}
+			audio, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read audio: %w", err)
+			}
+			defer audio.Close()
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			request := &gpt.TranscriptionRequest{
+				Audio:          audio,
+				FileName:       filepath.Base(args[0]),
+				Model:          opts.modelFor(cmd, gpt.Whisper1),
+				Language:       language,
+				Prompt:         prompt,
+				ResponseFormat: out.format,
+			}
+			if out.format == formatText {
+				request.ResponseFormat = gpt.TranscriptionFormatText
+			}
+			if cmd.Flags().Changed("temperature") {
+				request.Temperature = opts.temperature
+			}
+			rsp, err := client.Transcription(ctx, request)
+			if err != nil {
+				return err
+			}
+			return out.write(cmd, func(w io.Writer) error {
+				switch out.format {
+				case gpt.TranscriptionFormatJSON, gpt.TranscriptionFormatVerboseJSON:
+					return writeJSON(w, rsp)
+				}
+				_, err := io.WriteString(w, rsp.Text)
+				if err == nil && !strings.HasSuffix(rsp.Text, "\n") {
+					_, err = io.WriteString(w, "\n")
+				}
+				return err
+			})
+		},
+	}
+	out = addOutputFlags(cmd, formatText, gpt.TranscriptionFormatJSON, gpt.TranscriptionFormatVerboseJSON,
+		gpt.TranscriptionFormatSRT, gpt.TranscriptionFormatVTT)
+	cmd.Flags().StringVar(&language, "language", "", "ISO-639-1 language of the audio, detected if empty")
+	cmd.Flags().StringVar(&prompt, "prompt", "", "text to guide the style of the transcript")
+	return cmd
+}
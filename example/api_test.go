@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+func TestReadInputs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "inputs.txt")
+	if err := os.WriteFile(file, []byte("from the file\n\n  second line  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file string
+		in         string
+		want       []string
+	}{
+		{"file", file, "ignored", []string{"from the file", "second line"}},
+		{"piped", "", "a\n\n b \nc", []string{"a", "b", "c"}},
+		{"dash reads the pipe", "-", "a\n", []string{"a"}},
+		{"nothing piped", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readInputs(tt.file, strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("inputs %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := readInputs(filepath.Join(t.TempDir(), "missing.txt"), nil); err == nil {
+		t.Error("read a missing file without error")
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(png)
+	}))
+	defer server.Close()
+	tests := []struct {
+		name  string
+		image gpt.ImageResponseDataInner
+		fails bool
+	}{
+		{"base64", gpt.ImageResponseDataInner{B64JSON: base64.StdEncoding.EncodeToString(png)}, false},
+		{"url", gpt.ImageResponseDataInner{URL: server.URL + "/image.png"}, false},
+		{"invalid base64", gpt.ImageResponseDataInner{B64JSON: "not base64!"}, true},
+		{"url not found", gpt.ImageResponseDataInner{URL: server.URL + "/missing.png"}, true},
+		{"no image data", gpt.ImageResponseDataInner{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.png")
+			err := saveImage(context.Background(), path, tt.image)
+			if (err != nil) != tt.fails {
+				t.Fatalf("error %v, want failure %v", err, tt.fails)
+			}
+			data, readErr := os.ReadFile(path)
+			if tt.fails {
+				if readErr == nil {
+					t.Error("saved a file for a failed image")
+				}
+				return
+			}
+			if !bytes.Equal(data, png) {
+				t.Errorf("saved %q, want %q", data, png)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/spf13/cobra"
+)
+
+func newAskCmd(opts *options) *cobra.Command {
+	var jsonOutput, buffered bool
+	cmd := &cobra.Command{
+		Use:   "ask [QUESTION...]",
+		Short: "Ask a single question and print the answer.",
+		Long: "Ask a single question and print the answer. Text piped to standard input is sent after the " +
+			"question, or as the question when none is given.\n\n" + exitCodesHelp,
+		Example: `  chatgpt ask "What is a goroutine?"
+  git diff | chatgpt ask "Review this change"
+  chatgpt ask --json "Say hi" | jq .usage`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := askContent(strings.Join(args, " "), cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			request := opts.request()
+			if opts.system != "" {
+				request.Messages = append(request.Messages, gpt.ChatCompletionRequestMessage{Role: "system", Content: opts.system})
+			}
+			request.Messages = append(request.Messages, gpt.ChatCompletionRequestMessage{Role: "user", Content: content})
+			out := cmd.OutOrStdout()
+			if jsonOutput || buffered {
+				rsp, err := client.ChatCompletion(ctx, &request)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return writeJSON(out, rsp)
+				}
+				if len(rsp.Choices) > 0 {
+					w := newAnswerWriter(out, opts.raw)
+					fmt.Fprintln(w, strings.TrimRight(rsp.Choices[0].Message.Content, "\n"))
+					return w.Flush()
+				}
+				return nil
+			}
+			w := newAnswerWriter(out, opts.raw)
+			ended := true
+			err = client.ChatCompletionStream(ctx, &request, func(rsp *gpt.ChatCompletionStreamResponse) {
+				if len(rsp.Choices) > 0 && rsp.Choices[0].Delta.Content != "" {
+					text := rsp.Choices[0].Delta.Content
+					fmt.Fprint(w, text)
+					ended = strings.HasSuffix(text, "\n")
+				}
+			})
+			if flushErr := w.Flush(); err == nil {
+				err = flushErr
+			}
+			if !ended {
+				fmt.Fprintln(out)
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "print the raw chat completion response as JSON")
+	cmd.Flags().BoolVar(&buffered, "no-stream", false, "print the answer when it is complete instead of while it is written")
+	return cmd
+}
+
+// piped returns in, or nil if it is a terminal.
+func piped(in io.Reader) io.Reader {
+	if f, ok := in.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return nil
+		}
+	}
+	return in
+}
+
+// askContent returns the question followed by the text piped to in. Nothing is read from a terminal.
+func askContent(question string, in io.Reader) (string, error) {
+	in = piped(in)
+	var input string
+	if in != nil {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return "", fmt.Errorf("failed to read standard input: %w", err)
+		}
+		input = strings.TrimSpace(string(data))
+	}
+	question = strings.TrimSpace(question)
+	switch {
+	case question == "" && input == "":
+		return "", usageError{errors.New("no question given, pass it as argument or on standard input")}
+	case input == "":
+		return question, nil
+	case question == "":
+		return input, nil
+	}
+	return question + "\n\n" + input, nil
+}
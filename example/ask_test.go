@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// failingReader fails every read.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestAskContent(t *testing.T) {
+	tests := []struct {
+		name, question string
+		in             io.Reader
+		want           string
+		usage          bool
+	}{
+		{"question only", "What is Go?", strings.NewReader(""), "What is Go?", false},
+		{"question with spaces", " What is Go? ", strings.NewReader(""), "What is Go?", false},
+		{"piped only", "", strings.NewReader("  explain this  \n"), "explain this", false},
+		{"question and piped text", "Summarize:", strings.NewReader("line one\nline two\n"), "Summarize:\n\nline one\nline two", false},
+		{"blank pipe", "Why?", strings.NewReader(" \n\n"), "Why?", false},
+		{"nothing at all", "  ", strings.NewReader("\n"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := askContent(tt.question, tt.in)
+			if tt.usage {
+				if !errors.As(err, &usageError{}) {
+					t.Errorf("error %v, want a usage error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("content %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := askContent("q", failingReader{}); err == nil || exitCode(err) != exitError {
+		t.Errorf("error %v reading the pipe, want a failure with exit code 1", err)
+	}
+}
+
+func TestAskContentReadsPipes(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		_, _ = io.WriteString(w, "piped text\n")
+		w.Close()
+	}()
+	got, err := askContent("Translate:", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Translate:\n\npiped text" {
+		t.Errorf("content %q, want the question and the piped text", got)
+	}
+}
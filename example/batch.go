@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+	"github.com/spf13/cobra"
+)
+
+// Endpoints a batch request can be sent to.
+const (
+	batchChat        = "/v1/chat/completions"
+	batchCompletions = "/v1/completions"
+	batchEmbeddings  = "/v1/embeddings"
+)
+
+// batchRequest is a line of a batch file, in the format of the OpenAI Batch API. A line holding only a
+// request body is accepted too; its endpoint is told from its fields.
+type batchRequest struct {
+	CustomID string          `json:"custom_id,omitempty"`
+	Method   string          `json:"method,omitempty"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+
+	line int
+}
+
+// key identifies the request in the results: its custom_id, or its line number.
+func (r *batchRequest) key() string {
+	if r.CustomID != "" {
+		return r.CustomID
+	}
+	return fmt.Sprintf("line %d", r.line)
+}
+
+// batchResult is a line of the results file.
+type batchResult struct {
+	Line     int             `json:"line"`
+	CustomID string          `json:"custom_id,omitempty"`
+	URL      string          `json:"url"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    *gpt.APIError   `json:"error,omitempty"`
+}
+
+func (r *batchResult) key() string {
+	return (&batchRequest{CustomID: r.CustomID, line: r.Line}).key()
+}
+
+// readBatch reads the requests of a batch file, one JSON object per line. Blank lines are skipped but
+// counted, so line numbers match the file.
+func readBatch(r io.Reader) ([]*batchRequest, error) {
+	var requests []*batchRequest
+	lines := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		req, err := parseBatchLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		req.line = n
+		if prev, ok := lines[req.key()]; ok {
+			return nil, fmt.Errorf("line %d: custom_id %q is already used on line %d", n, req.CustomID, prev)
+		}
+		lines[req.key()] = n
+		requests = append(requests, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch: %w", err)
+	}
+	return requests, nil
+}
+
+func parseBatchLine(line []byte) (*batchRequest, error) {
+	req := &batchRequest{}
+	if err := json.Unmarshal(line, req); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if req.Method != "" && !strings.EqualFold(req.Method, "POST") {
+		return nil, fmt.Errorf("unsupported method %s", req.Method)
+	}
+	var fields map[string]json.RawMessage
+	if len(req.Body) == 0 {
+		// a bare request body
+		req.Body = line
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		switch {
+		case fields["messages"] != nil:
+			req.URL = batchChat
+		case fields["prompt"] != nil:
+			req.URL = batchCompletions
+		case fields["input"] != nil:
+			req.URL = batchEmbeddings
+		}
+	}
+	if req.URL != "" && !strings.HasPrefix(req.URL, "/v1/") {
+		req.URL = "/v1" + req.URL
+	}
+	switch req.URL {
+	case batchChat, batchCompletions, batchEmbeddings:
+	case "":
+		return nil, errors.New("unknown request, give the url or the messages, prompt or input of the request")
+	default:
+		return nil, fmt.Errorf("unsupported url %s, use %s, %s or %s", req.URL, batchChat, batchCompletions, batchEmbeddings)
+	}
+	return req, nil
+}
+
+// decodeBody decodes the body of a request. The prompt and input of completions and embeddings may be a
+// single string, which is what the API accepts too. Fields the client can't send, such as tools or
+// response_format, are an error rather than being dropped.
+func decodeBody(body json.RawMessage, v interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	for _, name := range []string{"prompt", "input"} {
+		if raw := bytes.TrimSpace(fields[name]); len(raw) > 0 && raw[0] == '"' {
+			fields[name] = append(append([]byte{'['}, raw...), ']')
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+			return fmt.Errorf("unsupported request field %s", field)
+		}
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// readResults reads the results of an earlier run. Records that failed, and a last line cut off by an
+// interruption, are dropped so those requests are sent again.
+func readResults(path string) ([]*batchResult, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read results: %w", err)
+	}
+	var results []*batchResult
+	dropped := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		r := &batchResult{}
+		if err := json.Unmarshal(line, r); err != nil || r.Error != nil || r.Response == nil {
+			dropped = true
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, dropped, nil
+}
+
+// writeResults replaces the results file, writing to a temporary file first.
+func writeResults(path string, results []*batchResult) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
+
+// rateLimiter is a token bucket allowing perMinute units a minute, starting full.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perMinute float64
+	available float64
+	last      time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: float64(perMinute), available: float64(perMinute), last: time.Now()}
+}
+
+// wait blocks until n units are available and takes them. More than the bucket holds waits for a full
+// bucket. A nil limiter doesn't limit.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	want := float64(n)
+	if want > l.perMinute {
+		want = l.perMinute
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.available += now.Sub(l.last).Minutes() * l.perMinute
+		if l.available > l.perMinute {
+			l.available = l.perMinute
+		}
+		l.last = now
+		if l.available >= want {
+			l.available -= want
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((want - l.available) / l.perMinute * float64(time.Minute))
+		l.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// batchRunner sends the requests of a batch.
+type batchRunner struct {
+	client      gpt.Client
+	model       string
+	concurrency int
+	retries     int
+	requests    *rateLimiter
+	tokens      *rateLimiter
+}
+
+// send sends a request, retrying errors that may go away, and returns the response body.
+func (b *batchRunner) send(ctx context.Context, req *batchRequest) (json.RawMessage, error) {
+	call, tokens, err := b.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if err := b.requests.wait(ctx, 1); err != nil {
+			return nil, err
+		}
+		if err := b.tokens.wait(ctx, tokens); err != nil {
+			return nil, err
+		}
+		rsp, err := call(ctx)
+		if err == nil {
+			return json.Marshal(rsp)
+		}
+		if attempt >= b.retries || !gpt.IsRetryable(err) {
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// prepare decodes the body of a request and returns the call sending it, with an estimate of the tokens
+// it uses for the token rate limit.
+func (b *batchRunner) prepare(req *batchRequest) (func(context.Context) (interface{}, error), int, error) {
+	switch req.URL {
+	case batchChat:
+		request := &gpt.ChatCompletionRequest{}
+		if err := decodeBody(req.Body, request); err != nil {
+			return nil, 0, err
+		}
+		if request.Model == "" {
+			request.Model = b.model
+		}
+		request.Stream = false
+		tokens, err := tokenizer.CountChatTokens(request.Model, request.Messages)
+		if err != nil {
+			tokens = len(req.Body) / 4
+		}
+		return func(ctx context.Context) (interface{}, error) {
+			return b.client.ChatCompletion(ctx, request)
+		}, tokens + request.MaxTokens, nil
+	case batchCompletions:
+		request := &gpt.CompletionRequest{}
+		if err := decodeBody(req.Body, request); err != nil {
+			return nil, 0, err
+		}
+		if request.Model == "" {
+			request.Model = b.model
+		}
+		tokens := 0
+		for _, prompt := range request.Prompt {
+			n, err := tokenizer.Count(request.Model, prompt)
+			if err != nil {
+				n = len(prompt) / 4
+			}
+			tokens += n
+		}
+		return func(ctx context.Context) (interface{}, error) {
+			return b.client.Completion(ctx, request)
+		}, tokens + request.MaxTokens, nil
+	default:
+		request := &gpt.EmbeddingsRequest{}
+		if err := decodeBody(req.Body, request); err != nil {
+			return nil, 0, err
+		}
+		if request.Model == "" {
+			request.Model = gpt.TextEmbeddingAda002
+		}
+		// base64 vectors are not kept in the response, so the results always hold numbers
+		request.EncodingFormat = ""
+		tokens := 0
+		for _, input := range request.Input {
+			n, err := tokenizer.Count(request.Model, input)
+			if err != nil {
+				n = len(input) / 4
+			}
+			tokens += n
+		}
+		return func(ctx context.Context) (interface{}, error) {
+			return b.client.Embeddings(ctx, request)
+		}, tokens, nil
+	}
+}
+
+// batchStats counts the outcomes of a run.
+type batchStats struct {
+	succeeded, failed, skipped int
+}
+
+// run sends the requests, writing a result for each to out as soon as it is done. It returns when all
+// requests are done or ctx is canceled; requests canceled midway get no result, while responses that
+// arrive as ctx is canceled are still written.
+func (b *batchRunner) run(ctx context.Context, requests []*batchRequest, out io.Writer, progress func(batchStats)) (batchStats, error) {
+	var (
+		mu       sync.Mutex
+		stats    batchStats
+		writeErr error
+		wg       sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan *batchRequest)
+	enc := json.NewEncoder(out)
+	for i := 0; i < b.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				rsp, err := b.send(ctx, req)
+				if err != nil && ctx.Err() != nil {
+					// canceled midway: the request is sent again on resume
+					continue
+				}
+				result := &batchResult{Line: req.line, CustomID: req.CustomID, URL: req.URL, Response: rsp}
+				if err != nil {
+					apiErr := gpt.APIError{Message: err.Error()}
+					errors.As(err, &apiErr)
+					result.Error, result.Response = &apiErr, nil
+				}
+				mu.Lock()
+				if err != nil {
+					stats.failed++
+				} else {
+					stats.succeeded++
+				}
+				if writeErr == nil {
+					if writeErr = enc.Encode(result); writeErr != nil {
+						cancel()
+					}
+				}
+				if progress != nil {
+					progress(stats)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+dispatch:
+	for _, req := range requests {
+		select {
+		case queue <- req:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if writeErr != nil {
+		return stats, fmt.Errorf("failed to write results: %w", writeErr)
+	}
+	return stats, ctx.Err()
+}
+
+// printUsage writes the usage and cost of the calls by model.
+func printUsage(w io.Writer, usage *gpt.UsageTracker) error {
+	byModel := usage.ByModel()
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "MODEL\tCALLS\tPROMPT\tCOMPLETION\tCOST\t")
+	row := func(name string, t gpt.UsageTotals) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t$%.4f\t\n", name, t.Calls, t.PromptTokens, t.CompletionTokens, t.Cost)
+	}
+	for _, model := range models {
+		row(model, byModel[model])
+	}
+	if len(models) > 1 {
+		row("total", usage.Total())
+	}
+	return tw.Flush()
+}
+
+func newBatchCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Run files of API requests.",
+	}
+	var (
+		output string
+		runner batchRunner
+		rpm    int
+		tpm    int
+	)
+	run := &cobra.Command{
+		Use:   "run FILE",
+		Short: "Send the requests of a JSONL file and write their results.",
+		Long: `Send the chat, completion and embedding requests of a JSONL file and write their results.
+
+Every line is a request in the format of the OpenAI Batch API, e.g.
+  {"custom_id": "q1", "url": "/v1/chat/completions", "body": {"messages": [{"role": "user", "content": "Hi"}]}}
+or just a request body, whose endpoint is told from its messages, prompt or input field. Requests with
+body fields the client doesn't support, such as tools or response_format, fail instead of being sent
+without them.
+
+Results are appended to the output file as they arrive, one JSON line per request with its line, custom_id
+and response or error. Running the same command again after an interruption or failures sends only the
+requests without a successful result; give requests a custom_id if the file may change in between.
+A summary of the tokens used and their cost is printed at the end.
+
+` + exitCodesHelp,
+		Example: `  chatgpt batch run requests.jsonl
+  chatgpt batch run requests.jsonl -o results.jsonl --concurrency 8 --rpm 500 --tpm 200000`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if runner.concurrency < 1 {
+				return usageError{errors.New("--concurrency must be at least 1")}
+			}
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read batch: %w", err)
+			}
+			requests, err := readBatch(file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				output = strings.TrimSuffix(args[0], ".jsonl") + ".results.jsonl"
+			}
+			done, dropped, err := readResults(output)
+			if err != nil {
+				return err
+			}
+			if dropped {
+				if err := writeResults(output, done); err != nil {
+					return err
+				}
+			}
+			finished := make(map[string]bool, len(done))
+			for _, r := range done {
+				finished[r.key()] = true
+			}
+			pending := requests[:0:0]
+			for _, req := range requests {
+				if !finished[req.key()] {
+					pending = append(pending, req)
+				}
+			}
+
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			usage := gpt.NewUsageTracker(client)
+			runner.client, runner.model = usage, opts.model
+			runner.requests, runner.tokens = newRateLimiter(rpm), newRateLimiter(tpm)
+			out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				return fmt.Errorf("failed to write results: %w", err)
+			}
+			defer out.Close()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			stderr := cmd.ErrOrStderr()
+			var progress func(batchStats)
+			if isTerminal(stderr) {
+				progress = func(s batchStats) {
+					fmt.Fprintf(stderr, "\r%d/%d done, %d failed", s.succeeded+s.failed, len(pending), s.failed)
+				}
+			}
+			stats, err := runner.run(ctx, pending, out, progress)
+			if progress != nil {
+				fmt.Fprintln(stderr)
+			}
+			if closeErr := out.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write results: %w", closeErr)
+			}
+			stats.skipped = len(requests) - len(pending)
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "%d succeeded, %d failed, %d already done, %d left; results in %s\n",
+				stats.succeeded, stats.failed, stats.skipped, len(pending)-stats.succeeded-stats.failed, output)
+			if usage.Total().Calls > 0 {
+				if err := printUsage(w, usage); err != nil {
+					return err
+				}
+			}
+			switch {
+			case errors.Is(err, context.Canceled):
+				fmt.Fprintln(stderr, "Interrupted, run the same command again to resume.")
+				return err
+			case err != nil:
+				return err
+			case stats.failed > 0:
+				return fmt.Errorf("%d of %d requests failed, run the same command again to retry them", stats.failed, len(pending))
+			}
+			return nil
+		},
+	}
+	flags := run.Flags()
+	flags.StringVarP(&output, "output", "o", "", "results file, FILE with the extension .results.jsonl by default")
+	flags.IntVarP(&runner.concurrency, "concurrency", "c", 4, "number of requests sent at the same time")
+	flags.IntVar(&rpm, "rpm", 0, "maximum requests per minute, 0 for no limit")
+	flags.IntVar(&tpm, "tpm", 0, "maximum estimated tokens per minute, 0 for no limit")
+	flags.IntVar(&runner.retries, "retries", 3, "times a request failing with a rate limit, server or network error is resent")
+	cmd.AddCommand(run)
+	return cmd
+}
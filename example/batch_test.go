@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+// interruptingClient cancels the run as soon as the first chat response arrives, like Ctrl-C pressed just then.
+type interruptingClient struct {
+	gpt.Client
+	cancel context.CancelFunc
+}
+
+func (c *interruptingClient) ChatCompletion(ctx context.Context, request *gpt.ChatCompletionRequest) (*gpt.ChatCompletionResponse, error) {
+	rsp, err := c.Client.ChatCompletion(ctx, request)
+	c.cancel()
+	return rsp, err
+}
+
+func TestBatchRunnerWritesResultsFinishedAtCancel(t *testing.T) {
+	server := gpttest.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := &batchRunner{client: &interruptingClient{server.Client(), cancel}, model: gpt.GPT4oMini, concurrency: 1}
+	requests, err := readBatch(strings.NewReader(`{"custom_id": "a", "url": "/v1/chat/completions", "body": {"messages": [{"role": "user", "content": "hi"}]}}
+{"custom_id": "b", "url": "/v1/chat/completions", "body": {"messages": [{"role": "user", "content": "again"}]}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	stats, err := runner.run(ctx, requests, &out, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("run error = %v, want context.Canceled", err)
+	}
+	if stats.succeeded != 1 {
+		t.Errorf("stats = %+v, want the finished request to succeed", stats)
+	}
+	if !strings.Contains(out.String(), `"custom_id":"a"`) || strings.Contains(out.String(), `"custom_id":"b"`) {
+		t.Errorf("results = %s, want the result of a only", out.String())
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+}
+
+func TestBatchRunnerDefaultModel(t *testing.T) {
+	tests := []struct {
+		name, line, endpoint string
+	}{
+		{"chat", `{"messages": [{"role": "user", "content": "hi"}]}`, gpttest.EndpointChatCompletions},
+		{"completion", `{"prompt": "hi"}`, gpttest.EndpointCompletions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			runner := &batchRunner{client: server.Client(), model: "profile-model", concurrency: 1}
+			requests, err := readBatch(strings.NewReader(tt.line + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if stats, err := runner.run(context.Background(), requests, &out, nil); err != nil || stats.succeeded != 1 {
+				t.Fatalf("run = %+v, %v; results %s", stats, err, out.String())
+			}
+			var body struct {
+				Model string `json:"model"`
+			}
+			sent, _ := server.LastRequest(tt.endpoint)
+			if err := sent.Decode(&body); err != nil || body.Model != "profile-model" {
+				t.Errorf("sent model %q, want the profile model: %s", body.Model, sent.Body)
+			}
+		})
+	}
+}
+
+func TestBatchRunnerRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		name, line, endpoint string
+		want                 string // the error of the result, or "" for success
+	}{
+		{"tools", `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "hi"}], "tools": []}`, gpttest.EndpointChatCompletions, `unsupported request field "tools"`},
+		{"response format", `{"messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "json_object"}}`, gpttest.EndpointChatCompletions, `unsupported request field "response_format"`},
+		{"seed", `{"prompt": "hi", "seed": 1}`, gpttest.EndpointCompletions, `unsupported request field "seed"`},
+		{"unknown message field", `{"messages": [{"role": "user", "content": "hi", "tool_calls": []}]}`, gpttest.EndpointChatCompletions, `unsupported request field "tool_calls"`},
+		{"known fields", `{"messages": [{"role": "user", "content": "hi"}], "temperature": 0.5, "stop": ["."], "user": "u"}`, gpttest.EndpointChatCompletions, ""},
+		{"embedding dimensions", `{"input": "hi", "model": "text-embedding-3-small", "dimensions": 4}`, gpttest.EndpointEmbeddings, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			runner := &batchRunner{client: server.Client(), model: gpt.GPT4oMini, concurrency: 1}
+			requests, err := readBatch(strings.NewReader(tt.line + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			stats, err := runner.run(context.Background(), requests, &out, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result batchResult
+			if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+				t.Fatalf("invalid result %s: %v", out.String(), err)
+			}
+			if tt.want == "" {
+				if stats.succeeded != 1 || result.Error != nil {
+					t.Errorf("result %s, want success", out.String())
+				}
+				server.AssertCalled(t, tt.endpoint, 1)
+				return
+			}
+			if stats.failed != 1 || result.Error == nil || result.Error.Message != tt.want {
+				t.Errorf("result %s, want the error %s", out.String(), tt.want)
+			}
+			server.AssertCalled(t, tt.endpoint, 0)
+		})
+	}
+}
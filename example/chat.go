@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/conversation"
+)
+
+// chat is an interactive conversation with a model.
+type chat struct {
+	client  gpt.Client
+	request gpt.ChatCompletionRequest
+	history *conversation.History
+	out     io.Writer
+	raw     bool
+	// session is saved after every change when the chat was started with --session
+	session *session
+	saved   []byte
+	// interrupts receives Ctrl-C; while an answer is being written it stops the answer instead of the program
+	interrupts chan os.Signal
+}
+
+func newChat(client gpt.Client, opts *options) *chat {
+	return &chat{
+		client:  client,
+		request: opts.request(),
+		history: conversation.New(opts.system, nil),
+		raw:     opts.raw,
+	}
+}
+
+// run reads questions and slash commands from in until it is closed, Ctrl-C is pressed at the prompt or
+// /quit is entered.
+func (c *chat) run(ctx context.Context, in io.Reader, out io.Writer) error {
+	c.out = out
+	c.interrupts = make(chan os.Signal, 1)
+	signal.Notify(c.interrupts, os.Interrupt)
+	defer signal.Stop(c.interrupts)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	if c.session != nil && len(c.session.Messages) > 0 {
+		fmt.Fprintf(out, "Resumed session %s with %d messages.\n", c.session.Name, len(c.session.Messages))
+	}
+	fmt.Fprintf(out, "Chatting with %s. Type /help for commands, Ctrl-D to exit.\n", c.request.Model)
+	for {
+		fmt.Fprint(out, "> ")
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(out)
+				return nil
+			}
+			line = strings.TrimSpace(l)
+		case <-c.interrupts:
+			fmt.Fprintln(out)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "/"):
+			quit := c.command(line)
+			c.persist()
+			if quit {
+				return nil
+			}
+		default:
+			c.ask(ctx, line)
+			c.persist()
+		}
+	}
+}
+
+// resume continues the named session, or starts it if there is none. Settings given as flags override
+// the ones saved with the session.
+func (c *chat) resume(name string, changed func(flag string) bool, opts *options) error {
+	s, err := loadSession(name)
+	if errors.Is(err, errSessionNotFound) {
+		now := time.Now()
+		c.session = &session{Name: name, Created: now, Updated: now}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.apply(s.transcript)
+	if changed("model") {
+		c.request.Model = opts.model
+	}
+	if changed("temperature") {
+		c.request.Temperature = opts.temperature
+	}
+	if changed("max-tokens") {
+		c.request.MaxTokens = opts.maxTokens
+	}
+	if changed("system") {
+		c.setSystem(opts.system)
+	}
+	c.session = s
+	c.saved, _ = json.Marshal(s.transcript)
+	return nil
+}
+
+// persist saves the session if the conversation or its settings changed since it was last saved.
+func (c *chat) persist() {
+	if c.session == nil {
+		return
+	}
+	t := c.transcript()
+	data, err := json.Marshal(t)
+	if err != nil || bytes.Equal(data, c.saved) {
+		return
+	}
+	c.session.transcript = t
+	c.session.Updated = time.Now()
+	if err := c.session.save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+	c.saved = data
+}
+
+// ask sends a question with the history and streams the answer. Ctrl-C stops the answer; the part
+// already written stays in the history.
+func (c *chat) ask(ctx context.Context, question string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := newAnswerWriter(c.out, c.raw)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.history.ChatCompletionStream(ctx, c.client, &c.request, question, func(rsp *gpt.ChatCompletionStreamResponse) {
+			if len(rsp.Choices) > 0 {
+				fmt.Fprint(w, rsp.Choices[0].Delta.Content)
+			}
+		})
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-c.interrupts:
+		cancel()
+		err = <-done
+	}
+	w.Flush()
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(c.out, "\n[stopped]")
+	case err != nil:
+		fmt.Fprintln(c.out)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	default:
+		fmt.Fprintln(c.out)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/conversation"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func TestChatTrimsHistory(t *testing.T) {
+	server := gpttest.New(t)
+	c := newChat(server.Client(), &options{model: gpt.GPT4oMini, system: "Be brief.", maxTokens: 10, raw: true})
+	// room for the system prompt and about two turns
+	c.history.ContextWindow = 70
+	questions := []string{"first question", "second question", "third question", "fourth question"}
+	runChat(t, c, questions...)
+
+	if len(c.history.Messages) != 1+2*len(questions) {
+		t.Errorf("history %q, want every turn kept", roles(c.history.Messages))
+	}
+	requests := server.Requests(gpttest.EndpointChatCompletions)
+	if len(requests) != len(questions) {
+		t.Fatalf("%d requests, want %d", len(requests), len(questions))
+	}
+	var last gpt.ChatCompletionRequest
+	if err := requests[len(requests)-1].Decode(&last); err != nil {
+		t.Fatal(err)
+	}
+	sent := roles(last.Messages)
+	if last.Messages[0].Role != conversation.RoleSystem || !strings.HasSuffix(sent, "user:fourth question") {
+		t.Errorf("sent %q, want the system prompt and the last question", sent)
+	}
+	if strings.Contains(sent, "first question") || len(last.Messages) >= len(c.history.Messages) {
+		t.Errorf("sent %q, want the oldest turns dropped", sent)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/conversation"
+)
+
+const chatHelp = `Commands:
+  /reset          forget the conversation, keeping the system prompt
+  /model [NAME]   show or change the model
+  /system [TEXT]  show, change or with "-" remove the system prompt
+  /tokens         count the tokens of the conversation
+  /save FILE      save the conversation as JSON
+  /load FILE      load a conversation saved with /save
+  /help           show this help
+  /quit           exit`
+
+// transcript is a conversation saved with /save.
+type transcript struct {
+	Model       string                             `json:"model"`
+	Temperature float32                            `json:"temperature,omitempty"`
+	MaxTokens   int                                `json:"max_tokens,omitempty"`
+	Messages    []gpt.ChatCompletionRequestMessage `json:"messages"`
+}
+
+// command runs a slash command and reports whether the chat should end.
+func (c *chat) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/quit", "/exit":
+		return true
+	case "/help":
+		fmt.Fprintln(c.out, chatHelp)
+	case "/reset":
+		c.history.Reset()
+		fmt.Fprintln(c.out, "Conversation cleared.")
+	case "/model":
+		if arg != "" {
+			c.request.Model = arg
+		}
+		fmt.Fprintln(c.out, "Model:", c.request.Model)
+	case "/system":
+		c.system(arg)
+	case "/tokens":
+		c.tokens()
+	case "/save":
+		c.save(arg)
+	case "/load":
+		c.load(arg)
+	default:
+		fmt.Fprintf(c.out, "Unknown command %s, type /help for the commands.\n", name)
+	}
+	return false
+}
+
+// system shows the system prompt, or replaces it with text; "-" removes it.
+func (c *chat) system(text string) {
+	switch text {
+	case "":
+		var prompts []string
+		for _, msg := range c.history.Messages {
+			if msg.Role == conversation.RoleSystem {
+				prompts = append(prompts, msg.Content)
+			}
+		}
+		if len(prompts) == 0 {
+			fmt.Fprintln(c.out, "No system prompt.")
+		} else {
+			fmt.Fprintln(c.out, "System prompt:", strings.Join(prompts, "\n"))
+		}
+	case "-":
+		c.setSystem("")
+		fmt.Fprintln(c.out, "System prompt removed.")
+	default:
+		c.setSystem(text)
+		fmt.Fprintln(c.out, "System prompt set.")
+	}
+}
+
+// setSystem replaces the system prompt with text, or removes it if text is empty.
+func (c *chat) setSystem(text string) {
+	var messages []gpt.ChatCompletionRequestMessage
+	if text != "" {
+		messages = append(messages, gpt.ChatCompletionRequestMessage{Role: conversation.RoleSystem, Content: text})
+	}
+	for _, msg := range c.history.Messages {
+		if msg.Role != conversation.RoleSystem {
+			messages = append(messages, msg)
+		}
+	}
+	c.history.Messages = messages
+}
+
+// tokens prints the prompt tokens of the conversation and the context window of the model.
+func (c *chat) tokens() {
+	n, window := c.history.Tokens(c.request.Model), c.history.Window(c.request.Model)
+	fmt.Fprintf(c.out, "%d tokens in %d messages, %d of the %d tokens context window left.\n",
+		n, len(c.history.Messages), window-n, window)
+}
+
+// transcript returns the conversation with its settings.
+func (c *chat) transcript() transcript {
+	return transcript{
+		Model:       c.request.Model,
+		Temperature: c.request.Temperature,
+		MaxTokens:   c.request.MaxTokens,
+		Messages:    c.history.Messages,
+	}
+}
+
+// apply replaces the conversation and its settings with a saved one.
+func (c *chat) apply(t transcript) {
+	c.history.Messages = t.Messages
+	if t.Model != "" {
+		c.request.Model = t.Model
+	}
+	c.request.Temperature, c.request.MaxTokens = t.Temperature, t.MaxTokens
+}
+
+func (c *chat) save(path string) {
+	if path == "" {
+		fmt.Fprintln(c.out, "Usage: /save FILE")
+		return
+	}
+	data, err := json.MarshalIndent(c.transcript(), "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, append(data, '\n'), 0o600)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: failed to save conversation:", err)
+		return
+	}
+	fmt.Fprintf(c.out, "Saved %d messages to %s.\n", len(c.history.Messages), path)
+}
+
+func (c *chat) load(path string) {
+	if path == "" {
+		fmt.Fprintln(c.out, "Usage: /load FILE")
+		return
+	}
+	var t transcript
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: failed to load conversation:", err)
+		return
+	}
+	c.apply(t)
+	fmt.Fprintf(c.out, "Loaded %d messages, model %s.\n", len(t.Messages), c.request.Model)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+// runChat runs a chat with the given input lines and returns what it wrote.
+func runChat(t *testing.T, c *chat, lines ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := c.run(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func roles(messages []gpt.ChatCompletionRequestMessage) string {
+	var roles []string
+	for _, msg := range messages {
+		roles = append(roles, msg.Role+":"+msg.Content)
+	}
+	return strings.Join(roles, " | ")
+}
+
+func TestChatCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		output  []string
+		model   string
+		history string
+	}{
+		{"help", []string{"/help"}, []string{"/reset", "/save FILE"}, gpt.GPT4oMini, "system:Be brief."},
+		{"show the model", []string{"/model"}, []string{"Model: " + gpt.GPT4oMini}, gpt.GPT4oMini, "system:Be brief."},
+		{"change the model", []string{"/model gpt-4o"}, []string{"Model: gpt-4o"}, gpt.GPT4o, "system:Be brief."},
+		{"show the system prompt", []string{"/system"}, []string{"System prompt: Be brief."}, gpt.GPT4oMini, "system:Be brief."},
+		{"change the system prompt", []string{"hi", "/system Be verbose."}, []string{"System prompt set."}, gpt.GPT4oMini,
+			"system:Be verbose. | user:hi | assistant:" + gpttest.DefaultReply},
+		{"remove the system prompt", []string{"/system -", "/system"}, []string{"System prompt removed.", "No system prompt."}, gpt.GPT4oMini, ""},
+		{"reset keeps the system prompt", []string{"hi", "/reset"}, []string{"Conversation cleared."}, gpt.GPT4oMini, "system:Be brief."},
+		{"tokens", []string{"/tokens"}, []string{"tokens in 1 messages", "of the 128000 tokens context window left"}, gpt.GPT4oMini, "system:Be brief."},
+		{"unknown command", []string{"/nope"}, []string{"Unknown command /nope"}, gpt.GPT4oMini, "system:Be brief."},
+		{"quit stops reading", []string{"/quit", "hi"}, nil, gpt.GPT4oMini, "system:Be brief."},
+		{"exit stops reading", []string{"/exit", "hi"}, nil, gpt.GPT4oMini, "system:Be brief."},
+		{"usage of save and load", []string{"/save", "/load"}, []string{"Usage: /save FILE", "Usage: /load FILE"}, gpt.GPT4oMini, "system:Be brief."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			c := newChat(server.Client(), &options{model: gpt.GPT4oMini, system: "Be brief.", raw: true})
+			out := runChat(t, c, tt.lines...)
+			for _, want := range tt.output {
+				if !strings.Contains(out, want) {
+					t.Errorf("output %q, want %q", out, want)
+				}
+			}
+			if c.request.Model != tt.model {
+				t.Errorf("model %q, want %q", c.request.Model, tt.model)
+			}
+			if got := roles(c.history.Messages); got != tt.history {
+				t.Errorf("history %q, want %q", got, tt.history)
+			}
+		})
+	}
+}
+
+func TestChatSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.json")
+	server := gpttest.New(t)
+	c := newChat(server.Client(), &options{model: gpt.GPT4o, system: "Be brief.", temperature: 0.5, maxTokens: 100, raw: true})
+	out := runChat(t, c, "hi", "/save "+path)
+	if !strings.Contains(out, "Saved 3 messages to "+path) {
+		t.Errorf("output %q, want the saved messages", out)
+	}
+
+	loaded := newChat(server.Client(), &options{model: gpt.GPT4oMini, raw: true})
+	out = runChat(t, loaded, "/load "+path)
+	if !strings.Contains(out, "Loaded 3 messages") {
+		t.Errorf("output %q, want the loaded messages", out)
+	}
+	if roles(loaded.history.Messages) != roles(c.history.Messages) {
+		t.Errorf("loaded history %q, want %q", roles(loaded.history.Messages), roles(c.history.Messages))
+	}
+	if loaded.request.Model != gpt.GPT4o || loaded.request.Temperature != 0.5 || loaded.request.MaxTokens != 100 {
+		t.Errorf("loaded settings %+v, want the saved ones", loaded.request)
+	}
+
+	// a missing file leaves the conversation as it was
+	runChat(t, loaded, "/load "+filepath.Join(t.TempDir(), "missing.json"))
+	if len(loaded.history.Messages) != 3 {
+		t.Errorf("history %q after a failed load", roles(loaded.history.Messages))
+	}
+}
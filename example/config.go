@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfile is the profile used when neither --profile nor the config file picks one.
+const defaultProfile = "default"
+
+// config is the configuration file of the command.
+type config struct {
+	// Profile is the profile used without --profile
+	Profile  string              `yaml:"profile,omitempty"`
+	Profiles map[string]*profile `yaml:"profiles,omitempty"`
+}
+
+// profile holds the settings of one API account or backend. Flags override them.
+type profile struct {
+	BaseURL     string  `yaml:"base_url,omitempty"`
+	OrgID       string  `yaml:"org_id,omitempty"`
+	Timeout     string  `yaml:"timeout,omitempty"`
+	Model       string  `yaml:"model,omitempty"`
+	Temperature float32 `yaml:"temperature,omitempty"`
+	MaxTokens   int     `yaml:"max_tokens,omitempty"`
+	System      string  `yaml:"system,omitempty"`
+	// The API key is read from the first key source set, API_KEY if none is
+	APIKeyEnv     string `yaml:"api_key_env,omitempty"`
+	APIKeyFile    string `yaml:"api_key_file,omitempty"`
+	APIKeyCommand string `yaml:"api_key_command,omitempty"`
+}
+
+// profileField is a setting of a profile that config get and set access by its YAML name.
+type profileField struct {
+	name string
+	get  func(p *profile) string
+	set  func(p *profile, value string) error
+}
+
+var profileFields = []profileField{
+	{"base_url", func(p *profile) string { return p.BaseURL }, func(p *profile, v string) error { p.BaseURL = v; return nil }},
+	{"org_id", func(p *profile) string { return p.OrgID }, func(p *profile, v string) error { p.OrgID = v; return nil }},
+	{"timeout", func(p *profile) string { return p.Timeout }, func(p *profile, v string) error {
+		if v != "" {
+			if _, err := time.ParseDuration(v); err != nil {
+				return err
+			}
+		}
+		p.Timeout = v
+		return nil
+	}},
+	{"model", func(p *profile) string { return p.Model }, func(p *profile, v string) error { p.Model = v; return nil }},
+	{"temperature", func(p *profile) string { return formatNumber(float64(p.Temperature), 32) }, func(p *profile, v string) error {
+		t, err := parseNumber(v, 32)
+		p.Temperature = float32(t)
+		return err
+	}},
+	{"max_tokens", func(p *profile) string { return formatNumber(float64(p.MaxTokens), 64) }, func(p *profile, v string) error {
+		n, err := parseNumber(v, 0)
+		p.MaxTokens = int(n)
+		return err
+	}},
+	{"system", func(p *profile) string { return p.System }, func(p *profile, v string) error { p.System = v; return nil }},
+	{"api_key_env", func(p *profile) string { return p.APIKeyEnv }, func(p *profile, v string) error { p.APIKeyEnv = v; return nil }},
+	{"api_key_file", func(p *profile) string { return p.APIKeyFile }, func(p *profile, v string) error { p.APIKeyFile = v; return nil }},
+	{"api_key_command", func(p *profile) string { return p.APIKeyCommand }, func(p *profile, v string) error { p.APIKeyCommand = v; return nil }},
+}
+
+func lookupField(name string) (profileField, error) {
+	for _, f := range profileFields {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return profileField{}, usageError{fmt.Errorf("unknown setting %q, use one of %s", name, strings.Join(fieldNames(), ", "))}
+}
+
+// formatNumber formats a float of bitSize bits, leaving 0 empty like an unset setting.
+func formatNumber(v float64, bitSize int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'g', -1, bitSize)
+}
+
+// parseNumber parses a float of bitSize bits, or an integer if bitSize is 0. An empty value is 0.
+func parseNumber(v string, bitSize int) (float64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if bitSize == 0 {
+		n, err := strconv.Atoi(v)
+		return float64(n), err
+	}
+	return strconv.ParseFloat(v, bitSize)
+}
+
+// configPath returns the default configuration file, $XDG_CONFIG_HOME/gpt-go/config.yaml or
+// ~/.config/gpt-go/config.yaml.
+func configPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the config directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gpt-go", "config.yaml"), nil
+}
+
+// loadConfig reads the configuration file. A missing file is an empty configuration.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// saveSetting writes a setting of the named profile p into the configuration file at path. The YAML is
+// edited in place, so comments and the order of the settings are kept.
+func saveSetting(path, name, setting string, p *profile) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	profiles := mappingEntry(doc.Content[0], "profiles")
+	profileNode := mappingEntry(profiles, name)
+
+	// the setting is taken from the encoded profile so that its value has the right YAML type
+	var encoded yaml.Node
+	if err := encoded.Encode(p); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	value := lookupEntry(&encoded, setting)
+	i := entryIndex(profileNode, setting)
+	switch {
+	case value == nil && i >= 0:
+		removeEntry(profileNode, i)
+	case value != nil && i >= 0:
+		old := profileNode.Content[i+1]
+		old.Kind, old.Tag, old.Value, old.Style, old.Content = value.Kind, value.Tag, value.Value, value.Style, value.Content
+	case value != nil:
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: setting}
+		profileNode.Content = append(profileNode.Content, key, value)
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// entryIndex returns the index of the key node of a mapping node, or -1.
+func entryIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeEntry removes the entry whose key node is at index i from a mapping node. The comments around
+// the entry are moved to the next entry, or to the previous one.
+func removeEntry(mapping *yaml.Node, i int) {
+	key := mapping.Content[i]
+	comments := joinComments(key.HeadComment, key.FootComment)
+	switch {
+	case i+2 < len(mapping.Content):
+		next := mapping.Content[i+2]
+		next.HeadComment = joinComments(comments, next.HeadComment)
+	case i > 0:
+		previous := mapping.Content[i-2]
+		previous.FootComment = joinComments(previous.FootComment, comments)
+	default:
+		mapping.FootComment = joinComments(mapping.FootComment, comments)
+	}
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+}
+
+func joinComments(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "\n" + b
+}
+
+// lookupEntry returns the value node of a key of a mapping node, or nil.
+func lookupEntry(mapping *yaml.Node, key string) *yaml.Node {
+	if i := entryIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// mappingEntry returns the mapping under a key of a mapping node, adding it if it is missing or empty.
+func mappingEntry(mapping *yaml.Node, key string) *yaml.Node {
+	value := lookupEntry(mapping, key)
+	if value == nil {
+		value = &yaml.Node{}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	}
+	if value.Kind != yaml.MappingNode {
+		// an empty entry, e.g. "default:" without settings, is a null scalar
+		value.Kind, value.Tag, value.Value, value.Content = yaml.MappingNode, "!!map", "", nil
+	}
+	// an emptied mapping is written as {}, which must not turn the settings added to it into flow style
+	value.Style &^= yaml.FlowStyle
+	return value
+}
+
+// profileName returns the name of the profile to use: name if set, else the config's default profile.
+func (c *config) profileName(name string) string {
+	switch {
+	case name != "":
+		return name
+	case c.Profile != "":
+		return c.Profile
+	}
+	return defaultProfile
+}
+
+// lookup returns the named profile. Only the default profile may be missing, and is empty then.
+func (c *config) lookup(name string) (*profile, error) {
+	if p, ok := c.Profiles[name]; ok && p != nil {
+		return p, nil
+	}
+	if name == defaultProfile {
+		return &profile{}, nil
+	}
+	return nil, usageError{fmt.Errorf("profile %s not found in the config", name)}
+}
+
+// client returns a client for the profile.
+func (p *profile) client() (gpt.Client, error) {
+	var options []gpt.ClientOption
+	if p.BaseURL != "" {
+		options = append(options, gpt.WithBaseURL(p.BaseURL))
+	}
+	if p.OrgID != "" {
+		options = append(options, gpt.WithOrg(p.OrgID))
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %w", p.Timeout, err)
+		}
+		options = append(options, gpt.WithTimeout(timeout))
+	}
+	var provider gpt.CredentialProvider
+	switch {
+	case p.APIKeyEnv != "":
+		if os.Getenv(p.APIKeyEnv) == "" {
+			return nil, fmt.Errorf("%w, set the %s environment variable", errMissingAPIKey, p.APIKeyEnv)
+		}
+		provider = gpt.EnvCredential(p.APIKeyEnv)
+	case p.APIKeyFile != "":
+		provider = gpt.FileCredential(expandHome(p.APIKeyFile))
+	case p.APIKeyCommand != "":
+		provider = commandCredential(p.APIKeyCommand)
+	default:
+		if os.Getenv("API_KEY") == "" {
+			return nil, fmt.Errorf("%w, set the API_KEY environment variable or a key source with chatgpt config set", errMissingAPIKey)
+		}
+		provider = gpt.EnvCredential("API_KEY")
+	}
+	return gpt.NewClient("", append(options, gpt.WithCredentialProvider(provider))...), nil
+}
+
+// commandCredential runs a shell command for the API key, such as a password manager lookup. The key is
+// kept until the API rejects it.
+func commandCredential(command string) gpt.CredentialProvider {
+	return gpt.CachedCredential(func(ctx context.Context) (string, time.Time, error) {
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		cmd := exec.CommandContext(ctx, shell, flag, command)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to run api_key_command: %w", err)
+		}
+		return strings.TrimSpace(string(out)), time.Time{}, nil
+	}, 0)
+}
+
+func expandHome(path string) string {
+	if rest := strings.TrimPrefix(path, "~/"); rest != path {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// configTemplate is written by config init.
+const configTemplate = `# Configuration of chatgpt. Pick a profile with --profile NAME; flags override profile settings.
+profile: default
+profiles:
+  default:
+    # base_url: https://api.openai.com/v1
+    # org_id: org-...
+    # timeout: 60s
+    model: gpt-4o-mini
+    # temperature: 0.7
+    # max_tokens: 1024
+    # system: You are a concise assistant.
+    # The API key is read from the first of these that is set, API_KEY if none is.
+    api_key_env: API_KEY
+    # api_key_file: ~/.config/gpt-go/api_key
+    # api_key_command: pass show openai
+`
+
+func newConfigCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration file and its profiles.",
+		Long: "Manage the configuration file and its profiles. The settings of a profile are " +
+			strings.Join(fieldNames(), ", ") + ".",
+		// the config commands read the file themselves, so they work on a file that doesn't load
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+	var force bool
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Write a configuration file with a default profile.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := opts.configFile()
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err == nil && !force {
+				return fmt.Errorf("config %s already exists, use --force to overwrite it", path)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+				return fmt.Errorf("failed to write config: %w", err)
+			}
+			if err := os.WriteFile(path, []byte(configTemplate), 0o600); err != nil {
+				return fmt.Errorf("failed to write config: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Wrote", path)
+			return nil
+		},
+	}
+	initCmd.Flags().BoolVar(&force, "force", false, "overwrite an existing configuration file")
+	cmd.AddCommand(initCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get [SETTING]",
+		Short: "Print a setting of the profile, or all of them.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, name, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			p, err := cfg.lookup(name)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(args) == 1 {
+				f, err := lookupField(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, f.get(p))
+				return nil
+			}
+			for _, f := range profileFields {
+				if v := f.get(p); v != "" {
+					fmt.Fprintf(out, "%s: %s\n", f.name, v)
+				}
+			}
+			return nil
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set SETTING VALUE",
+		Short: "Change a setting of the profile, creating the profile if needed. An empty value removes it.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := lookupField(args[0])
+			if err != nil {
+				return err
+			}
+			cfg, name, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.Profiles == nil {
+				cfg.Profiles = make(map[string]*profile)
+			}
+			p := cfg.Profiles[name]
+			if p == nil {
+				p = &profile{}
+				cfg.Profiles[name] = p
+			}
+			if err := f.set(p, args[1]); err != nil {
+				return usageError{fmt.Errorf("invalid %s %q: %w", f.name, args[1], err)}
+			}
+			path, err := opts.configFile()
+			if err != nil {
+				return err
+			}
+			return saveSetting(path, name, f.name, p)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "profiles",
+		Short: "List the profiles, marking the one in use.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, current, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(cfg.Profiles))
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				mark := " "
+				if name == current {
+					mark = "*"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", mark, name)
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+func fieldNames() []string {
+	names := make([]string, len(profileFields))
+	for i, f := range profileFields {
+		names[i] = f.name
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveSetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		setting string
+		value   string
+		want    []string
+		gone    []string
+	}{
+		{"changes a setting", "default", "model", "gpt-4o", []string{"    model: gpt-4o\n", "# The API key is read"}, []string{"gpt-4o-mini"}},
+		{"adds a setting", "default", "temperature", "0.2", []string{"    temperature: 0.2\n", "    # temperature: 0.7\n"}, nil},
+		{"quotes a string that looks like a number", "default", "model", "1234", []string{`    model: "1234"`}, nil},
+		{"removes a setting and keeps its comments", "default", "api_key_env", "",
+			[]string{"    # The API key is read", "    # api_key_command: pass show openai\n"}, []string{"api_key_env"}},
+		{"adds a profile", "azure", "base_url", "https://example.com/v1",
+			[]string{"  azure:\n    base_url: https://example.com/v1\n", "    model: gpt-4o-mini\n"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(configTemplate), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := cfg.Profiles[tt.profile]
+			if p == nil {
+				p = &profile{}
+			}
+			f, err := lookupField(tt.setting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.set(p, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if err := saveSetting(path, tt.profile, tt.setting, p); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(data)
+			for _, want := range append([]string{"# Configuration of chatgpt."}, tt.want...) {
+				if !strings.Contains(got, want) {
+					t.Errorf("config lacks %q:\n%s", want, got)
+				}
+			}
+			for _, gone := range tt.gone {
+				if strings.Contains(got, gone) {
+					t.Errorf("config still has %q:\n%s", gone, got)
+				}
+			}
+			saved, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := f.get(saved.Profiles[tt.profile]); v != tt.value {
+				t.Errorf("saved %s = %q, want %q", tt.setting, v, tt.value)
+			}
+		})
+	}
+}
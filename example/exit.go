@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Exit codes of the command, so scripts can tell failures apart.
+const (
+	exitOK          = 0
+	exitError       = 1   // exitError is any other failure
+	exitUsage       = 2   // exitUsage is an invalid command line
+	exitAuth        = 3   // exitAuth is a missing, invalid or unauthorized API key
+	exitRateLimit   = 4   // exitRateLimit is a rate limit or exhausted quota
+	exitInvalid     = 5   // exitInvalid is a request the API rejected, such as an unknown model
+	exitServer      = 6   // exitServer is a server side error of the API
+	exitNetwork     = 7   // exitNetwork is a connection failure or timeout
+	exitInterrupted = 130 // exitInterrupted is Ctrl-C, following the shell convention
+)
+
+const exitCodesHelp = `Exit codes:
+  0    success
+  1    other error
+  2    invalid command line
+  3    authentication failed
+  4    rate limited or out of quota
+  5    request rejected by the API
+  6    server error
+  7    network error or timeout
+  130  interrupted`
+
+// usageError is an invalid command line.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+
+func (e usageError) Unwrap() error { return e.err }
+
+// errMissingAPIKey is returned when no API key is configured.
+var errMissingAPIKey = errors.New("missing API key")
+
+// exitCode returns the exit code of the command for err.
+func exitCode(err error) int {
+	var apiErr gpt.APIError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &pathErr):
+		// file errors have a Timeout method too, but aren't network errors
+		return exitError
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &usageError{}):
+		return exitUsage
+	case errors.Is(err, errMissingAPIKey) || errors.Is(err, gpt.ErrEmptyCredential):
+		return exitAuth
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+			return exitAuth
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return exitRateLimit
+		case apiErr.StatusCode == http.StatusRequestTimeout:
+			return exitNetwork
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return exitServer
+		default:
+			return exitInvalid
+		}
+	case errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded):
+		return exitNetwork
+	}
+	return exitError
+}
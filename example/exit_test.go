@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func TestExitCode(t *testing.T) {
+	_, pathErr := os.Open(filepath.Join(t.TempDir(), "missing"))
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"other error", errors.New("boom"), exitError},
+		{"file error", fmt.Errorf("failed to read input: %w", pathErr), exitError},
+		{"usage", usageError{errors.New("bad flag")}, exitUsage},
+		{"wrapped usage", fmt.Errorf("ask: %w", usageError{errors.New("no question")}), exitUsage},
+		{"missing key", errMissingAPIKey, exitAuth},
+		{"empty credential", fmt.Errorf("failed: %w", gpt.ErrEmptyCredential), exitAuth},
+		{"interrupted", fmt.Errorf("stream: %w", context.Canceled), exitInterrupted},
+		{"deadline", context.DeadlineExceeded, exitNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeOfAPIErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response gpttest.Response
+		want     int
+	}{
+		{"unauthorized", gpttest.ErrorResponse(http.StatusUnauthorized, "invalid_request_error", "Incorrect API key"), exitAuth},
+		{"forbidden", gpttest.ErrorResponse(http.StatusForbidden, "invalid_request_error", "Country not supported"), exitAuth},
+		{"rate limited", gpttest.RateLimited(0), exitRateLimit},
+		{"out of quota", gpttest.ErrorResponse(http.StatusTooManyRequests, "insufficient_quota", "quota"), exitRateLimit},
+		{"unknown model", gpttest.ErrorResponse(http.StatusNotFound, "invalid_request_error", "model not found"), exitInvalid},
+		{"bad request", gpttest.ErrorResponse(http.StatusBadRequest, "invalid_request_error", "bad"), exitInvalid},
+		{"timeout", gpttest.ErrorResponse(http.StatusRequestTimeout, "timeout", "timeout"), exitNetwork},
+		{"server error", gpttest.ErrorResponse(http.StatusBadGateway, "server_error", "bad gateway"), exitServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Enqueue(gpttest.EndpointChatCompletions, tt.response)
+			_, err := server.Client().ChatCompletion(context.Background(), &gpt.ChatCompletionRequest{
+				Model:    gpt.GPT4oMini,
+				Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+			})
+			if got := exitCode(fmt.Errorf("ask: %w", err)); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+
+	// nothing listens on the address of a closed server
+	server := gpttest.NewServer()
+	client := server.Client()
+	server.Close()
+	_, err := client.ChatCompletion(context.Background(), &gpt.ChatCompletionRequest{Model: gpt.GPT4oMini})
+	if got := exitCode(err); got != exitNetwork {
+		t.Errorf("exitCode(%v) = %d, want %d", err, got, exitNetwork)
+	}
+}
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/hanyuancheung/gpt-go v0.0.0
 	github.com/spf13/cobra v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
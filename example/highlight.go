@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// syntax is the lexical structure of a language, enough to color keywords, strings, numbers and comments.
+type syntax struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	goSyntax = &syntax{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var true false nil iota`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	pythonSyntax = &syntax{
+		keywords: words(`and as assert async await break class continue def del elif else except finally for from
+			global if import in is lambda nonlocal not or pass raise return try while with yield True False None self`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	jsSyntax = &syntax{
+		keywords: words(`async await break case catch class const continue debugger default delete do else export
+			extends finally for function if import in instanceof let new of return super switch this throw try typeof
+			var void while yield true false null undefined interface type enum implements readonly`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	cSyntax = &syntax{
+		keywords: words(`auto break case char class const continue default delete do double else enum extern float
+			for goto if inline int long namespace new private protected public return short signed sizeof static
+			struct switch template this throw try typedef union unsigned using virtual void volatile while true
+			false nullptr NULL abstract boolean extends final finally implements import instanceof interface
+			package super synchronized throws`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	rustSyntax = &syntax{
+		keywords: words(`as async await break const continue crate dyn else enum extern false fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+	}
+	shellSyntax = &syntax{
+		keywords:     words(`if then else elif fi for while until do done case esac in function return local export set unset echo exit`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	sqlSyntax = &syntax{
+		keywords: words(`select from where and or not insert into values update set delete create table drop alter
+			index join left right inner outer on group by order having limit offset as distinct null is in like
+			primary key foreign references union all case when then else end SELECT FROM WHERE AND OR NOT INSERT INTO
+			VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER
+			HAVING LIMIT OFFSET AS DISTINCT NULL IS IN LIKE PRIMARY KEY FOREIGN REFERENCES UNION ALL CASE WHEN THEN
+			ELSE END`),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "'\"",
+	}
+	dataSyntax = &syntax{
+		keywords:     words(`true false null yes no`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+)
+
+// syntaxes are the languages of fenced code blocks that are highlighted, by their info string.
+var syntaxes = map[string]*syntax{
+	"go": goSyntax, "golang": goSyntax,
+	"python": pythonSyntax, "py": pythonSyntax,
+	"javascript": jsSyntax, "js": jsSyntax, "jsx": jsSyntax, "typescript": jsSyntax, "ts": jsSyntax, "tsx": jsSyntax,
+	"c": cSyntax, "h": cSyntax, "cpp": cSyntax, "c++": cSyntax, "cc": cSyntax, "java": cSyntax, "cs": cSyntax,
+	"csharp": cSyntax, "kotlin": cSyntax, "swift": cSyntax,
+	"rust": rustSyntax, "rs": rustSyntax,
+	"sh": shellSyntax, "bash": shellSyntax, "shell": shellSyntax, "zsh": shellSyntax, "console": shellSyntax,
+	"json": dataSyntax, "yaml": dataSyntax, "yml": dataSyntax, "toml": dataSyntax, "sql": sqlSyntax,
+}
+
+// highlight colors a line of the open code block. Block comments are carried over to the next line.
+func (m *markdownWriter) highlight(line string) string {
+	syn := syntaxes[m.lang]
+	if syn == nil {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		if m.inComment {
+			end := strings.Index(rest, syn.blockComment[1])
+			if end < 0 {
+				b.WriteString(ansiDim + rest + ansiReset)
+				break
+			}
+			end += len(syn.blockComment[1])
+			b.WriteString(ansiDim + rest[:end] + ansiReset)
+			m.inComment = false
+			i += end
+			continue
+		}
+		if syn.blockComment[0] != "" && strings.HasPrefix(rest, syn.blockComment[0]) {
+			m.inComment = true
+			b.WriteString(ansiDim + syn.blockComment[0] + ansiReset)
+			i += len(syn.blockComment[0])
+			continue
+		}
+		if lineComment(syn, line, i) {
+			b.WriteString(ansiDim + rest + ansiReset)
+			break
+		}
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case strings.ContainsRune(syn.quotes, r):
+			end := stringEnd(rest, byte(r))
+			b.WriteString(ansiGreen + rest[:end] + ansiReset)
+			i += end
+		case unicode.IsDigit(r) && (i == 0 || !isWordByte(line[i-1])):
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			b.WriteString(ansiYellow + rest[:end] + ansiReset)
+			i += end
+		case isWordByte(rest[0]):
+			end := 1
+			for end < len(rest) && isWordByte(rest[end]) {
+				end++
+			}
+			if word := rest[:end]; syn.keywords[word] {
+				b.WriteString(ansiBlue + word + ansiReset)
+			} else if end < len(rest) && rest[end] == '(' {
+				b.WriteString(ansiMagenta + word + ansiReset)
+			} else {
+				b.WriteString(word)
+			}
+			i += end
+		default:
+			b.WriteString(rest[:size])
+			i += size
+		}
+	}
+	return b.String()
+}
+
+// lineComment reports whether a line comment starts at byte i. Comments starting with # must follow a
+// space, so they don't match inside words like $# or C#.
+func lineComment(syn *syntax, line string, i int) bool {
+	for _, prefix := range syn.lineComments {
+		if strings.HasPrefix(line[i:], prefix) && (prefix != "#" || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return true
+		}
+	}
+	return false
+}
+
+// stringEnd returns the end of the string literal starting with quote at s[0], or the end of the line.
+func stringEnd(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= utf8.RuneSelf
+}
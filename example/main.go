@@ -1,84 +1,152 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"github.com/hanyuancheung/gpt-go"
 	"github.com/spf13/cobra"
 )
 
-func main() {
-	log.SetOutput(new(NullWriter))
-	apiKey := getAPIKeyFromEnv()
-	ctx := context.Background()
-	client := gpt.NewClient(apiKey)
-	rootCmd := &cobra.Command{
-		Use:   "chatgpt",
-		Short: "Chat with ChatGPT in console.",
-		Run: func(cmd *cobra.Command, args []string) {
-			scanner := bufio.NewScanner(os.Stdin)
-			exit := false
-			for !exit {
-				fmt.Print("Please input question(q for exit): ")
-				if !scanner.Scan() {
-					break
-				}
-				questionParam := validateQuestion(scanner.Text())
-				switch questionParam {
-				case "q":
-					exit = true
-				case "":
-					continue
-				default:
-					GetResponse(client, ctx, questionParam)
-				}
-			}
-		},
+// options are the global flags, completed from the profile of the configuration file.
+type options struct {
+	configPath  string
+	profileName string
+	profile     *profile
+
+	model       string
+	system      string
+	temperature float32
+	maxTokens   int
+	session     string
+	raw         bool
+}
+
+// request returns a chat request with the model and sampling settings of the flags.
+func (o *options) request() gpt.ChatCompletionRequest {
+	return gpt.ChatCompletionRequest{
+		Model:       o.model,
+		Temperature: o.temperature,
+		MaxTokens:   o.maxTokens,
 	}
-	log.Fatal(rootCmd.Execute())
 }
 
-func getAPIKeyFromEnv() string {
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" {
-		panic("Missing API KEY")
+// modelFor returns the model of a command that doesn't chat: the --model flag if it was given, or def.
+// The model of the profile is a chat model, so it doesn't apply.
+func (o *options) modelFor(cmd *cobra.Command, def string) string {
+	if cmd.Flags().Changed("model") {
+		return o.model
 	}
-	return apiKey
+	return def
 }
 
-func validateQuestion(question string) string {
-	quest := strings.Trim(question, " ")
-	keywords := []string{"", "loop", "break", "continue", "cls", "exit", "block"}
-	for _, x := range keywords {
-		if quest == x {
-			return ""
-		}
+// configFile returns the path of the configuration file.
+func (o *options) configFile() (string, error) {
+	if o.configPath != "" {
+		return o.configPath, nil
+	}
+	return configPath()
+}
+
+// loadConfig reads the configuration file and returns it with the name of the selected profile.
+func (o *options) loadConfig() (*config, string, error) {
+	path, err := o.configFile()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, cfg.profileName(o.profileName), nil
+}
+
+// applyProfile loads the selected profile and takes the settings that weren't given as flags from it.
+func (o *options) applyProfile(changed func(flag string) bool) error {
+	cfg, name, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	p, err := cfg.lookup(name)
+	if err != nil {
+		return err
+	}
+	o.profile = p
+	if p.Model != "" && !changed("model") {
+		o.model = p.Model
+	}
+	if p.System != "" && !changed("system") {
+		o.system = p.System
+	}
+	if p.Temperature != 0 && !changed("temperature") {
+		o.temperature = p.Temperature
 	}
-	return quest
+	if p.MaxTokens != 0 && !changed("max-tokens") {
+		o.maxTokens = p.MaxTokens
+	}
+	return nil
 }
 
-// GetResponse get response from gpt3
-func GetResponse(client gpt.Client, ctx context.Context, question string) {
-	err := client.CompletionStreamWithEngine(ctx, &gpt.CompletionRequest{
-		Model: gpt.TextDavinci003Engine,
-		Prompt: []string{
-			question,
+// client returns a client for the selected profile.
+func (o *options) client() (gpt.Client, error) {
+	if o.profile == nil {
+		o.profile = &profile{}
+	}
+	return o.profile.client()
+}
+
+func main() {
+	log.SetOutput(new(NullWriter))
+	opts := &options{}
+	rootCmd := &cobra.Command{
+		Use:   "chatgpt",
+		Short: "Chat with ChatGPT in console.",
+		Long: "Chat with ChatGPT in console. Type /help in the chat for the slash commands; " +
+			"Ctrl-C stops the answer being written, Ctrl-D or /quit exits.",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			c := newChat(client, opts)
+			if opts.session != "" {
+				if err := c.resume(opts.session, cmd.Flags().Changed, opts); err != nil {
+					return err
+				}
+			}
+			return c.run(cmd.Context(), os.Stdin, os.Stdout)
 		},
-		MaxTokens:   3000,
-		Temperature: 0,
-	}, func(resp *gpt.CompletionResponse) {
-		fmt.Print(resp.Choices[0].Text)
+	}
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return opts.applyProfile(cmd.Flags().Changed)
+	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
 	})
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(13)
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&opts.configPath, "config", "", "configuration file, $XDG_CONFIG_HOME/gpt-go/config.yaml by default")
+	flags.StringVarP(&opts.profileName, "profile", "p", "", "profile of the configuration file to use")
+	flags.StringVarP(&opts.model, "model", "m", gpt.GPT4oMini, "model to chat with")
+	flags.StringVarP(&opts.system, "system", "s", "", "system prompt")
+	flags.Float32VarP(&opts.temperature, "temperature", "t", 0, "sampling temperature between 0 and 2, 0 for the model default")
+	flags.IntVar(&opts.maxTokens, "max-tokens", 0, "maximum tokens of an answer, 0 for no limit")
+	flags.BoolVar(&opts.raw, "raw", false, "print answers as is instead of rendering their Markdown")
+	rootCmd.Flags().StringVar(&opts.session, "session", "", "resume the named session, or start it, saving it after every change")
+	rootCmd.AddCommand(newAskCmd(opts), newSessionsCmd(), newConfigCmd(opts), newBatchCmd(opts),
+		newModelsCmd(opts), newEmbedCmd(opts), newImageCmd(opts), newEditCmd(opts), newModerateCmd(opts),
+		newTranscribeCmd(opts))
+	if err := rootCmd.Execute(); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(exitCode(err))
 	}
-	fmt.Printf("\n")
 }
 
 // NullWriter is a writer on which all Write calls succeed
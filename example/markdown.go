@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ANSI styles of the rendered Markdown.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiItalic  = "\x1b[3m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// answerWriter writes an answer as it is streamed. Flush writes what is held back at the end.
+type answerWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// newAnswerWriter returns a writer that renders Markdown for the terminal, or writes the answer as is when
+// raw is set, out is not a terminal or NO_COLOR is set.
+func newAnswerWriter(out io.Writer, raw bool) answerWriter {
+	if raw || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !isTerminal(out) {
+		return plainWriter{out}
+	}
+	return &markdownWriter{out: out}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type plainWriter struct {
+	io.Writer
+}
+
+func (plainWriter) Flush() error { return nil }
+
+// lineKind is the Markdown block of a line.
+type lineKind int
+
+const (
+	lineUndecided lineKind = iota
+	lineParagraph
+	lineHeading
+	lineQuote
+)
+
+// markdownWriter renders Markdown streamed in arbitrary pieces. Text is written as soon as its formatting
+// is known: a paragraph holds back an emphasis marker until its closing marker or the end of the line
+// shows whether it is one, while fence lines and table rows wait for their newline. Code is highlighted
+// line by line.
+type markdownWriter struct {
+	out     io.Writer
+	pending []byte
+	kind    lineKind
+	// inline styles of the current line, and the last byte of it seen
+	bold, italic, code bool
+	prev               byte
+	// fence is the marker of the open code block, lang its language
+	fence string
+	lang  string
+	// inComment is set inside a block comment spanning code lines
+	inComment bool
+	err       error
+}
+
+// Write implements io.Writer.
+func (m *markdownWriter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+	m.render(false)
+	return len(p), m.err
+}
+
+// Flush renders the rest of the answer.
+func (m *markdownWriter) Flush() error {
+	m.render(true)
+	if m.kind != lineUndecided {
+		m.endLine(false)
+	}
+	return m.err
+}
+
+func (m *markdownWriter) print(s string) {
+	if m.err == nil {
+		_, m.err = io.WriteString(m.out, s)
+	}
+}
+
+var (
+	fenceLine     = regexp.MustCompile("^\\s*(`{3,}|~{3,})\\s*([\\w+#.-]*)")
+	headingPrefix = regexp.MustCompile(`^#{1,6}\s`)
+	listPrefix    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s`)
+	rulePrefix    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	tableRule     = regexp.MustCompile(`^\s*:?-+:?\s*$`)
+)
+
+// render writes what can be rendered of the pending text. With final set nothing more will come.
+func (m *markdownWriter) render(final bool) {
+	for len(m.pending) > 0 {
+		newline := bytes.IndexByte(m.pending, '\n')
+		if m.fence != "" || m.kind == lineUndecided {
+			// code lines and line starts are handled whole, or as far as needed to know the block
+			if m.fence != "" {
+				if newline < 0 && !final {
+					return
+				}
+				m.codeLine(m.takeLine(newline), newline >= 0)
+				continue
+			}
+			if !m.startLine(newline, final) {
+				return
+			}
+			continue
+		}
+		if !m.inline(final) {
+			return
+		}
+	}
+}
+
+// takeLine removes the line ending at newline, or all pending text if there is no newline.
+func (m *markdownWriter) takeLine(newline int) string {
+	if newline < 0 {
+		line := string(m.pending)
+		m.pending = m.pending[:0]
+		return line
+	}
+	line := string(m.pending[:newline])
+	m.pending = m.pending[newline+1:]
+	return line
+}
+
+// startLine decides the block of the line at the start of the pending text, rendering whole lines and
+// the prefix of the others. It reports false if more text is needed to decide.
+func (m *markdownWriter) startLine(newline int, final bool) bool {
+	head := m.pending
+	if newline >= 0 {
+		head = head[:newline]
+	}
+	complete := newline >= 0 || final
+	trimmed := bytes.TrimLeft(head, " \t")
+	// a line of marker characters only may still become anything
+	if !complete && len(bytes.Trim(head, " \t-*+.)>#|`~_=:0123456789")) == 0 {
+		return false
+	}
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")):
+		if !complete {
+			return false
+		}
+		line := m.takeLine(newline)
+		match := fenceLine.FindStringSubmatch(line)
+		m.fence, m.lang, m.inComment = match[1], strings.ToLower(match[2]), false
+		m.print(ansiDim + line + ansiReset + lineEnd(newline))
+	case bytes.HasPrefix(trimmed, []byte("|")):
+		if !complete {
+			return false
+		}
+		m.tableRow(m.takeLine(newline), newline >= 0)
+	case complete && rulePrefix.Match(head):
+		m.takeLine(newline)
+		m.print(ansiDim + strings.Repeat("─", 40) + ansiReset + lineEnd(newline))
+	case headingPrefix.Match(trimmed):
+		level := bytes.IndexByte(trimmed, ' ')
+		m.pending = m.pending[len(head)-len(trimmed)+level+1:]
+		m.kind = lineHeading
+		m.print(m.style())
+	case bytes.HasPrefix(trimmed, []byte(">")):
+		m.pending = m.pending[len(head)-len(trimmed)+1:]
+		if len(m.pending) > 0 && m.pending[0] == ' ' {
+			m.pending = m.pending[1:]
+		}
+		m.kind = lineQuote
+		m.print(ansiDim + "│ " + m.style())
+	default:
+		m.kind = lineParagraph
+		if match := listPrefix.FindSubmatch(head); match != nil {
+			m.pending = m.pending[len(match[0]):]
+			bullet := string(match[2])
+			if strings.ContainsAny(bullet, "-*+") {
+				bullet = "•"
+			}
+			m.print(string(match[1]) + ansiYellow + bullet + ansiReset + " ")
+		}
+	}
+	return true
+}
+
+func lineEnd(newline int) string {
+	if newline < 0 {
+		return ""
+	}
+	return "\n"
+}
+
+// style returns the escape sequence of the current styles.
+func (m *markdownWriter) style() string {
+	s := ansiReset
+	switch m.kind {
+	case lineHeading:
+		s += ansiBold + ansiMagenta
+	case lineQuote:
+		s += ansiItalic
+	}
+	if m.bold {
+		s += ansiBold
+	}
+	if m.italic {
+		s += ansiItalic
+	}
+	if m.code {
+		s += ansiCyan
+	}
+	return s
+}
+
+// endLine resets the styles at the end of a line.
+func (m *markdownWriter) endLine(newline bool) {
+	m.kind = lineUndecided
+	m.bold, m.italic, m.code, m.prev = false, false, false, 0
+	m.print(ansiReset)
+	if newline {
+		m.print("\n")
+	}
+}
+
+// inline renders the pending text of a line with its emphasis and code spans. It reports false if it
+// stopped at a marker it can't interpret yet.
+func (m *markdownWriter) inline(final bool) bool {
+	text := m.pending
+	start := 0
+	flush := func(i int) {
+		if i > start {
+			m.print(string(text[start:i]))
+			m.prev = text[i-1]
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\n':
+			flush(i)
+			m.pending = text[i+1:]
+			m.endLine(true)
+			return true
+		case c == '`':
+			flush(i)
+			m.code = !m.code
+			m.print(m.style())
+			start = i + 1
+		case c == '*' && !m.code:
+			n := delimiterRun(text[i:])
+			if i+n == len(text) && !final {
+				flush(i)
+				m.pending = text[i:]
+				return false
+			}
+			prev := m.prev
+			if i > 0 {
+				prev = text[i-1]
+			}
+			next := byte(0)
+			if i+n < len(text) {
+				next = text[i+n]
+			}
+			bold, italic := n >= 2, n != 2
+			switch {
+			case n > 3:
+			case (!bold || m.bold) && (!italic || m.italic) && rightFlanking(prev, next):
+				flush(i)
+				m.bold, m.italic = m.bold && !bold, m.italic && !italic
+				m.print(m.style())
+				start = i + n
+			case (!bold || !m.bold) && (!italic || !m.italic) && leftFlanking(prev, next):
+				closed, complete := closingRun(text[i+n:], n)
+				if !closed && !complete && !final {
+					flush(i)
+					m.pending = text[i:]
+					return false
+				}
+				if closed {
+					flush(i)
+					m.bold, m.italic = m.bold || bold, m.italic || italic
+					m.print(m.style())
+					start = i + n
+				}
+			}
+			i += n - 1
+		}
+	}
+	flush(len(text))
+	m.pending = m.pending[:0]
+	return true
+}
+
+// delimiterRun returns the number of '*' text starts with.
+func delimiterRun(text []byte) int {
+	n := 0
+	for n < len(text) && text[n] == '*' {
+		n++
+	}
+	return n
+}
+
+// closingRun reports whether the rest of the line has a run of n '*' that can close emphasis, and whether
+// the line is complete in text.
+func closingRun(text []byte, n int) (closed, complete bool) {
+	code := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			return false, true
+		case '`':
+			code = !code
+		case '*':
+			run := delimiterRun(text[i:])
+			if i+run == len(text) {
+				return false, false
+			}
+			if !code && run == n && i > 0 && rightFlanking(text[i-1], text[i+run]) {
+				return true, true
+			}
+			i += run - 1
+		}
+	}
+	return false, false
+}
+
+// leftFlanking and rightFlanking report whether a run of '*' between prev and next can open or close
+// emphasis, following CommonMark. Zero stands for the start or end of the line. Unlike CommonMark, a run
+// between two letters or digits does neither, so products like 2*3*4 stay as they are.
+func leftFlanking(prev, next byte) bool {
+	return !isSpace(next) && (!isPunct(next) || isSpace(prev) || isPunct(prev)) && !(isWord(prev) && isWord(next))
+}
+
+func rightFlanking(prev, next byte) bool {
+	return !isSpace(prev) && (!isPunct(prev) || isSpace(next) || isPunct(next)) && !(isWord(prev) && isWord(next))
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == ' ' || c == '\t' || c == '\n'
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWord(c byte) bool {
+	return !isSpace(c) && !isPunct(c)
+}
+
+// tableRow renders a table row with its cells separated by box-drawing lines.
+func (m *markdownWriter) tableRow(line string, newline bool) {
+	cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+	rule := true
+	for _, cell := range cells {
+		rule = rule && tableRule.MatchString(cell)
+	}
+	sep := ansiDim + " │ " + ansiReset
+	var b strings.Builder
+	for i, cell := range cells {
+		if i > 0 {
+			if rule {
+				b.WriteString(ansiDim + "─┼─" + ansiReset)
+			} else {
+				b.WriteString(sep)
+			}
+		}
+		cell = strings.TrimSpace(cell)
+		if rule {
+			b.WriteString(ansiDim + strings.Repeat("─", len(cell)) + ansiReset)
+			continue
+		}
+		sub := &markdownWriter{out: &b, kind: lineParagraph, pending: []byte(cell)}
+		sub.inline(true)
+		b.WriteString(ansiReset)
+	}
+	if newline {
+		b.WriteString("\n")
+	}
+	m.print(b.String())
+}
+
+// codeLine renders a line of the open code block, or the fence closing it.
+func (m *markdownWriter) codeLine(line string, newline bool) {
+	end := ""
+	if newline {
+		end = "\n"
+	}
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, m.fence) && strings.Trim(trimmed, m.fence[:1]) == "" {
+		m.fence, m.lang = "", ""
+		m.print(ansiDim + line + ansiReset + end)
+		return
+	}
+	m.print(m.highlight(line) + end)
+}
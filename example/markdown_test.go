@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownWriterEmphasis(t *testing.T) {
+	const (
+		bold   = ansiReset + ansiBold
+		italic = ansiReset + ansiItalic
+		reset  = ansiReset
+	)
+	tests := []struct {
+		name, in, want string
+	}{
+		{"product", "2*3*4 = 24\n", "2*3*4 = 24" + reset + "\n"},
+		{"lone star", "a*b\n", "a*b" + reset + "\n"},
+		{"glob", "match *.go and *.md files\n", "match *.go and *.md files" + reset + "\n"},
+		{"unmatched at the end", "a *b\n", "a *b" + reset + "\n"},
+		{"spaced star", "a * b * c\n", "a * b * c" + reset + "\n"},
+		{"italic", "an *important* word\n", "an " + italic + "important" + reset + " word" + reset + "\n"},
+		{"bold", "**Note:** read it\n", bold + "Note:" + reset + " read it" + reset + "\n"},
+		{"nested", "**bold *both* bold**\n",
+			bold + "bold " + ansiReset + ansiBold + ansiItalic + "both" + bold + " bold" + reset + reset + "\n"},
+		{"bold and italic", "***all***\n", ansiReset + ansiBold + ansiItalic + "all" + reset + reset + "\n"},
+		{"star in code", "`a*b*c` *x*\n", ansiReset + ansiCyan + "a*b*c" + reset + " " + italic + "x" + reset + reset + "\n"},
+		{"closer in code", "*a `b*` c\n", "*a " + ansiReset + ansiCyan + "b*" + reset + " c" + reset + "\n"},
+		{"unclosed at the end of the answer", "say *hi", "say *hi" + reset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var whole strings.Builder
+			w := &markdownWriter{out: &whole}
+			if _, err := w.Write([]byte(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := whole.String(); got != tt.want {
+				t.Errorf("rendered %q as %q, want %q", tt.in, got, tt.want)
+			}
+
+			var streamed strings.Builder
+			w = &markdownWriter{out: &streamed}
+			for i := range tt.in {
+				if _, err := w.Write([]byte(tt.in[i : i+1])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := streamed.String(); got != tt.want {
+				t.Errorf("streamed %q as %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownWriterBlocks(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"heading", "# Title\n", ansiReset + ansiBold + ansiMagenta + "Title" + ansiReset + "\n"},
+		{"list", "- one\n* two\n", ansiYellow + "•" + ansiReset + " one" + ansiReset + "\n" +
+			ansiYellow + "•" + ansiReset + " two" + ansiReset + "\n"},
+		{"quote", "> said\n", ansiDim + "│ " + ansiReset + ansiItalic + "said" + ansiReset + "\n"},
+		{"rule", "***\n", ansiDim + strings.Repeat("─", 40) + ansiReset + "\n"},
+		{"table", "| a | b |\n|---|---|\n", "a" + ansiReset + ansiDim + " │ " + ansiReset + "b" + ansiReset + "\n" +
+			ansiDim + "───" + ansiReset + ansiDim + "─┼─" + ansiReset + ansiDim + "───" + ansiReset + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			w := &markdownWriter{out: &b}
+			if _, err := w.Write([]byte(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("rendered %q as %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
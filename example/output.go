@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the API commands. Every command supports a subset.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatNpy  = "npy"
+)
+
+// output holds the --format and --output flags shared by the API commands.
+type output struct {
+	format  string
+	formats []string
+	path    string
+}
+
+// addOutputFlags adds the output flags to cmd. The first format is the default.
+func addOutputFlags(cmd *cobra.Command, formats ...string) *output {
+	o := &output{format: formats[0], formats: formats}
+	cmd.Flags().StringVarP(&o.format, "format", "f", formats[0], "output format: "+strings.Join(formats, ", "))
+	cmd.Flags().StringVarP(&o.path, "output", "o", "", "file to write, standard output if empty")
+	return o
+}
+
+// validate checks the format before anything is sent.
+func (o *output) validate() error {
+	for _, format := range o.formats {
+		if o.format == format {
+			return nil
+		}
+	}
+	return usageError{fmt.Errorf("unknown format %q, use %s", o.format, strings.Join(o.formats, ", "))}
+}
+
+// write calls fn with the output file, or standard output.
+func (o *output) write(cmd *cobra.Command, fn func(w io.Writer) error) error {
+	if o.path == "" || o.path == "-" {
+		return fn(cmd.OutOrStdout())
+	}
+	file, err := os.Create(o.path)
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := fn(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return file.Close()
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeCSV writes one row per vector, its input followed by its values.
+func writeCSV(w io.Writer, inputs []string, vectors [][]float32) error {
+	out := csv.NewWriter(w)
+	for i, vector := range vectors {
+		row := make([]string, 0, len(vector)+1)
+		row = append(row, inputs[i])
+		for _, x := range vector {
+			row = append(row, strconv.FormatFloat(float64(x), 'g', -1, 32))
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeNpy writes the vectors as a float32 matrix in the NumPy .npy format, for numpy.load.
+func writeNpy(w io.Writer, vectors [][]float32) error {
+	dims := 0
+	if len(vectors) > 0 {
+		dims = len(vectors[0])
+	}
+	for _, vector := range vectors {
+		if len(vector) != dims {
+			return fmt.Errorf("embeddings have different dimensions %d and %d", dims, len(vector))
+		}
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(vectors), dims)
+	// the magic, version and header length take 10 bytes; the header is padded so data starts aligned
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	data := make([]byte, 0, 10+len(header)+4*len(vectors)*dims)
+	data = append(data, "\x93NUMPY\x01\x00"...)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(header)))
+	data = append(data, header...)
+	for _, vector := range vectors {
+		for _, x := range vector {
+			data = binary.LittleEndian.AppendUint32(data, math.Float32bits(x))
+		}
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteNpy(t *testing.T) {
+	tests := []struct {
+		name    string
+		vectors [][]float32
+		shape   string
+	}{
+		{"matrix", [][]float32{{1, -2.5, 3}, {0.25, 0, -1}}, "(2, 3)"},
+		{"one vector", [][]float32{{1.5}}, "(1, 1)"},
+		{"no vectors", nil, "(0, 0)"},
+		{"long header", make([][]float32, 123456), "(123456, 0)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeNpy(&b, tt.vectors); err != nil {
+				t.Fatal(err)
+			}
+			data := b.Bytes()
+			if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+				t.Fatalf("magic and version %q", data[:8])
+			}
+			headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+			start := 10 + headerLen
+			if start%64 != 0 {
+				t.Errorf("data starts at %d, want a multiple of 64", start)
+			}
+			header := string(data[10:start])
+			want := "{'descr': '<f4', 'fortran_order': False, 'shape': " + tt.shape + ", }"
+			if !strings.HasSuffix(header, "\n") || strings.TrimRight(header, " \n") != want {
+				t.Errorf("header %q, want %q padded with spaces and a newline", header, want)
+			}
+			var values []float32
+			for _, vector := range tt.vectors {
+				values = append(values, vector...)
+			}
+			if len(data)-start != 4*len(values) {
+				t.Fatalf("%d bytes of data, want %d", len(data)-start, 4*len(values))
+			}
+			for i, want := range values {
+				if got := math.Float32frombits(binary.LittleEndian.Uint32(data[start+4*i:])); got != want {
+					t.Errorf("value %d is %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+	if err := writeNpy(&bytes.Buffer{}, [][]float32{{1, 2}, {3}}); err == nil {
+		t.Error("wrote vectors of different dimensions")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := writeCSV(&b, []string{"plain", `with "quotes", and a comma`}, [][]float32{{0.1, -2}, {1e-7, 3.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "plain,0.1,-2\n\"with \"\"quotes\"\", and a comma\",1e-07,3.5\n"
+	if b.String() != want {
+		t.Errorf("CSV %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// session is a named conversation kept in the data directory, so it can be resumed later.
+type session struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	transcript
+}
+
+// errSessionNotFound is returned for a session that was never saved or was deleted.
+var errSessionNotFound = errors.New("session not found")
+
+var sessionName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// sessionDir returns the directory of the sessions, $XDG_DATA_HOME/gpt-go/sessions or
+// ~/.local/share/gpt-go/sessions.
+func sessionDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the data directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "gpt-go", "sessions"), nil
+}
+
+func sessionPath(name string) (string, error) {
+	if !sessionName.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// loadSession reads a saved session.
+func loadSession(name string) (*session, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", errSessionNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", name, err)
+	}
+	s := &session{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", name, err)
+	}
+	s.Name = name
+	return s, nil
+}
+
+// save writes the session to a temporary file first, so an interrupted save keeps the previous one.
+func (s *session) save() error {
+	path, err := sessionPath(s.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// listSessions returns the saved sessions, most recently updated first.
+func listSessions() ([]*session, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	var sessions []*session
+	for _, path := range paths {
+		s, err := loadSession(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// writeMarkdown writes the conversation of a session as a Markdown document.
+func (s *session) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", s.Name)
+	fmt.Fprintf(&b, "- Model: %s\n", s.Model)
+	if s.Temperature != 0 {
+		fmt.Fprintf(&b, "- Temperature: %g\n", s.Temperature)
+	}
+	fmt.Fprintf(&b, "- Created: %s\n", s.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Updated: %s\n", s.Updated.Format(time.RFC3339))
+	for _, msg := range s.Messages {
+		role := msg.Role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", role, strings.TrimSpace(msg.Content))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func newSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage the saved chat sessions.",
+		Long:  "Manage the saved chat sessions. Start or resume one with chatgpt --session NAME.",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the sessions, most recently used first.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := listSessions()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tMODEL\tMESSAGES\tUPDATED")
+			for _, s := range sessions {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.Model, len(s.Messages), s.Updated.Local().Format("2006-01-02 15:04"))
+			}
+			return w.Flush()
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show NAME",
+		Short: "Print the conversation of a session.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := loadSession(args[0])
+			if err != nil {
+				return err
+			}
+			return s.writeMarkdown(cmd.OutOrStdout())
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete NAME...",
+		Short: "Delete sessions.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				path, err := sessionPath(name)
+				if err != nil {
+					return err
+				}
+				if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("%w: %s", errSessionNotFound, name)
+				} else if err != nil {
+					return fmt.Errorf("failed to delete session %s: %w", name, err)
+				}
+			}
+			return nil
+		},
+	})
+	var output string
+	export := &cobra.Command{
+		Use:   "export NAME",
+		Short: "Export a session as Markdown.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := loadSession(args[0])
+			if err != nil {
+				return err
+			}
+			if output == "" || output == "-" {
+				return s.writeMarkdown(cmd.OutOrStdout())
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to export session %s: %w", s.Name, err)
+			}
+			if err := s.writeMarkdown(file); err != nil {
+				file.Close()
+				return fmt.Errorf("failed to export session %s: %w", s.Name, err)
+			}
+			return file.Close()
+		},
+	}
+	export.Flags().StringVarP(&output, "output", "o", "", "file to write, standard output if empty")
+	cmd.AddCommand(export)
+	return cmd
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+func testSession(name string, updated time.Time) *session {
+	return &session{
+		Name:    name,
+		Created: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Updated: updated,
+		transcript: transcript{
+			Model:       gpt.GPT4oMini,
+			Temperature: 0.5,
+			Messages: []gpt.ChatCompletionRequestMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: " Hello! \n"},
+			},
+		},
+	}
+}
+
+func TestSessionNames(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"work", true},
+		{"2024-05_notes.v2", true},
+		{"_draft", true},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"../escape", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"with space", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := sessionPath(tt.name)
+			if (err == nil) != tt.valid {
+				t.Fatalf("sessionPath(%q) = %q, %v, want valid %v", tt.name, path, err, tt.valid)
+			}
+			if tt.valid && filepath.Dir(path) != filepath.Join(os.Getenv("XDG_DATA_HOME"), "gpt-go", "sessions") {
+				t.Errorf("path %q outside the session directory", path)
+			}
+			if !tt.valid {
+				if err := (&session{Name: tt.name}).save(); err == nil {
+					t.Error("saved a session with an invalid name")
+				}
+			}
+		})
+	}
+}
+
+func TestSessionSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	if _, err := loadSession("missing"); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("loading a missing session: %v, want errSessionNotFound", err)
+	}
+	s := testSession("work", time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC))
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSession("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != s.Name || !loaded.Created.Equal(s.Created) || !loaded.Updated.Equal(s.Updated) ||
+		loaded.Model != s.Model || loaded.Temperature != s.Temperature || roles(loaded.Messages) != roles(s.Messages) {
+		t.Errorf("loaded %+v, want %+v", loaded, s)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "gpt-go", "sessions", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != "work.json" {
+		t.Errorf("session files %q, want work.json only", files)
+	}
+	if info, err := os.Stat(files[0]); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("session file mode %v, %v, want 0600", info.Mode(), err)
+	}
+
+	if err := os.WriteFile(files[0], []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSession("work"); err == nil || errors.Is(err, errSessionNotFound) {
+		t.Errorf("loading a corrupt session: %v, want a read error", err)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if sessions, err := listSessions(); err != nil || len(sessions) != 0 {
+		t.Fatalf("listSessions = %v, %v before any session was saved", sessions, err)
+	}
+	base := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	for _, s := range []struct {
+		name    string
+		updated time.Duration
+	}{{"old", 0}, {"newest", 2 * time.Hour}, {"middle", time.Hour}} {
+		if err := testSession(s.name, base.Add(s.updated)).save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions, err := listSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range sessions {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, " ") != "newest middle old" {
+		t.Errorf("sessions %q, want the most recently updated first", names)
+	}
+}
+
+func TestSessionsCmd(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := testSession("work", time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC)).save(); err != nil {
+		t.Fatal(err)
+	}
+	markdown := `# work
+
+- Model: gpt-4o-mini
+- Temperature: 0.5
+- Created: 2024-05-01T10:00:00Z
+- Updated: 2024-05-02T09:30:00Z
+
+## System
+
+Be brief.
+
+## User
+
+hi
+
+## Assistant
+
+Hello!
+`
+	exported := filepath.Join(t.TempDir(), "work.md")
+	tests := []struct {
+		name string
+		args []string
+		want string // the output, or the error if fails
+		fail bool
+	}{
+		{"list", []string{"list"}, "work  gpt-4o-mini  3", false},
+		{"show", []string{"show", "work"}, markdown, false},
+		{"export", []string{"export", "work"}, markdown, false},
+		{"export to a file", []string{"export", "work", "-o", exported}, "", false},
+		{"show a missing session", []string{"show", "missing"}, "session not found: missing", true},
+		{"invalid name", []string{"show", "../work"}, "invalid session name", true},
+		{"delete a missing session", []string{"delete", "missing"}, "session not found: missing", true},
+		{"delete", []string{"delete", "work"}, "", false},
+		{"list after delete", []string{"list"}, "NAME  MODEL  MESSAGES  UPDATED\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newSessionsCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetArgs(tt.args)
+			err := cmd.Execute()
+			if tt.fail {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("error %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.args[0] == "list" && !strings.Contains(out.String(), tt.want) || tt.args[0] != "list" && out.String() != tt.want {
+				t.Errorf("output %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+	if data, err := os.ReadFile(exported); err != nil || string(data) != markdown {
+		t.Errorf("exported file %q, %v, want the Markdown of the session", data, err)
+	}
+}
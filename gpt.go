@@ -5,10 +5,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -28,6 +33,9 @@ const (
 )
 
 const (
+	GPT4o                     = "gpt-4o"                        // GPT4o GPT-4o
+	GPT4oMini                 = "gpt-4o-mini"                   // GPT4oMini GPT-4o mini
+	GPT4Turbo                 = "gpt-4-turbo"                   // GPT4Turbo GPT-4 Turbo
 	GPT4                      = "gpt-4"                         // GPT4 GPT-4
 	GPT3Dot5Turbo             = "gpt-3.5-turbo"                 // GPT3Dot5Turbo GPT-3.5 Turbo
 	GPT3Dot5Turbo0301         = "gpt-3.5-turbo-0301"            // GPT3Dot5Turbo0301 GPT-3.5 Turbo 0301
@@ -48,6 +56,11 @@ const (
 	CodeSearchBabbageCode001  = "code-search-babbage-code-001"  // CodeSearchBabbageCode001 Code Search Babbage Code 001
 	CodeSearchBabbageText001  = "code-search-babbage-text-001"  // CodeSearchBabbageText001 Code Search Babbage Text 001
 	TextEmbeddingAda002       = "text-embedding-ada-002"        // TextEmbeddingAda002 Text Embedding Ada 002
+	TextEmbedding3Small       = "text-embedding-3-small"        // TextEmbedding3Small Text Embedding 3 Small
+	TextEmbedding3Large       = "text-embedding-3-large"        // TextEmbedding3Large Text Embedding 3 Large
+	OmniModerationLatest      = "omni-moderation-latest"        // OmniModerationLatest Omni Moderation Latest
+	TextModerationLatest      = "text-moderation-latest"        // TextModerationLatest Text Moderation Latest
+	Whisper1                  = "whisper-1"                     // Whisper1 Whisper 1
 )
 
 const (
@@ -66,6 +79,22 @@ const (
 	CreateImageResponseFormatB64JSON = "b64_json" // CreateImageResponseFormatB64JSON B64 JSON
 )
 
+// Transcription response formats defined by the OpenAI API. Formats other than TranscriptionFormatJSON
+// and TranscriptionFormatVerboseJSON are returned as is in TranscriptionResponse.Text.
+const (
+	TranscriptionFormatJSON        = "json"         // TranscriptionFormatJSON JSON with the text
+	TranscriptionFormatVerboseJSON = "verbose_json" // TranscriptionFormatVerboseJSON JSON with language, duration and segments
+	TranscriptionFormatText        = "text"         // TranscriptionFormatText plain text
+	TranscriptionFormatSRT         = "srt"          // TranscriptionFormatSRT SubRip subtitles
+	TranscriptionFormatVTT         = "vtt"          // TranscriptionFormatVTT WebVTT subtitles
+)
+
+// Embedding encoding formats defined by the OpenAI API.
+const (
+	EmbeddingEncodingFloat  = "float"  // EmbeddingEncodingFloat JSON arrays of numbers
+	EmbeddingEncodingBase64 = "base64" // EmbeddingEncodingBase64 base64 encoded little-endian float32s
+)
+
 // Client is an API client to communicate with the OpenAI gpt-3 APIs
 type Client interface {
 	// Engines lists the currently available engines, and provides basic information about each
@@ -112,15 +141,25 @@ type Client interface {
 
 	// Image returns an image using the provided request.
 	Image(ctx context.Context, request *ImageRequest) (*ImageResponse, error)
+
+	// Moderation classifies whether texts violate the usage policies.
+	Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error)
+
+	// Transcription transcribes audio into text in the language of the audio.
+	Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error)
 }
 
 type client struct {
 	baseURL       string
-	apiKey        string
+	credentials   CredentialProvider
 	userAgent     string
 	httpClient    *http.Client
 	defaultEngine string
 	idOrg         string
+	pool          *CredentialPool
+
+	searchEmbeddingModel string
+	searchCache          Cache
 }
 
 // NewClient returns a new OpenAI GPT-3 API client. An APIKey is required to use the client
@@ -130,7 +169,7 @@ func NewClient(apiKey string, options ...ClientOption) Client {
 	}
 	cli := &client{
 		userAgent:     defaultUserAgent,
-		apiKey:        apiKey,
+		credentials:   StaticCredential(apiKey),
 		baseURL:       defaultBaseURL,
 		httpClient:    httpClient,
 		defaultEngine: DefaultEngine,
@@ -185,6 +224,7 @@ func (c *client) ChatCompletion(ctx context.Context, request *ChatCompletionRequ
 		request.Model = GPT3Dot5Turbo
 	}
 	request.Stream = false
+	request.StreamOptions = nil
 	req, err := c.newRequest(ctx, "POST", "/chat/completions", &request)
 	if err != nil {
 		return nil, err
@@ -237,6 +277,7 @@ func (c *client) ChatCompletionStream(ctx context.Context, request *ChatCompleti
 		if err := json.Unmarshal(line, output); err != nil {
 			return fmt.Errorf("invalid json stream data: %v", err)
 		}
+		recordUsage(req.Context(), output)
 		onData(output)
 	}
 	return nil
@@ -250,6 +291,7 @@ func (c *client) Completion(ctx context.Context, request *CompletionRequest) (*C
 // CompletionWithEngine creates a completion with the specified engine.
 func (c *client) CompletionWithEngine(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
 	request.Stream = false
+	request.StreamOptions = nil
 	req, err := c.newRequest(ctx, "POST", "/completions", &request)
 	if err != nil {
 		return nil, err
@@ -310,6 +352,7 @@ func (c *client) CompletionStreamWithEngine(ctx context.Context, request *Comple
 		if err := json.Unmarshal(line, output); err != nil {
 			return fmt.Errorf("invalid json stream data: %v", err)
 		}
+		recordUsage(req.Context(), output)
 		onData(output)
 	}
 	return nil
@@ -332,28 +375,6 @@ func (c *client) Edits(ctx context.Context, request *EditsRequest) (*EditsRespon
 	return output, nil
 }
 
-// Search creates a search with the default engine.
-func (c *client) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
-	return c.SearchWithEngine(ctx, c.defaultEngine, request)
-}
-
-// SearchWithEngine performs a semantic search over a list of documents with the specified engine.
-func (c *client) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
-	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/engines/%s/search", engine), &request)
-	if err != nil {
-		return nil, err
-	}
-	rsp, err := c.performRequest(req)
-	if err != nil {
-		return nil, err
-	}
-	output := new(SearchResponse)
-	if err := getResponseObject(rsp, output); err != nil {
-		return nil, err
-	}
-	return output, nil
-}
-
 // Embeddings creates text embeddings for a supplied slice of inputs with a provided model.
 // See: https://beta.openai.com/docs/api-reference/embeddings
 func (c *client) Embeddings(ctx context.Context, request *EmbeddingsRequest) (*EmbeddingsResponse, error) {
@@ -389,12 +410,130 @@ func (c *client) Image(ctx context.Context, request *ImageRequest) (*ImageRespon
 	return &output, nil
 }
 
+// Moderation classifies whether texts violate the usage policies.
+func (c *client) Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error) {
+	if request.Model == "" {
+		request.Model = OmniModerationLatest
+	}
+	req, err := c.newRequest(ctx, "POST", "/moderations", request)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.performRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	output := new(ModerationResponse)
+	if err := getResponseObject(rsp, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Transcription transcribes audio into text. The audio is uploaded as multipart form.
+func (c *client) Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error) {
+	if request.Audio == nil {
+		return nil, errors.New("missing audio to transcribe")
+	}
+	if request.Model == "" {
+		request.Model = Whisper1
+	}
+	body, contentType, err := transcriptionForm(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequestWithBody(ctx, "POST", "/audio/transcriptions", contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.performRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	switch request.ResponseFormat {
+	case "", TranscriptionFormatJSON, TranscriptionFormatVerboseJSON:
+		output := new(TranscriptionResponse)
+		if err := getResponseObject(rsp, output); err != nil {
+			return nil, err
+		}
+		return output, nil
+	}
+	defer rsp.Body.Close()
+	text, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from body: %w", err)
+	}
+	return &TranscriptionResponse{Text: string(text)}, nil
+}
+
+// transcriptionForm encodes a transcription request as multipart form. The boundary is derived from the
+// content, so equal requests have equal bodies.
+func transcriptionForm(request *TranscriptionRequest) (*bytes.Buffer, string, error) {
+	audio, err := io.ReadAll(request.Audio)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read audio: %w", err)
+	}
+	fileName := request.FileName
+	if fileName == "" {
+		fileName = "audio"
+	}
+	fields := [][2]string{
+		{"model", request.Model},
+		{"language", request.Language},
+		{"prompt", request.Prompt},
+		{"response_format", request.ResponseFormat},
+	}
+	if request.Temperature != 0 {
+		fields = append(fields, [2]string{"temperature", strconv.FormatFloat(float64(request.Temperature), 'g', -1, 32)})
+	}
+	hash := sha256.New()
+	hash.Write(audio)
+	for _, field := range fields {
+		hash.Write([]byte(field[0] + "=" + field[1] + "\n"))
+	}
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	if err := form.SetBoundary(hex.EncodeToString(hash.Sum(nil))); err != nil {
+		return nil, "", err
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return nil, "", err
+		}
+	}
+	file, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := file.Write(audio); err != nil {
+		return nil, "", err
+	}
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, form.FormDataContentType(), nil
+}
+
 func (c *client) performRequest(req *http.Request) (*http.Response, error) {
 	rsp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	member := poolMemberFromContext(req.Context())
+	if rsp.StatusCode == http.StatusUnauthorized && member == nil {
+		rsp, err = c.retryUnauthorized(req, rsp)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if err := checkForSuccess(rsp); err != nil {
+		var apiErr APIError
+		if member != nil && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			member.pool.throttled(member, rsp, apiErr)
+		}
 		return nil, err
 	}
 	return rsp, nil
@@ -429,6 +568,9 @@ func getResponseObject(rsp *http.Response, v interface{}) error {
 	if err := json.NewDecoder(rsp.Body).Decode(v); err != nil {
 		return fmt.Errorf("invalid json response: %w", err)
 	}
+	if rsp.Request != nil {
+		recordUsage(rsp.Request.Context(), v)
+	}
 	return nil
 }
 
@@ -448,6 +590,10 @@ func (c *client) newRequest(ctx context.Context, method, path string, payload in
 	if err != nil {
 		return nil, err
 	}
+	return c.newRequestWithBody(ctx, method, path, "application/json", bodyReader)
+}
+
+func (c *client) newRequestWithBody(ctx context.Context, method, path, contentType string, bodyReader io.Reader) (*http.Request, error) {
 	url := c.baseURL + path
 	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
@@ -456,7 +602,47 @@ func (c *client) newRequest(ctx context.Context, method, path string, payload in
 	if len(c.idOrg) > 0 {
 		req.Header.Set("OpenAI-Organization", c.idOrg)
 	}
-	req.Header.Set("Content-type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Content-type", contentType)
+	if member := c.pool.pick(); member != nil {
+		if len(member.credential.Org) > 0 {
+			req.Header.Set("OpenAI-Organization", member.credential.Org)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", member.credential.APIKey))
+		return req.WithContext(context.WithValue(ctx, poolMemberKey{}, member)), nil
+	}
+	if err := c.authorize(req); err != nil {
+		return nil, err
+	}
 	return req, nil
 }
+
+// authorize sets the Authorization header from the client's credential provider.
+func (c *client) authorize(req *http.Request) error {
+	token, err := c.credentials.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+// retryUnauthorized invalidates a cached credential after a 401 and replays the request once with a
+// fresh token. If the provider doesn't cache tokens the original response is returned unchanged.
+func (c *client) retryUnauthorized(req *http.Request, rsp *http.Response) (*http.Response, error) {
+	invalidator, ok := c.credentials.(CredentialInvalidator)
+	if !ok || req.GetBody == nil {
+		return rsp, nil
+	}
+	rsp.Body.Close()
+	invalidator.Invalidate()
+	retry := req.Clone(req.Context())
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry.Body = body
+	if err := c.authorize(retry); err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(retry)
+}
@@ -0,0 +1,213 @@
+// Command mockgen generates gptmock's implementation of gpt.Client from the interface declaration, so
+// the mock picks up new methods by running go generate.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"text/template"
+	"unicode"
+)
+
+type param struct {
+	Name string
+	Type string
+}
+
+type method struct {
+	Name string
+	// Params are the parameters of the method, including the context
+	Params []param
+	// Results are the result types of the method
+	Results []string
+	// Stream is set for methods delivering data through a callback
+	Stream bool
+	// Request is the parameter matched by expectations, empty when the method has none
+	Request param
+	// Response is the non-error result, or the callback's argument type for streams
+	Response string
+	// Context and Callback are the names of the context and stream callback parameters
+	Context  string
+	Callback string
+}
+
+func main() {
+	src := flag.String("src", "../gpt.go", "file declaring the gpt.Client interface")
+	out := flag.String("out", "mock_gen.go", "output file")
+	iface := flag.String("interface", "Client", "name of the interface to mock")
+	flag.Parse()
+
+	methods, err := parseInterface(*src, *iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := mockTemplate.Execute(&buf, methods); err != nil {
+		log.Fatal(err)
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("generated invalid code: %v\n%s", err, buf.Bytes())
+	}
+	if err := os.WriteFile(*out, code, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseInterface(path, name string) ([]method, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var iface *ast.InterfaceType
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == name {
+			iface, _ = spec.Type.(*ast.InterfaceType)
+		}
+		return iface == nil
+	})
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found in %s", name, path)
+	}
+	var methods []method
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m := method{Name: field.Names[0].Name}
+		for _, p := range fn.Params.List {
+			typ := typeString(p.Type)
+			names := p.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("arg%d", len(m.Params)))}
+			}
+			for _, n := range names {
+				m.Params = append(m.Params, param{Name: n.Name, Type: typ})
+				if cb, ok := p.Type.(*ast.FuncType); ok {
+					m.Stream = true
+					m.Callback = n.Name
+					m.Response = typeString(cb.Params.List[0].Type)
+				} else if typ == "context.Context" {
+					m.Context = n.Name
+				} else {
+					m.Request = param{Name: n.Name, Type: typ}
+				}
+			}
+		}
+		if fn.Results != nil {
+			for _, r := range fn.Results.List {
+				m.Results = append(m.Results, typeString(r.Type))
+			}
+		}
+		if m.Context == "" {
+			return nil, fmt.Errorf("%s: method %s must take a context", fset.Position(field.Pos()), m.Name)
+		}
+		if !m.Stream {
+			if len(m.Results) != 2 || m.Results[0][0] != '*' {
+				return nil, fmt.Errorf("%s: method %s must return a pointer and an error", fset.Position(field.Pos()), m.Name)
+			}
+			m.Response = m.Results[0]
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+// typeString prints a type expression, qualifying identifiers exported by package gpt.
+func typeString(expr ast.Expr) string {
+	return types.ExprString(qualify(expr))
+}
+
+func qualify(expr ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if unicode.IsUpper(rune(e.Name[0])) {
+			return &ast.SelectorExpr{X: ast.NewIdent("gpt"), Sel: e}
+		}
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(e.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: e.Len, Elt: qualify(e.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: qualify(e.Key), Value: qualify(e.Value)}
+	case *ast.FuncType:
+		params := &ast.FieldList{}
+		for _, p := range e.Params.List {
+			params.List = append(params.List, &ast.Field{Names: p.Names, Type: qualify(p.Type)})
+		}
+		return &ast.FuncType{Params: params, Results: e.Results}
+	}
+	return expr
+}
+
+var mockTemplate = template.Must(template.New("mock").Funcs(template.FuncMap{
+	"lower": func(s string) string { return string(unicode.ToLower(rune(s[0]))) + s[1:] },
+}).Parse(`// Code generated by mockgen from the gpt.Client interface. DO NOT EDIT.
+
+package gptmock
+
+import (
+	"context"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Client is a programmable implementation of gpt.Client. Each call is recorded and answered by the
+// first matching expectation, then by the method's function field, and fails with ErrUnexpectedCall
+// otherwise.
+type Client struct {
+{{- range .}}
+	// {{.Name}}Func is called by {{.Name}} when no expectation matches
+	{{.Name}}Func func({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Type}}{{end}}) {{if .Stream}}error{{else}}({{index .Results 0}}, error){{end}}
+{{- end}}
+
+	recorder
+{{- range .}}
+	{{lower .Name}}Expectations []*{{if .Stream}}StreamExpectation{{else}}Expectation{{end}}[{{if .Request.Type}}{{.Request.Type}}{{else}}struct{}{{end}}, {{.Response}}]
+{{- end}}
+}
+
+var _ gpt.Client = (*Client)(nil)
+{{range .}}
+// Expect{{.Name}} registers an expectation for calls to {{.Name}}.
+func (m *Client) Expect{{.Name}}() *{{if .Stream}}StreamExpectation{{else}}Expectation{{end}}[{{if .Request.Type}}{{.Request.Type}}{{else}}struct{}{{end}}, {{.Response}}] {
+	e := new{{if .Stream}}Stream{{end}}Expectation[{{if .Request.Type}}{{.Request.Type}}{{else}}struct{}{{end}}, {{.Response}}]("{{.Name}}")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.{{lower .Name}}Expectations = append(m.{{lower .Name}}Expectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// {{.Name}} implements gpt.Client.
+func (m *Client) {{.Name}}({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Name}} {{$p.Type}}{{end}}) {{if .Stream}}error{{else}}({{index .Results 0}}, error){{end}} {
+	m.record("{{.Name}}"{{range .Params}}, {{.Name}}{{end}})
+{{- if .Stream}}
+	if e := match(&m.mu, &m.{{lower .Name}}Expectations, {{if .Request.Name}}{{.Request.Name}}{{else}}struct{}{}{{end}}); e != nil {
+		return e.emit({{.Context}}, {{.Callback}})
+	}
+	if m.{{.Name}}Func != nil {
+		return m.{{.Name}}Func({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Name}}{{end}})
+	}
+	return unexpected("{{.Name}}")
+{{- else}}
+	if e := match(&m.mu, &m.{{lower .Name}}Expectations, {{if .Request.Name}}{{.Request.Name}}{{else}}struct{}{}{{end}}); e != nil {
+		return e.response, e.err
+	}
+	if m.{{.Name}}Func != nil {
+		return m.{{.Name}}Func({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Name}}{{end}})
+	}
+	return nil, unexpected("{{.Name}}")
+{{- end}}
+}
+{{end}}`))
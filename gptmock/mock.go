@@ -0,0 +1,276 @@
+// Package gptmock provides a programmable mock of gpt.Client. The mock is generated from the interface
+// declaration, so it has a function field and an Expect method for every method of gpt.Client:
+//
+//	mock := gptmock.New()
+//	mock.ExpectChatCompletion().WithModel(gpt.GPT4).Return(&gpt.ChatCompletionResponse{...}, nil)
+//	mock.ExpectChatCompletionStream().Chunks(gptmock.ChatChunks("Hello", " world")...)
+//	...
+//	mock.AssertExpectations(t)
+package gptmock
+
+//go:generate go run ./internal/mockgen -src ../gpt.go -out mock_gen.go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// ErrUnexpectedCall is returned by methods called without a matching expectation or function field.
+var ErrUnexpectedCall = errors.New("gptmock: unexpected call")
+
+// New returns a mock without expectations.
+func New() *Client {
+	return &Client{}
+}
+
+// Call is a recorded call to the mock.
+type Call struct {
+	// Method is the name of the gpt.Client method
+	Method string
+	// Args are the arguments of the call, including the context
+	Args []interface{}
+}
+
+type expectation interface {
+	satisfied() bool
+	String() string
+}
+
+// recorder keeps the calls and expectations of a mock.
+type recorder struct {
+	mu           sync.Mutex
+	calls        []Call
+	expectations []expectation
+}
+
+func (r *recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the calls made to the mock in order.
+func (r *recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the calls made to the named method.
+func (r *recorder) CallsTo(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []Call
+	for _, call := range r.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// AssertExpectations fails the test for every expectation that wasn't called as often as required.
+func (r *recorder) AssertExpectations(t testing.TB) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.expectations {
+		if !e.satisfied() {
+			t.Errorf("gptmock: unmet expectation %s", e)
+		}
+	}
+}
+
+func unexpected(method string) error {
+	return fmt.Errorf("%w to %s", ErrUnexpectedCall, method)
+}
+
+// matcher is the matching part shared by Expectation and StreamExpectation.
+type matcher[Req any] struct {
+	method   string
+	matchers []func(Req) bool
+	times    int
+	calls    int
+}
+
+// matches reports whether the request matches and the expectation has calls left, consuming one.
+// Callers hold the mock's lock.
+func (m *matcher[Req]) matches(req Req) bool {
+	if m.times > 0 && m.calls >= m.times {
+		return false
+	}
+	for _, match := range m.matchers {
+		if !match(req) {
+			return false
+		}
+	}
+	m.calls++
+	return true
+}
+
+func (m *matcher[Req]) satisfied() bool {
+	if m.times > 0 {
+		return m.calls == m.times
+	}
+	return m.calls > 0
+}
+
+func (m *matcher[Req]) String() string {
+	if m.times > 0 {
+		return fmt.Sprintf("%s: called %d of %d times", m.method, m.calls, m.times)
+	}
+	return fmt.Sprintf("%s: never called", m.method)
+}
+
+// modelMatcher matches requests whose Model field, or the request itself for engine names, equals model.
+func modelMatcher[Req any](model string) func(Req) bool {
+	return func(req Req) bool {
+		v := reflect.ValueOf(req)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.String:
+			return v.String() == model
+		case reflect.Struct:
+			field := v.FieldByName("Model")
+			return field.IsValid() && field.Kind() == reflect.String && field.String() == model
+		}
+		return false
+	}
+}
+
+// Expectation is the expected answer to calls of a method returning a response.
+type Expectation[Req any, Rsp any] struct {
+	matcher[Req]
+	response Rsp
+	err      error
+}
+
+func newExpectation[Req any, Rsp any](method string) *Expectation[Req, Rsp] {
+	return &Expectation[Req, Rsp]{matcher: matcher[Req]{method: method}}
+}
+
+// With restricts the expectation to requests accepted by match.
+func (e *Expectation[Req, Rsp]) With(match func(Req) bool) *Expectation[Req, Rsp] {
+	e.matchers = append(e.matchers, match)
+	return e
+}
+
+// WithModel restricts the expectation to requests for the given model.
+func (e *Expectation[Req, Rsp]) WithModel(model string) *Expectation[Req, Rsp] {
+	return e.With(modelMatcher[Req](model))
+}
+
+// Times limits the expectation to n calls. By default it answers any number of calls.
+func (e *Expectation[Req, Rsp]) Times(n int) *Expectation[Req, Rsp] {
+	e.times = n
+	return e
+}
+
+// Return sets the response and error returned to matching calls.
+func (e *Expectation[Req, Rsp]) Return(response Rsp, err error) *Expectation[Req, Rsp] {
+	e.response, e.err = response, err
+	return e
+}
+
+// StreamExpectation is the expected answer to calls of a streaming method.
+type StreamExpectation[Req any, Chunk any] struct {
+	matcher[Req]
+	chunks []Chunk
+	err    error
+}
+
+func newStreamExpectation[Req any, Chunk any](method string) *StreamExpectation[Req, Chunk] {
+	return &StreamExpectation[Req, Chunk]{matcher: matcher[Req]{method: method}}
+}
+
+// With restricts the expectation to requests accepted by match.
+func (e *StreamExpectation[Req, Chunk]) With(match func(Req) bool) *StreamExpectation[Req, Chunk] {
+	e.matchers = append(e.matchers, match)
+	return e
+}
+
+// WithModel restricts the expectation to requests for the given model.
+func (e *StreamExpectation[Req, Chunk]) WithModel(model string) *StreamExpectation[Req, Chunk] {
+	return e.With(modelMatcher[Req](model))
+}
+
+// Times limits the expectation to n calls. By default it answers any number of calls.
+func (e *StreamExpectation[Req, Chunk]) Times(n int) *StreamExpectation[Req, Chunk] {
+	e.times = n
+	return e
+}
+
+// Chunks sets the chunks passed to onData, in order, by matching calls.
+func (e *StreamExpectation[Req, Chunk]) Chunks(chunks ...Chunk) *StreamExpectation[Req, Chunk] {
+	e.chunks = chunks
+	return e
+}
+
+// Return sets the error returned to matching calls after all chunks have been emitted.
+func (e *StreamExpectation[Req, Chunk]) Return(err error) *StreamExpectation[Req, Chunk] {
+	e.err = err
+	return e
+}
+
+// emit passes the chunks to onData, stopping early if ctx is cancelled.
+func (e *StreamExpectation[Req, Chunk]) emit(ctx context.Context, onData func(Chunk)) error {
+	for _, chunk := range e.chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		onData(chunk)
+	}
+	return e.err
+}
+
+// match returns the first expectation that accepts req.
+func match[Req any, E interface{ matches(Req) bool }](mu *sync.Mutex, expectations *[]E, req Req) E {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range *expectations {
+		if e.matches(req) {
+			return e
+		}
+	}
+	var none E
+	return none
+}
+
+// ChatChunks returns chat completion stream chunks delivering the given deltas.
+func ChatChunks(deltas ...string) []*gpt.ChatCompletionStreamResponse {
+	chunks := make([]*gpt.ChatCompletionStreamResponse, 0, len(deltas))
+	for i, delta := range deltas {
+		msg := gpt.ChatCompletionResponseMessage{Content: delta}
+		if i == 0 {
+			msg.Role = "assistant"
+		}
+		chunks = append(chunks, &gpt.ChatCompletionStreamResponse{
+			Object:  "chat.completion.chunk",
+			Choices: []gpt.ChatCompletionStreamResponseChoice{{Delta: msg}},
+		})
+	}
+	return chunks
+}
+
+// CompletionChunks returns completion stream chunks delivering the given texts.
+func CompletionChunks(texts ...string) []*gpt.CompletionResponse {
+	chunks := make([]*gpt.CompletionResponse, 0, len(texts))
+	for _, text := range texts {
+		chunks = append(chunks, &gpt.CompletionResponse{
+			Object:  "text_completion",
+			Choices: []gpt.CompletionResponseChoice{{Text: text}},
+		})
+	}
+	return chunks
+}
@@ -0,0 +1,394 @@
+// Code generated by mockgen from the gpt.Client interface. DO NOT EDIT.
+
+package gptmock
+
+import (
+	"context"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Client is a programmable implementation of gpt.Client. Each call is recorded and answered by the
+// first matching expectation, then by the method's function field, and fails with ErrUnexpectedCall
+// otherwise.
+type Client struct {
+	// EnginesFunc is called by Engines when no expectation matches
+	EnginesFunc func(context.Context) (*gpt.EnginesResponse, error)
+	// EngineFunc is called by Engine when no expectation matches
+	EngineFunc func(context.Context, string) (*gpt.EngineObject, error)
+	// ChatCompletionFunc is called by ChatCompletion when no expectation matches
+	ChatCompletionFunc func(context.Context, *gpt.ChatCompletionRequest) (*gpt.ChatCompletionResponse, error)
+	// ChatCompletionStreamFunc is called by ChatCompletionStream when no expectation matches
+	ChatCompletionStreamFunc func(context.Context, *gpt.ChatCompletionRequest, func(*gpt.ChatCompletionStreamResponse)) error
+	// CompletionFunc is called by Completion when no expectation matches
+	CompletionFunc func(context.Context, *gpt.CompletionRequest) (*gpt.CompletionResponse, error)
+	// CompletionStreamFunc is called by CompletionStream when no expectation matches
+	CompletionStreamFunc func(context.Context, *gpt.CompletionRequest, func(*gpt.CompletionResponse)) error
+	// CompletionWithEngineFunc is called by CompletionWithEngine when no expectation matches
+	CompletionWithEngineFunc func(context.Context, *gpt.CompletionRequest) (*gpt.CompletionResponse, error)
+	// CompletionStreamWithEngineFunc is called by CompletionStreamWithEngine when no expectation matches
+	CompletionStreamWithEngineFunc func(context.Context, *gpt.CompletionRequest, func(*gpt.CompletionResponse)) error
+	// EditsFunc is called by Edits when no expectation matches
+	EditsFunc func(context.Context, *gpt.EditsRequest) (*gpt.EditsResponse, error)
+	// SearchFunc is called by Search when no expectation matches
+	SearchFunc func(context.Context, *gpt.SearchRequest) (*gpt.SearchResponse, error)
+	// SearchWithEngineFunc is called by SearchWithEngine when no expectation matches
+	SearchWithEngineFunc func(context.Context, string, *gpt.SearchRequest) (*gpt.SearchResponse, error)
+	// EmbeddingsFunc is called by Embeddings when no expectation matches
+	EmbeddingsFunc func(context.Context, *gpt.EmbeddingsRequest) (*gpt.EmbeddingsResponse, error)
+	// ImageFunc is called by Image when no expectation matches
+	ImageFunc func(context.Context, *gpt.ImageRequest) (*gpt.ImageResponse, error)
+	// ModerationFunc is called by Moderation when no expectation matches
+	ModerationFunc func(context.Context, *gpt.ModerationRequest) (*gpt.ModerationResponse, error)
+	// TranscriptionFunc is called by Transcription when no expectation matches
+	TranscriptionFunc func(context.Context, *gpt.TranscriptionRequest) (*gpt.TranscriptionResponse, error)
+
+	recorder
+	enginesExpectations                    []*Expectation[struct{}, *gpt.EnginesResponse]
+	engineExpectations                     []*Expectation[string, *gpt.EngineObject]
+	chatCompletionExpectations             []*Expectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionResponse]
+	chatCompletionStreamExpectations       []*StreamExpectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionStreamResponse]
+	completionExpectations                 []*Expectation[*gpt.CompletionRequest, *gpt.CompletionResponse]
+	completionStreamExpectations           []*StreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]
+	completionWithEngineExpectations       []*Expectation[*gpt.CompletionRequest, *gpt.CompletionResponse]
+	completionStreamWithEngineExpectations []*StreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]
+	editsExpectations                      []*Expectation[*gpt.EditsRequest, *gpt.EditsResponse]
+	searchExpectations                     []*Expectation[*gpt.SearchRequest, *gpt.SearchResponse]
+	searchWithEngineExpectations           []*Expectation[*gpt.SearchRequest, *gpt.SearchResponse]
+	embeddingsExpectations                 []*Expectation[*gpt.EmbeddingsRequest, *gpt.EmbeddingsResponse]
+	imageExpectations                      []*Expectation[*gpt.ImageRequest, *gpt.ImageResponse]
+	moderationExpectations                 []*Expectation[*gpt.ModerationRequest, *gpt.ModerationResponse]
+	transcriptionExpectations              []*Expectation[*gpt.TranscriptionRequest, *gpt.TranscriptionResponse]
+}
+
+var _ gpt.Client = (*Client)(nil)
+
+// ExpectEngines registers an expectation for calls to Engines.
+func (m *Client) ExpectEngines() *Expectation[struct{}, *gpt.EnginesResponse] {
+	e := newExpectation[struct{}, *gpt.EnginesResponse]("Engines")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enginesExpectations = append(m.enginesExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Engines implements gpt.Client.
+func (m *Client) Engines(ctx context.Context) (*gpt.EnginesResponse, error) {
+	m.record("Engines", ctx)
+	if e := match(&m.mu, &m.enginesExpectations, struct{}{}); e != nil {
+		return e.response, e.err
+	}
+	if m.EnginesFunc != nil {
+		return m.EnginesFunc(ctx)
+	}
+	return nil, unexpected("Engines")
+}
+
+// ExpectEngine registers an expectation for calls to Engine.
+func (m *Client) ExpectEngine() *Expectation[string, *gpt.EngineObject] {
+	e := newExpectation[string, *gpt.EngineObject]("Engine")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.engineExpectations = append(m.engineExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Engine implements gpt.Client.
+func (m *Client) Engine(ctx context.Context, engine string) (*gpt.EngineObject, error) {
+	m.record("Engine", ctx, engine)
+	if e := match(&m.mu, &m.engineExpectations, engine); e != nil {
+		return e.response, e.err
+	}
+	if m.EngineFunc != nil {
+		return m.EngineFunc(ctx, engine)
+	}
+	return nil, unexpected("Engine")
+}
+
+// ExpectChatCompletion registers an expectation for calls to ChatCompletion.
+func (m *Client) ExpectChatCompletion() *Expectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionResponse] {
+	e := newExpectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionResponse]("ChatCompletion")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chatCompletionExpectations = append(m.chatCompletionExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// ChatCompletion implements gpt.Client.
+func (m *Client) ChatCompletion(ctx context.Context, request *gpt.ChatCompletionRequest) (*gpt.ChatCompletionResponse, error) {
+	m.record("ChatCompletion", ctx, request)
+	if e := match(&m.mu, &m.chatCompletionExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.ChatCompletionFunc != nil {
+		return m.ChatCompletionFunc(ctx, request)
+	}
+	return nil, unexpected("ChatCompletion")
+}
+
+// ExpectChatCompletionStream registers an expectation for calls to ChatCompletionStream.
+func (m *Client) ExpectChatCompletionStream() *StreamExpectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionStreamResponse] {
+	e := newStreamExpectation[*gpt.ChatCompletionRequest, *gpt.ChatCompletionStreamResponse]("ChatCompletionStream")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chatCompletionStreamExpectations = append(m.chatCompletionStreamExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// ChatCompletionStream implements gpt.Client.
+func (m *Client) ChatCompletionStream(ctx context.Context, request *gpt.ChatCompletionRequest, onData func(*gpt.ChatCompletionStreamResponse)) error {
+	m.record("ChatCompletionStream", ctx, request, onData)
+	if e := match(&m.mu, &m.chatCompletionStreamExpectations, request); e != nil {
+		return e.emit(ctx, onData)
+	}
+	if m.ChatCompletionStreamFunc != nil {
+		return m.ChatCompletionStreamFunc(ctx, request, onData)
+	}
+	return unexpected("ChatCompletionStream")
+}
+
+// ExpectCompletion registers an expectation for calls to Completion.
+func (m *Client) ExpectCompletion() *Expectation[*gpt.CompletionRequest, *gpt.CompletionResponse] {
+	e := newExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]("Completion")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completionExpectations = append(m.completionExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Completion implements gpt.Client.
+func (m *Client) Completion(ctx context.Context, request *gpt.CompletionRequest) (*gpt.CompletionResponse, error) {
+	m.record("Completion", ctx, request)
+	if e := match(&m.mu, &m.completionExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.CompletionFunc != nil {
+		return m.CompletionFunc(ctx, request)
+	}
+	return nil, unexpected("Completion")
+}
+
+// ExpectCompletionStream registers an expectation for calls to CompletionStream.
+func (m *Client) ExpectCompletionStream() *StreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse] {
+	e := newStreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]("CompletionStream")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completionStreamExpectations = append(m.completionStreamExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// CompletionStream implements gpt.Client.
+func (m *Client) CompletionStream(ctx context.Context, request *gpt.CompletionRequest, onData func(*gpt.CompletionResponse)) error {
+	m.record("CompletionStream", ctx, request, onData)
+	if e := match(&m.mu, &m.completionStreamExpectations, request); e != nil {
+		return e.emit(ctx, onData)
+	}
+	if m.CompletionStreamFunc != nil {
+		return m.CompletionStreamFunc(ctx, request, onData)
+	}
+	return unexpected("CompletionStream")
+}
+
+// ExpectCompletionWithEngine registers an expectation for calls to CompletionWithEngine.
+func (m *Client) ExpectCompletionWithEngine() *Expectation[*gpt.CompletionRequest, *gpt.CompletionResponse] {
+	e := newExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]("CompletionWithEngine")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completionWithEngineExpectations = append(m.completionWithEngineExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// CompletionWithEngine implements gpt.Client.
+func (m *Client) CompletionWithEngine(ctx context.Context, request *gpt.CompletionRequest) (*gpt.CompletionResponse, error) {
+	m.record("CompletionWithEngine", ctx, request)
+	if e := match(&m.mu, &m.completionWithEngineExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.CompletionWithEngineFunc != nil {
+		return m.CompletionWithEngineFunc(ctx, request)
+	}
+	return nil, unexpected("CompletionWithEngine")
+}
+
+// ExpectCompletionStreamWithEngine registers an expectation for calls to CompletionStreamWithEngine.
+func (m *Client) ExpectCompletionStreamWithEngine() *StreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse] {
+	e := newStreamExpectation[*gpt.CompletionRequest, *gpt.CompletionResponse]("CompletionStreamWithEngine")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completionStreamWithEngineExpectations = append(m.completionStreamWithEngineExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// CompletionStreamWithEngine implements gpt.Client.
+func (m *Client) CompletionStreamWithEngine(ctx context.Context, request *gpt.CompletionRequest, onData func(*gpt.CompletionResponse)) error {
+	m.record("CompletionStreamWithEngine", ctx, request, onData)
+	if e := match(&m.mu, &m.completionStreamWithEngineExpectations, request); e != nil {
+		return e.emit(ctx, onData)
+	}
+	if m.CompletionStreamWithEngineFunc != nil {
+		return m.CompletionStreamWithEngineFunc(ctx, request, onData)
+	}
+	return unexpected("CompletionStreamWithEngine")
+}
+
+// ExpectEdits registers an expectation for calls to Edits.
+func (m *Client) ExpectEdits() *Expectation[*gpt.EditsRequest, *gpt.EditsResponse] {
+	e := newExpectation[*gpt.EditsRequest, *gpt.EditsResponse]("Edits")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.editsExpectations = append(m.editsExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Edits implements gpt.Client.
+func (m *Client) Edits(ctx context.Context, request *gpt.EditsRequest) (*gpt.EditsResponse, error) {
+	m.record("Edits", ctx, request)
+	if e := match(&m.mu, &m.editsExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.EditsFunc != nil {
+		return m.EditsFunc(ctx, request)
+	}
+	return nil, unexpected("Edits")
+}
+
+// ExpectSearch registers an expectation for calls to Search.
+func (m *Client) ExpectSearch() *Expectation[*gpt.SearchRequest, *gpt.SearchResponse] {
+	e := newExpectation[*gpt.SearchRequest, *gpt.SearchResponse]("Search")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searchExpectations = append(m.searchExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Search implements gpt.Client.
+func (m *Client) Search(ctx context.Context, request *gpt.SearchRequest) (*gpt.SearchResponse, error) {
+	m.record("Search", ctx, request)
+	if e := match(&m.mu, &m.searchExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.SearchFunc != nil {
+		return m.SearchFunc(ctx, request)
+	}
+	return nil, unexpected("Search")
+}
+
+// ExpectSearchWithEngine registers an expectation for calls to SearchWithEngine.
+func (m *Client) ExpectSearchWithEngine() *Expectation[*gpt.SearchRequest, *gpt.SearchResponse] {
+	e := newExpectation[*gpt.SearchRequest, *gpt.SearchResponse]("SearchWithEngine")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searchWithEngineExpectations = append(m.searchWithEngineExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// SearchWithEngine implements gpt.Client.
+func (m *Client) SearchWithEngine(ctx context.Context, engine string, request *gpt.SearchRequest) (*gpt.SearchResponse, error) {
+	m.record("SearchWithEngine", ctx, engine, request)
+	if e := match(&m.mu, &m.searchWithEngineExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.SearchWithEngineFunc != nil {
+		return m.SearchWithEngineFunc(ctx, engine, request)
+	}
+	return nil, unexpected("SearchWithEngine")
+}
+
+// ExpectEmbeddings registers an expectation for calls to Embeddings.
+func (m *Client) ExpectEmbeddings() *Expectation[*gpt.EmbeddingsRequest, *gpt.EmbeddingsResponse] {
+	e := newExpectation[*gpt.EmbeddingsRequest, *gpt.EmbeddingsResponse]("Embeddings")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.embeddingsExpectations = append(m.embeddingsExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Embeddings implements gpt.Client.
+func (m *Client) Embeddings(ctx context.Context, request *gpt.EmbeddingsRequest) (*gpt.EmbeddingsResponse, error) {
+	m.record("Embeddings", ctx, request)
+	if e := match(&m.mu, &m.embeddingsExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.EmbeddingsFunc != nil {
+		return m.EmbeddingsFunc(ctx, request)
+	}
+	return nil, unexpected("Embeddings")
+}
+
+// ExpectImage registers an expectation for calls to Image.
+func (m *Client) ExpectImage() *Expectation[*gpt.ImageRequest, *gpt.ImageResponse] {
+	e := newExpectation[*gpt.ImageRequest, *gpt.ImageResponse]("Image")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.imageExpectations = append(m.imageExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Image implements gpt.Client.
+func (m *Client) Image(ctx context.Context, request *gpt.ImageRequest) (*gpt.ImageResponse, error) {
+	m.record("Image", ctx, request)
+	if e := match(&m.mu, &m.imageExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.ImageFunc != nil {
+		return m.ImageFunc(ctx, request)
+	}
+	return nil, unexpected("Image")
+}
+
+// ExpectModeration registers an expectation for calls to Moderation.
+func (m *Client) ExpectModeration() *Expectation[*gpt.ModerationRequest, *gpt.ModerationResponse] {
+	e := newExpectation[*gpt.ModerationRequest, *gpt.ModerationResponse]("Moderation")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.moderationExpectations = append(m.moderationExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Moderation implements gpt.Client.
+func (m *Client) Moderation(ctx context.Context, request *gpt.ModerationRequest) (*gpt.ModerationResponse, error) {
+	m.record("Moderation", ctx, request)
+	if e := match(&m.mu, &m.moderationExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.ModerationFunc != nil {
+		return m.ModerationFunc(ctx, request)
+	}
+	return nil, unexpected("Moderation")
+}
+
+// ExpectTranscription registers an expectation for calls to Transcription.
+func (m *Client) ExpectTranscription() *Expectation[*gpt.TranscriptionRequest, *gpt.TranscriptionResponse] {
+	e := newExpectation[*gpt.TranscriptionRequest, *gpt.TranscriptionResponse]("Transcription")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcriptionExpectations = append(m.transcriptionExpectations, e)
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Transcription implements gpt.Client.
+func (m *Client) Transcription(ctx context.Context, request *gpt.TranscriptionRequest) (*gpt.TranscriptionResponse, error) {
+	m.record("Transcription", ctx, request)
+	if e := match(&m.mu, &m.transcriptionExpectations, request); e != nil {
+		return e.response, e.err
+	}
+	if m.TranscriptionFunc != nil {
+		return m.TranscriptionFunc(ctx, request)
+	}
+	return nil, unexpected("Transcription")
+}
@@ -0,0 +1,175 @@
+package gptmock_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gptmock"
+)
+
+var _ gpt.Client = (*gptmock.Client)(nil)
+
+// recordingT records the failures of assertions instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestGeneratedMockIsUpToDate(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	out := filepath.Join(t.TempDir(), "mock_gen.go")
+	cmd := exec.Command("go", "run", "./internal/mockgen", "-src", "../gpt.go", "-out", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("mockgen failed: %v\n%s", err, output)
+	}
+	generated, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("mock_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Error("mock_gen.go is out of date, run go generate ./gptmock")
+	}
+}
+
+func chatRequest(model, content string) *gpt.ChatCompletionRequest {
+	return &gpt.ChatCompletionRequest{Model: model, Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: content}}}
+}
+
+func TestClientRecordsCalls(t *testing.T) {
+	mock := gptmock.New()
+	mock.ExpectChatCompletion().Return(&gpt.ChatCompletionResponse{ID: "a"}, nil)
+	mock.EmbeddingsFunc = func(context.Context, *gpt.EmbeddingsRequest) (*gpt.EmbeddingsResponse, error) {
+		return &gpt.EmbeddingsResponse{}, nil
+	}
+	ctx := context.Background()
+	first, second := chatRequest(gpt.GPT4oMini, "a"), chatRequest(gpt.GPT4oMini, "b")
+	embeddings := &gpt.EmbeddingsRequest{Model: "text-embedding-3-small"}
+	if _, err := mock.ChatCompletion(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.Embeddings(ctx, embeddings); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.ChatCompletion(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := mock.Calls()
+	want := []struct {
+		method  string
+		request interface{}
+	}{
+		{"ChatCompletion", first},
+		{"Embeddings", embeddings},
+		{"ChatCompletion", second},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %+v, want %d calls", calls, len(want))
+	}
+	for i, w := range want {
+		if calls[i].Method != w.method || len(calls[i].Args) != 2 || calls[i].Args[0] != ctx || calls[i].Args[1] != w.request {
+			t.Errorf("call %d = %+v, want %s with its context and request", i, calls[i], w.method)
+		}
+	}
+	if chats := mock.CallsTo("ChatCompletion"); len(chats) != 2 || chats[1].Args[1] != second {
+		t.Errorf("CallsTo(ChatCompletion) = %+v, want both chat calls", chats)
+	}
+	if images := mock.CallsTo("Image"); len(images) != 0 {
+		t.Errorf("CallsTo(Image) = %+v, want none", images)
+	}
+}
+
+func TestClientExpectations(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(*gptmock.Client)
+		models []string
+		want   []string // IDs of the responses, or "error" for ErrUnexpectedCall
+		unmet  bool
+	}{
+		{"any number of calls", func(m *gptmock.Client) {
+			m.ExpectChatCompletion().Return(&gpt.ChatCompletionResponse{ID: "a"}, nil)
+		}, []string{gpt.GPT4oMini, gpt.GPT4o}, []string{"a", "a"}, false},
+		{"by model", func(m *gptmock.Client) {
+			m.ExpectChatCompletion().WithModel(gpt.GPT4o).Return(&gpt.ChatCompletionResponse{ID: "large"}, nil)
+			m.ExpectChatCompletion().Return(&gpt.ChatCompletionResponse{ID: "other"}, nil)
+		}, []string{gpt.GPT4oMini, gpt.GPT4o}, []string{"other", "large"}, false},
+		{"times", func(m *gptmock.Client) {
+			m.ExpectChatCompletion().Times(1).Return(&gpt.ChatCompletionResponse{ID: "once"}, nil)
+			m.ExpectChatCompletion().Return(&gpt.ChatCompletionResponse{ID: "then"}, nil)
+		}, []string{gpt.GPT4oMini, gpt.GPT4oMini}, []string{"once", "then"}, false},
+		{"unexpected call", func(m *gptmock.Client) {
+			m.ExpectChatCompletion().WithModel(gpt.GPT4o).Return(&gpt.ChatCompletionResponse{ID: "large"}, nil)
+		}, []string{gpt.GPT4oMini}, []string{"error"}, true},
+		{"unmet times", func(m *gptmock.Client) {
+			m.ExpectChatCompletion().Times(2).Return(&gpt.ChatCompletionResponse{ID: "twice"}, nil)
+		}, []string{gpt.GPT4oMini}, []string{"twice"}, true},
+		{"function field", func(m *gptmock.Client) {
+			m.ChatCompletionFunc = func(_ context.Context, req *gpt.ChatCompletionRequest) (*gpt.ChatCompletionResponse, error) {
+				return &gpt.ChatCompletionResponse{ID: req.Model}, nil
+			}
+		}, []string{gpt.GPT4oMini}, []string{gpt.GPT4oMini}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := gptmock.New()
+			tt.setup(mock)
+			for i, model := range tt.models {
+				rsp, err := mock.ChatCompletion(context.Background(), chatRequest(model, "hi"))
+				switch {
+				case tt.want[i] == "error":
+					if !errors.Is(err, gptmock.ErrUnexpectedCall) {
+						t.Errorf("call %d: error %v, want ErrUnexpectedCall", i, err)
+					}
+				case err != nil:
+					t.Errorf("call %d: %v", i, err)
+				case rsp.ID != tt.want[i]:
+					t.Errorf("call %d: response %q, want %q", i, rsp.ID, tt.want[i])
+				}
+			}
+			rt := &recordingT{TB: t}
+			mock.AssertExpectations(rt)
+			if unmet := len(rt.errors) > 0; unmet != tt.unmet {
+				t.Errorf("AssertExpectations reported %q, want unmet expectations %v", rt.errors, tt.unmet)
+			}
+		})
+	}
+}
+
+func TestClientStreams(t *testing.T) {
+	mock := gptmock.New()
+	failure := errors.New("stream broke")
+	mock.ExpectChatCompletionStream().Chunks(gptmock.ChatChunks("Hel", "lo")...).Return(failure)
+	var text string
+	err := mock.ChatCompletionStream(context.Background(), chatRequest(gpt.GPT4oMini, "hi"), func(rsp *gpt.ChatCompletionStreamResponse) {
+		text += rsp.Choices[0].Delta.Content
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("error %v, want the error of the expectation", err)
+	}
+	if text != "Hello" {
+		t.Errorf("streamed %q, want Hello", text)
+	}
+	if calls := mock.CallsTo("ChatCompletionStream"); len(calls) != 1 {
+		t.Errorf("stream calls = %+v, want one", calls)
+	}
+}
@@ -0,0 +1,137 @@
+package gptrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// redacted replaces the values of sensitive headers in cassettes.
+const redacted = "REDACTED"
+
+// Cassette is the list of interactions stored in a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and the response it received.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	// JSON holds the body when it is valid JSON, Body holds it otherwise
+	JSON json.RawMessage `json:"json,omitempty"`
+	Body string          `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// JSON holds the body when it is valid JSON, Body holds it otherwise
+	JSON json.RawMessage `json:"json,omitempty"`
+	Body string          `json:"body,omitempty"`
+	// Events holds the server-sent events of a streamed response instead of a body
+	Events []Event `json:"events,omitempty"`
+}
+
+// Event is a single server-sent event of a streamed response.
+type Event struct {
+	// Delay is the time between the previous event, or the response headers, and this event in nanoseconds
+	Delay time.Duration `json:"delay"`
+	// Data is the raw event including its "data: " prefix, without the trailing blank line
+	Data string `json:"data"`
+}
+
+// body returns the recorded request body.
+func (r *Request) body() []byte {
+	if len(r.JSON) > 0 {
+		return r.JSON
+	}
+	return []byte(r.Body)
+}
+
+func (r *Request) setBody(body []byte) {
+	r.JSON, r.Body = splitBody(body)
+}
+
+// body returns the recorded response body, reassembling streamed events.
+func (r *Response) body() []byte {
+	if r.Events != nil {
+		var buf bytes.Buffer
+		for _, event := range r.Events {
+			buf.WriteString(event.Data)
+			buf.WriteString("\n\n")
+		}
+		return buf.Bytes()
+	}
+	if len(r.JSON) > 0 {
+		return r.JSON
+	}
+	return []byte(r.Body)
+}
+
+func (r *Response) setBody(body []byte) {
+	r.JSON, r.Body = splitBody(body)
+}
+
+func splitBody(body []byte) (json.RawMessage, string) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && json.Valid(trimmed) {
+		var compact bytes.Buffer
+		if json.Compact(&compact, trimmed) == nil {
+			return compact.Bytes(), ""
+		}
+	}
+	return nil, string(body)
+}
+
+// loadCassette reads a cassette file. A missing file yields an empty cassette.
+func loadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Cassette{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	cassette := new(Cassette)
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// save writes the cassette file, creating its directory if needed.
+func (c *Cassette) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// redactHeader returns a copy of header with the values of the named headers replaced.
+func redactHeader(header http.Header, names []string) http.Header {
+	header = header.Clone()
+	for _, name := range names {
+		if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			header.Set(name, redacted)
+		}
+	}
+	return header
+}
@@ -0,0 +1,75 @@
+package gptrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Matcher reports whether a recorded request can answer an incoming request with the given body.
+type Matcher func(req *http.Request, body []byte, recorded *Request) bool
+
+// MatchEndpoint matches requests with the same method and URL path.
+func MatchEndpoint(req *http.Request, _ []byte, recorded *Request) bool {
+	u, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	return req.Method == recorded.Method && req.URL.Path == u.Path
+}
+
+// MatchModel matches requests whose JSON bodies name the same model.
+func MatchModel(_ *http.Request, body []byte, recorded *Request) bool {
+	return modelOf(body) == modelOf(recorded.body())
+}
+
+// MatchBody returns a Matcher that compares normalized JSON bodies, ignoring key order, whitespace and
+// the given top-level fields. Bodies that aren't JSON are compared byte for byte.
+func MatchBody(ignore ...string) Matcher {
+	return func(_ *http.Request, body []byte, recorded *Request) bool {
+		return bytes.Equal(normalize(body, ignore), normalize(recorded.body(), ignore))
+	}
+}
+
+// MatchAll returns a Matcher that matches when all matchers match.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(req *http.Request, body []byte, recorded *Request) bool {
+		for _, match := range matchers {
+			if !match(req, body, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// DefaultMatcher matches on endpoint and normalized body.
+var DefaultMatcher = MatchAll(MatchEndpoint, MatchBody())
+
+func modelOf(body []byte) string {
+	var v struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal(body, &v)
+	return v.Model
+}
+
+// normalize re-encodes a JSON body so that equivalent bodies compare equal. encoding/json writes map
+// keys in sorted order, which makes the encoding canonical.
+func normalize(body []byte, ignore []string) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		for _, key := range ignore {
+			delete(obj, key)
+		}
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
@@ -0,0 +1,60 @@
+package gptrecord_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/gptrecord"
+)
+
+func TestMatchers(t *testing.T) {
+	recorded := &gptrecord.Request{
+		Method: http.MethodPost,
+		URL:    "https://api.openai.com/v1/chat/completions",
+		JSON:   []byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"user":"a"}`),
+	}
+	text := &gptrecord.Request{Method: http.MethodPost, URL: "https://api.openai.com/v1/audio/transcriptions", Body: "--boundary\r\n"}
+	tests := []struct {
+		name     string
+		matcher  gptrecord.Matcher
+		method   string
+		url      string
+		body     string
+		recorded *gptrecord.Request
+		want     bool
+	}{
+		{"endpoint", gptrecord.MatchEndpoint, http.MethodPost, "http://localhost/v1/chat/completions", `{}`, recorded, true},
+		{"endpoint of another method", gptrecord.MatchEndpoint, http.MethodGet, "http://localhost/v1/chat/completions", ``, recorded, false},
+		{"endpoint of another path", gptrecord.MatchEndpoint, http.MethodPost, "http://localhost/v1/completions", `{}`, recorded, false},
+		{"model", gptrecord.MatchModel, http.MethodPost, "http://localhost/v1/embeddings", `{"model":"gpt-4o-mini"}`, recorded, true},
+		{"other model", gptrecord.MatchModel, http.MethodPost, "http://localhost/v1/chat/completions", `{"model":"gpt-4o"}`, recorded, false},
+		{"body in another order", gptrecord.MatchBody(), http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"user": "a", "messages": [{"content": "hi", "role": "user"}], "model": "gpt-4o-mini"}`, recorded, true},
+		{"other body", gptrecord.MatchBody(), http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"user":"b"}`, recorded, false},
+		{"body ignoring a field", gptrecord.MatchBody("user"), http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`, recorded, true},
+		{"body that isn't JSON", gptrecord.MatchBody(), http.MethodPost, "http://localhost/v1/audio/transcriptions", "--boundary\r\n", text, true},
+		{"other body that isn't JSON", gptrecord.MatchBody(), http.MethodPost, "http://localhost/v1/audio/transcriptions", "--other\r\n", text, false},
+		{"all", gptrecord.MatchAll(gptrecord.MatchEndpoint, gptrecord.MatchModel), http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"model":"gpt-4o-mini"}`, recorded, true},
+		{"all but one", gptrecord.MatchAll(gptrecord.MatchEndpoint, gptrecord.MatchModel), http.MethodPost, "http://localhost/v1/completions",
+			`{"model":"gpt-4o-mini"}`, recorded, false},
+		{"default", gptrecord.DefaultMatcher, http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"model":"gpt-4o-mini","user":"a","messages":[{"role":"user","content":"hi"}]}`, recorded, true},
+		{"default with another body", gptrecord.DefaultMatcher, http.MethodPost, "http://localhost/v1/chat/completions",
+			`{"model":"gpt-4o-mini"}`, recorded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.matcher(req, []byte(tt.body), tt.recorded); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// Package gptrecord provides an http.RoundTripper that records OpenAI API interactions into cassette
+// files and replays them, so tests can run deterministically without network access. Use it through
+// gpt.WithHTTPClient:
+//
+//	rec, err := gptrecord.New("testdata/chat.json", gptrecord.ModeReplayOrRecord)
+//	client := gpt.NewClient(os.Getenv("API_KEY"), gpt.WithHTTPClient(rec.HTTPClient()))
+//	...
+//	err = rec.Save()
+package gptrecord
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects whether a Recorder talks to the real API.
+type Mode int
+
+// Define recorder modes
+const (
+	ModeReplay         Mode = iota // ModeReplay only replays recorded interactions
+	ModeRecord                     // ModeRecord sends every request and records a fresh cassette
+	ModeReplayOrRecord             // ModeReplayOrRecord replays when possible and records missing interactions
+)
+
+// ErrNoInteraction is returned in ModeReplay when no recorded interaction matches a request.
+var ErrNoInteraction = errors.New("no recorded interaction matches request")
+
+// DefaultRedactedHeaders are the headers whose values are never written to cassettes.
+var DefaultRedactedHeaders = []string{"Authorization", "OpenAI-Organization"}
+
+// Option are options that can be passed when creating a new recorder
+type Option func(*Recorder) *Recorder
+
+// WithTransport is a recorder option that sets the transport used to reach the real API.
+// The default is http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) *Recorder {
+		r.transport = transport
+		return r
+	}
+}
+
+// WithMatcher is a recorder option that overrides how requests are matched to recorded interactions.
+// The default is DefaultMatcher.
+func WithMatcher(matcher Matcher) Option {
+	return func(r *Recorder) *Recorder {
+		r.matcher = matcher
+		return r
+	}
+}
+
+// WithRealTime is a recorder option that replays streamed events with their recorded timing instead of
+// as fast as possible.
+func WithRealTime(realTime bool) Option {
+	return func(r *Recorder) *Recorder {
+		r.realTime = realTime
+		return r
+	}
+}
+
+// WithRedactedHeaders is a recorder option that adds headers to DefaultRedactedHeaders.
+func WithRedactedHeaders(headers ...string) Option {
+	return func(r *Recorder) *Recorder {
+		r.redact = append(r.redact, headers...)
+		return r
+	}
+}
+
+// Recorder is an http.RoundTripper that records and replays interactions from a cassette file.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	matcher   Matcher
+	realTime  bool
+	redact    []string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[*Interaction]bool
+}
+
+// New returns a Recorder for the cassette at path. The cassette is loaded unless mode is ModeRecord.
+func New(path string, mode Mode, options ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		matcher:   DefaultMatcher,
+		redact:    append([]string(nil), DefaultRedactedHeaders...),
+		cassette:  &Cassette{},
+		used:      make(map[*Interaction]bool),
+	}
+	for _, opt := range options {
+		r = opt(r)
+	}
+	if mode != ModeRecord {
+		cassette, err := loadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+	}
+	return r, nil
+}
+
+// HTTPClient returns an http.Client using the recorder as its transport.
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes the cassette file. It is a no-op in ModeReplay.
+func (r *Recorder) Save() error {
+	if r.mode == ModeReplay {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.save(r.path)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	if r.mode != ModeRecord {
+		if interaction := r.find(req, body); interaction != nil {
+			return r.replay(req, interaction), nil
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+		}
+	}
+	return r.record(req, body)
+}
+
+// find returns the first unused recorded interaction matching the request. Once every match has been
+// used, the last one is reused so repeated requests keep working.
+func (r *Recorder) find(req *http.Request, body []byte) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *Interaction
+	for _, interaction := range r.cassette.Interactions {
+		if !r.matcher(req, body, &interaction.Request) {
+			continue
+		}
+		if !r.used[interaction] {
+			r.used[interaction] = true
+			return interaction
+		}
+		last = interaction
+	}
+	return last
+}
+
+func (r *Recorder) replay(req *http.Request, interaction *Interaction) *http.Response {
+	rsp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode: interaction.Response.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     interaction.Response.Header.Clone(),
+		Request:    req,
+	}
+	if rsp.Header == nil {
+		rsp.Header = make(http.Header)
+	}
+	if interaction.Response.Events != nil && r.realTime {
+		rsp.Body = &eventReader{ctx: req.Context(), events: interaction.Response.Events}
+	} else {
+		body := interaction.Response.body()
+		rsp.ContentLength = int64(len(body))
+		rsp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return rsp
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	outgoing := req.Clone(req.Context())
+	outgoing.Body = io.NopCloser(bytes.NewReader(body))
+	outgoing.ContentLength = int64(len(body))
+	rsp, err := r.transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header, r.redact),
+		},
+		Response: Response{
+			Status: rsp.StatusCode,
+			Header: redactHeader(rsp.Header, r.redact),
+		},
+	}
+	interaction.Request.setBody(body)
+	if strings.HasPrefix(rsp.Header.Get("Content-Type"), "text/event-stream") {
+		// the interaction is stored once the caller has consumed the stream
+		rsp.Body = &eventRecorder{
+			body:        rsp.Body,
+			reader:      bufio.NewReader(rsp.Body),
+			last:        time.Now(),
+			interaction: interaction,
+			done:        r.add,
+		}
+		return rsp, nil
+	}
+	data, err := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	interaction.Response.setBody(data)
+	r.add(interaction)
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	return rsp, nil
+}
+
+func (r *Recorder) add(interaction *Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.used[interaction] = true
+}
+
+// eventRecorder passes a streamed response through to the caller while recording each event and the
+// time it arrived.
+type eventRecorder struct {
+	body        io.ReadCloser
+	reader      *bufio.Reader
+	last        time.Time
+	interaction *Interaction
+	done        func(*Interaction)
+	pending     bytes.Buffer
+	event       bytes.Buffer
+	finished    bool
+}
+
+func (e *eventRecorder) Read(p []byte) (int, error) {
+	for e.pending.Len() == 0 {
+		line, err := e.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			e.pending.Write(line)
+			e.collect(line)
+		}
+		if err != nil {
+			if e.pending.Len() > 0 {
+				break
+			}
+			e.finish()
+			return 0, err
+		}
+	}
+	return e.pending.Read(p)
+}
+
+// collect accumulates lines until a blank line terminates the event.
+func (e *eventRecorder) collect(line []byte) {
+	if len(bytes.TrimSpace(line)) > 0 {
+		e.event.Write(line)
+		return
+	}
+	if e.event.Len() == 0 {
+		return
+	}
+	now := time.Now()
+	e.interaction.Response.Events = append(e.interaction.Response.Events, Event{
+		Delay: now.Sub(e.last),
+		Data:  strings.TrimRight(e.event.String(), "\r\n"),
+	})
+	e.last = now
+	e.event.Reset()
+}
+
+func (e *eventRecorder) finish() {
+	if e.finished {
+		return
+	}
+	e.finished = true
+	if e.event.Len() > 0 {
+		e.collect([]byte("\n"))
+	}
+	if e.interaction.Response.Events == nil {
+		e.interaction.Response.Events = []Event{}
+	}
+	e.done(e.interaction)
+}
+
+func (e *eventRecorder) Close() error {
+	e.finish()
+	return e.body.Close()
+}
+
+// eventReader replays recorded events with their original timing.
+type eventReader struct {
+	ctx     context.Context
+	events  []Event
+	pending bytes.Buffer
+}
+
+func (e *eventReader) Read(p []byte) (int, error) {
+	if e.pending.Len() == 0 {
+		if len(e.events) == 0 {
+			return 0, io.EOF
+		}
+		event := e.events[0]
+		e.events = e.events[1:]
+		timer := time.NewTimer(event.Delay)
+		select {
+		case <-timer.C:
+		case <-e.ctx.Done():
+			timer.Stop()
+			return 0, e.ctx.Err()
+		}
+		e.pending.WriteString(event.Data)
+		e.pending.WriteString("\n\n")
+	}
+	return e.pending.Read(p)
+}
+
+func (e *eventReader) Close() error {
+	return nil
+}
@@ -0,0 +1,203 @@
+package gptrecord_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gptrecord"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+// newClient returns a client of the API at server going through rec.
+func newClient(server *gpttest.Server, rec *gptrecord.Recorder) gpt.Client {
+	return gpt.NewClient(gpttest.APIKey, gpt.WithBaseURL(server.BaseURL()), gpt.WithHTTPClient(rec.HTTPClient()),
+		gpt.WithOrg("org-secret"))
+}
+
+func chatRequest(content string) *gpt.ChatCompletionRequest {
+	return &gpt.ChatCompletionRequest{
+		Model:    gpt.GPT4oMini,
+		Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: content}},
+	}
+}
+
+// streamDeltas streams a chat completion and returns its deltas.
+func streamDeltas(t *testing.T, client gpt.Client) []string {
+	t.Helper()
+	var deltas []string
+	err := client.ChatCompletionStream(context.Background(), chatRequest("hi"), func(rsp *gpt.ChatCompletionStreamResponse) {
+		if len(rsp.Choices) > 0 && rsp.Choices[0].Delta.Content != "" {
+			deltas = append(deltas, rsp.Choices[0].Delta.Content)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deltas
+}
+
+func TestRecorderRedactsHeaders(t *testing.T) {
+	server := gpttest.New(t)
+	server.Enqueue(gpttest.EndpointChatCompletions, gpttest.Response{Header: http.Header{"X-Session": []string{"session-secret"}}})
+	path := filepath.Join(t.TempDir(), "chat.json")
+	rec, err := gptrecord.New(path, gptrecord.ModeRecord, gptrecord.WithRedactedHeaders("X-Session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newClient(server, rec).ChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{gpttest.APIKey, "org-secret", "session-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+	if strings.Count(string(data), "REDACTED") != 3 {
+		t.Errorf("cassette has not redacted Authorization, OpenAI-Organization and X-Session:\n%s", data)
+	}
+	server.AssertAuthorization(t, gpttest.APIKey)
+}
+
+func TestRecorderStreams(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	server := gpttest.New(t)
+	server.Enqueue(gpttest.EndpointChatCompletions, gpttest.Response{
+		Chunks:     gpttest.ChatChunks(gpt.GPT4oMini, "Hel", "lo"),
+		ChunkDelay: delay,
+	})
+	path := filepath.Join(t.TempDir(), "stream.json")
+	rec, err := gptrecord.New(path, gptrecord.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := streamDeltas(t, newClient(server, rec))
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		realTime bool
+	}{
+		{"as fast as possible", false},
+		{"in real time", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := gptrecord.New(path, gptrecord.ModeReplay, gptrecord.WithRealTime(tt.realTime))
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			deltas := streamDeltas(t, newClient(server, rec))
+			elapsed := time.Since(start)
+			if strings.Join(deltas, "|") != strings.Join(recorded, "|") || len(deltas) != 2 {
+				t.Errorf("replayed deltas %q, recorded %q", deltas, recorded)
+			}
+			// the headers came with the first chunk, and the other two chunks after the chunk delay
+			if slow := elapsed >= 2*delay; slow != tt.realTime {
+				t.Errorf("replay took %v, want real time %v", elapsed, tt.realTime)
+			}
+		})
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cassette gptrecord.Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		t.Fatal(err)
+	}
+	events := cassette.Interactions[0].Response.Events
+	if len(events) != 4 || events[len(events)-1].Data != "data: [DONE]" {
+		t.Fatalf("recorded events %+v, want three chunks and [DONE]", events)
+	}
+	for _, event := range events[1:3] {
+		if event.Delay < delay {
+			t.Errorf("event %q recorded with delay %v, want at least %v", event.Data, event.Delay, delay)
+		}
+	}
+}
+
+func TestRecorderErrors(t *testing.T) {
+	recorded := filepath.Join(t.TempDir(), "recorded.json")
+	server := gpttest.New(t)
+	rec, err := gptrecord.New(recorded, gptrecord.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newClient(server, rec).ChatCompletion(context.Background(), chatRequest("recorded")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, content string
+		want                error
+	}{
+		{"matching request", recorded, "recorded", nil},
+		{"unmatched request", recorded, "other", gptrecord.ErrNoInteraction},
+		{"missing cassette", filepath.Join(t.TempDir(), "missing.json"), "recorded", gptrecord.ErrNoInteraction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := gptrecord.New(tt.path, gptrecord.ModeReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = newClient(server, rec).ChatCompletion(context.Background(), chatRequest(tt.content))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := gptrecord.New(invalid, gptrecord.ModeReplay); err == nil {
+		t.Error("New read an invalid cassette without error")
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+}
+
+func TestRecorderReplayOrRecord(t *testing.T) {
+	server := gpttest.New(t)
+	path := filepath.Join(t.TempDir(), "chat.json")
+	for i := 0; i < 2; i++ {
+		rec, err := gptrecord.New(path, gptrecord.ModeReplayOrRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := newClient(server, rec)
+		for _, content := range []string{"a", "b", "a"} {
+			if _, err := client.ChatCompletion(context.Background(), chatRequest(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rec.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a is answered from its recording the second time, and all are replayed in the second run
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 2)
+}
@@ -0,0 +1,316 @@
+package gpttest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// DefaultReply is the text of default chat, completion and edit responses.
+const DefaultReply = "This is a test response."
+
+// DefaultTranscript is the text of default transcription responses.
+const DefaultTranscript = "This is a test transcription."
+
+// EmbeddingDimensions is the length of the default embedding vectors.
+const EmbeddingDimensions = 16
+
+const created = 1677652288
+
+// ErrorResponse returns a response carrying an OpenAI error.
+func ErrorResponse(status int, errType, message string) Response {
+	return Response{
+		Status: status,
+		Error:  &gpt.APIError{StatusCode: status, Type: errType, Message: message},
+	}
+}
+
+// RateLimited returns a 429 response asking the client to retry after the given duration.
+func RateLimited(retryAfter time.Duration) Response {
+	rsp := ErrorResponse(http.StatusTooManyRequests, "requests", "Rate limit reached")
+	rsp.Header = http.Header{"Retry-After": []string{strconv.Itoa(int(retryAfter.Seconds()))}}
+	return rsp
+}
+
+// ChatChunks returns stream chunks for the chat completions endpoint that deliver the given deltas.
+func ChatChunks(model string, deltas ...string) []interface{} {
+	chunks := make([]interface{}, 0, len(deltas)+1)
+	for i, delta := range deltas {
+		msg := gpt.ChatCompletionResponseMessage{Content: delta}
+		if i == 0 {
+			msg.Role = "assistant"
+		}
+		chunks = append(chunks, gpt.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-gpttest",
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []gpt.ChatCompletionStreamResponseChoice{{Delta: msg}},
+		})
+	}
+	return append(chunks, gpt.ChatCompletionStreamResponse{
+		ID:      "chatcmpl-gpttest",
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+		Choices: []gpt.ChatCompletionStreamResponseChoice{{FinishReason: "stop"}},
+	})
+}
+
+// CompletionChunks returns stream chunks for the completions endpoint that deliver the given texts.
+func CompletionChunks(model string, texts ...string) []interface{} {
+	chunks := make([]interface{}, 0, len(texts))
+	for i, text := range texts {
+		choice := gpt.CompletionResponseChoice{Text: text}
+		if i == len(texts)-1 {
+			choice.FinishReason = "stop"
+		}
+		chunks = append(chunks, gpt.CompletionResponse{
+			ID:      "cmpl-gpttest",
+			Object:  "text_completion",
+			Created: created,
+			Model:   model,
+			Choices: []gpt.CompletionResponseChoice{choice},
+		})
+	}
+	return chunks
+}
+
+// Embedding returns the deterministic unit vector the server uses as the embedding of text.
+func Embedding(text string) []float64 {
+	return EmbeddingWithDimensions(text, EmbeddingDimensions)
+}
+
+// EmbeddingWithDimensions returns the embedding of text the server returns for a request with the given
+// dimensions.
+func EmbeddingWithDimensions(text string, dimensions int) []float64 {
+	if dimensions <= 0 {
+		dimensions = EmbeddingDimensions
+	}
+	vector := make([]float64, dimensions)
+	norm := 0.0
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		vector[sum%uint64(dimensions)] += 1 + float64(sum>>32%7)/7
+	}
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		vector[0], norm = 1, 1
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// countTokens approximates token usage by counting words.
+func countTokens(texts ...string) int {
+	n := 0
+	for _, text := range texts {
+		n += len(strings.Fields(text))
+	}
+	return n
+}
+
+func defaultResponse(req Request) interface{} {
+	switch req.Endpoint {
+	case EndpointEngines:
+		return gpt.EnginesResponse{
+			Object: "list",
+			Data: []gpt.EngineObject{
+				{ID: gpt.GPT3Dot5Turbo, Object: "engine", Owner: "openai", Ready: true},
+				{ID: gpt.GPT4, Object: "engine", Owner: "openai", Ready: true},
+				{ID: gpt.TextEmbeddingAda002, Object: "engine", Owner: "openai", Ready: true},
+			},
+		}
+	case EndpointEngine:
+		return gpt.EngineObject{
+			ID:     strings.TrimPrefix(req.Path, "/engines/"),
+			Object: "engine",
+			Owner:  "openai",
+			Ready:  true,
+		}
+	case EndpointChatCompletions:
+		var request gpt.ChatCompletionRequest
+		_ = req.Decode(&request)
+		prompt := make([]string, 0, len(request.Messages))
+		for _, msg := range request.Messages {
+			prompt = append(prompt, msg.Content)
+		}
+		usage := gpt.ChatCompletionsResponseUsage{PromptTokens: countTokens(prompt...), CompletionTokens: countTokens(DefaultReply)}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		return gpt.ChatCompletionResponse{
+			ID:      "chatcmpl-gpttest",
+			Object:  "chat.completion",
+			Created: created,
+			Model:   request.Model,
+			Choices: []gpt.ChatCompletionResponseChoice{{
+				FinishReason: "stop",
+				Message:      gpt.ChatCompletionResponseMessage{Role: "assistant", Content: DefaultReply},
+			}},
+			Usage: usage,
+		}
+	case EndpointCompletions:
+		var request gpt.CompletionRequest
+		_ = req.Decode(&request)
+		usage := gpt.CompletionResponseUsage{PromptTokens: countTokens(request.Prompt...), CompletionTokens: countTokens(DefaultReply)}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		return gpt.CompletionResponse{
+			ID:      "cmpl-gpttest",
+			Object:  "text_completion",
+			Created: created,
+			Model:   request.Model,
+			Choices: []gpt.CompletionResponseChoice{{Text: DefaultReply, FinishReason: "stop"}},
+			Usage:   usage,
+		}
+	case EndpointEdits:
+		var request gpt.EditsRequest
+		_ = req.Decode(&request)
+		usage := gpt.EditsResponseUsage{PromptTokens: countTokens(request.Input, request.Instruction), CompletionTokens: countTokens(DefaultReply)}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		return gpt.EditsResponse{
+			Object:  "edit",
+			Created: created,
+			Choices: []gpt.EditsResponseChoice{{Text: DefaultReply}},
+			Usage:   usage,
+		}
+	case EndpointSearch:
+		var request gpt.SearchRequest
+		_ = req.Decode(&request)
+		query := Embedding(request.Query)
+		data := make([]gpt.SearchData, 0, len(request.Documents))
+		for i, doc := range request.Documents {
+			score := 0.0
+			for j, v := range Embedding(doc) {
+				score += v * query[j]
+			}
+			data = append(data, gpt.SearchData{Document: i, Object: "search_result", Score: score})
+		}
+		return gpt.SearchResponse{Object: "list", Data: data}
+	case EndpointEmbeddings:
+		var request gpt.EmbeddingsRequest
+		_ = req.Decode(&request)
+		data := make([]json.RawMessage, 0, len(request.Input))
+		for i, input := range request.Input {
+			vector := EmbeddingWithDimensions(input, request.Dimensions)
+			var embedding interface{} = vector
+			if request.EncodingFormat == gpt.EmbeddingEncodingBase64 {
+				v := make([]float32, len(vector))
+				for j, x := range vector {
+					v[j] = float32(x)
+				}
+				embedding = gpt.EncodeEmbeddingBase64(v)
+			}
+			result, _ := json.Marshal(map[string]interface{}{"object": "embedding", "embedding": embedding, "index": i})
+			data = append(data, result)
+		}
+		tokens := countTokens(request.Input...)
+		return map[string]interface{}{
+			"object": "list",
+			"data":   data,
+			"usage":  gpt.EmbeddingsUsage{PromptTokens: tokens, TotalTokens: tokens},
+		}
+	case EndpointImages:
+		var request gpt.ImageRequest
+		_ = req.Decode(&request)
+		n := request.N
+		if n == 0 {
+			n = 1
+		}
+		data := make([]gpt.ImageResponseDataInner, 0, n)
+		for i := 0; i < n; i++ {
+			if request.ResponseFormat == gpt.CreateImageResponseFormatB64JSON {
+				// a 1x1 transparent PNG
+				data = append(data, gpt.ImageResponseDataInner{B64JSON: "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="})
+				continue
+			}
+			data = append(data, gpt.ImageResponseDataInner{URL: "https://images.gpttest.invalid/" + strconv.Itoa(i) + ".png"})
+		}
+		return gpt.ImageResponse{Created: created, Data: data}
+	case EndpointModerations:
+		var request gpt.ModerationRequest
+		_ = req.Decode(&request)
+		results := make([]gpt.ModerationResult, 0, len(request.Input))
+		for range request.Input {
+			result := gpt.ModerationResult{Categories: make(map[string]bool), CategoryScores: make(map[string]float64)}
+			for _, category := range moderationCategories {
+				result.Categories[category] = false
+				result.CategoryScores[category] = 0
+			}
+			results = append(results, result)
+		}
+		return gpt.ModerationResponse{ID: "modr-gpttest", Model: request.Model, Results: results}
+	case EndpointTranscriptions:
+		switch req.FormValue("response_format") {
+		case gpt.TranscriptionFormatText:
+			return []byte(DefaultTranscript + "\n")
+		case gpt.TranscriptionFormatSRT:
+			return []byte("1\n00:00:00,000 --> 00:00:02,000\n" + DefaultTranscript + "\n\n")
+		case gpt.TranscriptionFormatVTT:
+			return []byte("WEBVTT\n\n00:00:00.000 --> 00:00:02.000\n" + DefaultTranscript + "\n\n")
+		case gpt.TranscriptionFormatVerboseJSON:
+			return gpt.TranscriptionResponse{
+				Text:     DefaultTranscript,
+				Language: "english",
+				Duration: 2,
+				Segments: []gpt.TranscriptionSegment{{Start: 0, End: 2, Text: DefaultTranscript}},
+			}
+		}
+		return gpt.TranscriptionResponse{Text: DefaultTranscript}
+	}
+	return nil
+}
+
+// moderationCategories are the categories of default moderation results, none of which is flagged.
+var moderationCategories = []string{"harassment", "hate", "illicit", "self-harm", "sexual", "violence"}
+
+// defaultChunks splits the default reply of a streaming endpoint into word chunks.
+func defaultChunks(req Request) []interface{} {
+	var model string
+	var request struct {
+		Model         string             `json:"model"`
+		StreamOptions *gpt.StreamOptions `json:"stream_options"`
+	}
+	if req.Decode(&request) == nil {
+		model = request.Model
+	}
+	includeUsage := request.StreamOptions != nil && request.StreamOptions.IncludeUsage
+	words := strings.SplitAfter(DefaultReply, " ")
+	switch req.Endpoint {
+	case EndpointChatCompletions:
+		chunks := ChatChunks(model, words...)
+		if includeUsage {
+			// the usage chunk of the API has no choices
+			rsp := defaultResponse(req).(gpt.ChatCompletionResponse)
+			chunks = append(chunks, gpt.ChatCompletionStreamResponse{
+				ID:      rsp.ID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []gpt.ChatCompletionStreamResponseChoice{},
+				Usage:   rsp.Usage,
+			})
+		}
+		return chunks
+	case EndpointCompletions:
+		chunks := CompletionChunks(model, words...)
+		if includeUsage {
+			rsp := defaultResponse(req).(gpt.CompletionResponse)
+			rsp.Choices = []gpt.CompletionResponseChoice{}
+			chunks = append(chunks, rsp)
+		}
+		return chunks
+	}
+	return nil
+}
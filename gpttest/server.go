@@ -0,0 +1,376 @@
+// Package gpttest provides an in-process OpenAI-compatible server for testing code that uses gpt.Client
+// without network access. Every endpoint covered by gpt.Client answers with a deterministic default
+// response, which can be replaced per endpoint by queued responses or a handler function.
+package gpttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Endpoints served by Server. They are used to queue responses and to look up recorded requests.
+const (
+	EndpointEngines         = "/engines"                 // EndpointEngines lists engines
+	EndpointEngine          = "/engines/{engine}"        // EndpointEngine retrieves one engine
+	EndpointChatCompletions = "/chat/completions"        // EndpointChatCompletions creates chat completions
+	EndpointCompletions     = "/completions"             // EndpointCompletions creates completions
+	EndpointEdits           = "/edits"                   // EndpointEdits creates edits
+	EndpointSearch          = "/engines/{engine}/search" // EndpointSearch is the retired search endpoint; Client.Search uses EndpointEmbeddings
+	EndpointEmbeddings      = "/embeddings"              // EndpointEmbeddings creates embeddings
+	EndpointImages          = "/images/generations"      // EndpointImages generates images
+	EndpointModerations     = "/moderations"             // EndpointModerations classifies texts
+	EndpointTranscriptions  = "/audio/transcriptions"    // EndpointTranscriptions transcribes audio
+)
+
+// APIKey is the key used by clients returned from Server.Client.
+const APIKey = "gpttest-key"
+
+// Response is a scripted answer to a single request.
+type Response struct {
+	// Status is the HTTP status code. Defaults to 200, or 500 when Error is set.
+	Status int
+	// Header is added to the response headers
+	Header http.Header
+	// Body is encoded as the JSON response body, except a []byte which is sent as is. When nil the
+	// endpoint's default response is used.
+	Body interface{}
+	// Error is sent as an OpenAI error response when set
+	Error *gpt.APIError
+	// Chunks are sent as server-sent events followed by [DONE] when the request asks for a stream.
+	// When nil a stream is synthesized from the default response.
+	Chunks []interface{}
+	// ChunkDelay is the pause before each chunk
+	ChunkDelay time.Duration
+	// Delay is the latency before the response headers are written
+	Delay time.Duration
+}
+
+// HandlerFunc computes the response to a request for one endpoint.
+type HandlerFunc func(req Request) Response
+
+// Request is a request received by Server.
+type Request struct {
+	// Endpoint is the endpoint constant the request matched
+	Endpoint string
+	Method   string
+	// Path is the request path without the /v1 prefix
+	Path   string
+	Header http.Header
+	Body   []byte
+	// Stream is whether the request body asked for a streamed response
+	Stream bool
+}
+
+// Decode unmarshals the JSON request body into v.
+func (r Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// FormValue returns a field of a multipart form request body, such as the model of a transcription.
+// It returns an empty string for files, missing fields and bodies that aren't multipart.
+func (r Request) FormValue(name string) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return ""
+	}
+	form := multipart.NewReader(bytes.NewReader(r.Body), params["boundary"])
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == name && part.FileName() == "" {
+			value, _ := io.ReadAll(part)
+			return string(value)
+		}
+	}
+}
+
+// Server is an OpenAI-compatible HTTP server running in-process.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queued   map[string][]Response
+	handlers map[string]HandlerFunc
+	requests []Request
+}
+
+// NewServer starts a Server. Callers should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		queued:   make(map[string][]Response),
+		handlers: make(map[string]HandlerFunc),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// New starts a Server that is closed when the test finishes.
+func New(t testing.TB) *Server {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// BaseURL returns the URL to pass to gpt.WithBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Client returns a gpt.Client talking to the server.
+func (s *Server) Client(options ...gpt.ClientOption) gpt.Client {
+	options = append([]gpt.ClientOption{gpt.WithBaseURL(s.BaseURL()), gpt.WithHTTPClient(s.Server.Client())}, options...)
+	return gpt.NewClient(APIKey, options...)
+}
+
+// Enqueue queues responses for an endpoint. Queued responses are used in order, one per request, before
+// falling back to the endpoint's handler or default response.
+func (s *Server) Enqueue(endpoint string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued[endpoint] = append(s.queued[endpoint], responses...)
+}
+
+// Handle sets the function computing responses for an endpoint once its queue is empty.
+func (s *Server) Handle(endpoint string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[endpoint] = fn
+}
+
+// Requests returns the requests received for an endpoint, or for all endpoints if endpoint is empty.
+func (s *Server) Requests(endpoint string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []Request
+	for _, req := range s.requests {
+		if endpoint == "" || req.Endpoint == endpoint {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// LastRequest returns the most recent request for an endpoint and whether there was one.
+func (s *Server) LastRequest(endpoint string) (Request, bool) {
+	requests := s.Requests(endpoint)
+	if len(requests) == 0 {
+		return Request{}, false
+	}
+	return requests[len(requests)-1], true
+}
+
+// Reset forgets recorded requests, queued responses and handlers.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = make(map[string][]Response)
+	s.handlers = make(map[string]HandlerFunc)
+	s.requests = nil
+}
+
+// AssertCalled fails the test unless the endpoint received exactly times requests.
+func (s *Server) AssertCalled(t testing.TB, endpoint string, times int) {
+	t.Helper()
+	if got := len(s.Requests(endpoint)); got != times {
+		t.Errorf("gpttest: %s called %d times, want %d", endpoint, got, times)
+	}
+}
+
+// AssertRequest fails the test unless the last request to the endpoint decodes into v and satisfies match.
+// v must be a pointer to the request type of the endpoint, e.g. *gpt.ChatCompletionRequest.
+func (s *Server) AssertRequest(t testing.TB, endpoint string, v interface{}, match func() bool) {
+	t.Helper()
+	req, ok := s.LastRequest(endpoint)
+	if !ok {
+		t.Errorf("gpttest: %s was not called", endpoint)
+		return
+	}
+	if err := req.Decode(v); err != nil {
+		t.Errorf("gpttest: invalid %s request body: %v", endpoint, err)
+		return
+	}
+	if !match() {
+		t.Errorf("gpttest: %s request did not match: %s", endpoint, req.Body)
+	}
+}
+
+// AssertAuthorization fails the test unless every request carried the given API key.
+func (s *Server) AssertAuthorization(t testing.TB, apiKey string) {
+	t.Helper()
+	for _, req := range s.Requests("") {
+		if got := req.Header.Get("Authorization"); got != "Bearer "+apiKey {
+			t.Errorf("gpttest: %s %s sent Authorization %q", req.Method, req.Path, got)
+		}
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Method: r.Method,
+		Path:   strings.TrimPrefix(r.URL.Path, "/v1"),
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+	req.Endpoint = endpointOf(req.Path)
+	if len(body) > 0 {
+		var stream struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.Unmarshal(body, &stream)
+		req.Stream = stream.Stream
+	}
+	if req.Endpoint == "" {
+		writeJSON(w, http.StatusNotFound, gpt.APIErrorResponse{Error: gpt.APIError{
+			Type:    "invalid_request_error",
+			Message: fmt.Sprintf("Unknown endpoint %s %s", r.Method, r.URL.Path),
+		}})
+		return
+	}
+	rsp := s.next(req)
+	s.write(r.Context(), w, req, rsp)
+}
+
+// next records the request and returns the response it should get.
+func (s *Server) next(req Request) Response {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if queue := s.queued[req.Endpoint]; len(queue) > 0 {
+		s.queued[req.Endpoint] = queue[1:]
+		s.mu.Unlock()
+		return queue[0]
+	}
+	handler := s.handlers[req.Endpoint]
+	s.mu.Unlock()
+	if handler != nil {
+		return handler(req)
+	}
+	return Response{}
+}
+
+func (s *Server) write(ctx context.Context, w http.ResponseWriter, req Request, rsp Response) {
+	if !sleep(ctx, rsp.Delay) {
+		return
+	}
+	for key, values := range rsp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if rsp.Error != nil {
+		status := rsp.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, gpt.APIErrorResponse{Error: *rsp.Error})
+		return
+	}
+	status := rsp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if req.Stream {
+		chunks := rsp.Chunks
+		if chunks == nil {
+			chunks = defaultChunks(req)
+		}
+		writeStream(ctx, w, status, chunks, rsp.ChunkDelay)
+		return
+	}
+	body := rsp.Body
+	if body == nil {
+		body = defaultResponse(req)
+	}
+	if data, ok := body.([]byte); ok {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write(data)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeStream(ctx context.Context, w http.ResponseWriter, status int, chunks []interface{}, delay time.Duration) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range chunks {
+		if !sleep(ctx, delay) {
+			return
+		}
+		data, ok := chunk.([]byte)
+		if !ok {
+			var err error
+			if data, err = json.Marshal(chunk); err != nil {
+				return
+			}
+		}
+		fmt.Fprintf(w, "data: %s\n\n", bytes.TrimSpace(data))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// sleep waits for d and reports whether the request is still alive afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func endpointOf(path string) string {
+	switch path {
+	case EndpointEngines, EndpointChatCompletions, EndpointCompletions, EndpointEdits, EndpointEmbeddings, EndpointImages,
+		EndpointModerations, EndpointTranscriptions:
+		return path
+	}
+	if strings.HasPrefix(path, "/engines/") {
+		rest := strings.TrimPrefix(path, "/engines/")
+		switch {
+		case strings.HasSuffix(rest, "/search") && strings.Count(rest, "/") == 1:
+			return EndpointSearch
+		case rest != "" && !strings.Contains(rest, "/"):
+			return EndpointEngine
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package gpttest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+// recordingT records the failures of assertions instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func chat(client gpt.Client, content string) (*gpt.ChatCompletionResponse, error) {
+	return client.ChatCompletion(context.Background(), &gpt.ChatCompletionRequest{
+		Model:    gpt.GPT4oMini,
+		Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: content}},
+	})
+}
+
+func TestServerHandle(t *testing.T) {
+	server := gpttest.New(t)
+	client := server.Client()
+	server.Handle(gpttest.EndpointChatCompletions, func(req gpttest.Request) gpttest.Response {
+		var request gpt.ChatCompletionRequest
+		if err := req.Decode(&request); err != nil {
+			t.Error(err)
+		}
+		return gpttest.Response{Body: gpt.ChatCompletionResponse{Choices: []gpt.ChatCompletionResponseChoice{{
+			Message: gpt.ChatCompletionResponseMessage{Role: "assistant", Content: "echo " + request.Messages[0].Content},
+		}}}}
+	})
+	server.Enqueue(gpttest.EndpointChatCompletions, gpttest.Response{Body: gpt.ChatCompletionResponse{Choices: []gpt.ChatCompletionResponseChoice{{
+		Message: gpt.ChatCompletionResponseMessage{Role: "assistant", Content: "queued"},
+	}}}})
+
+	tests := []struct {
+		name, content, want string
+	}{
+		{"queued responses come first", "a", "queued"},
+		{"then the handler answers", "b", "echo b"},
+		{"for every later request", "c", "echo c"},
+	}
+	for _, tt := range tests {
+		rsp, err := chat(client, tt.content)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := rsp.Choices[0].Message.Content; got != tt.want {
+			t.Errorf("%s: reply %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	server.Reset()
+	rsp, err := chat(client, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rsp.Choices[0].Message.Content; got != gpttest.DefaultReply {
+		t.Errorf("reply after Reset %q, want the default reply", got)
+	}
+}
+
+func TestServerLastRequest(t *testing.T) {
+	server := gpttest.New(t)
+	if _, ok := server.LastRequest(gpttest.EndpointChatCompletions); ok {
+		t.Error("LastRequest found a request before any was made")
+	}
+	client := server.Client()
+	for _, content := range []string{"first", "second"} {
+		if _, err := chat(client, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.Embeddings(context.Background(), &gpt.EmbeddingsRequest{Model: "text-embedding-3-small", Input: []string{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req, ok := server.LastRequest(gpttest.EndpointChatCompletions)
+	if !ok {
+		t.Fatal("LastRequest found no request")
+	}
+	if req.Endpoint != gpttest.EndpointChatCompletions || req.Method != http.MethodPost || req.Path != "/chat/completions" || req.Stream {
+		t.Errorf("request = %+v", req)
+	}
+	if !strings.Contains(string(req.Body), "second") {
+		t.Errorf("LastRequest body %s, want the second request", req.Body)
+	}
+	if last, _ := server.LastRequest(""); last.Endpoint != gpttest.EndpointEmbeddings {
+		t.Errorf("LastRequest of all endpoints is a %s request, want the embeddings request", last.Endpoint)
+	}
+}
+
+func TestServerAssertCalled(t *testing.T) {
+	server := gpttest.New(t)
+	client := server.Client()
+	for i := 0; i < 2; i++ {
+		if _, err := chat(client, "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		endpoint string
+		times    int
+		fails    bool
+	}{
+		{gpttest.EndpointChatCompletions, 2, false},
+		{gpttest.EndpointChatCompletions, 1, true},
+		{gpttest.EndpointEmbeddings, 0, false},
+		{gpttest.EndpointEmbeddings, 1, true},
+	}
+	for _, tt := range tests {
+		rt := &recordingT{TB: t}
+		server.AssertCalled(rt, tt.endpoint, tt.times)
+		if failed := len(rt.errors) > 0; failed != tt.fails {
+			t.Errorf("AssertCalled(%s, %d) failed %v, want %v: %q", tt.endpoint, tt.times, failed, tt.fails, rt.errors)
+		}
+	}
+}
+
+func TestServerAssertAuthorization(t *testing.T) {
+	tests := []struct {
+		name, key string
+		fails     bool
+	}{
+		{"key of the client", gpttest.APIKey, false},
+		{"other key", "sk-other", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			if _, err := chat(server.Client(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+			rt := &recordingT{TB: t}
+			server.AssertAuthorization(rt, tt.key)
+			if failed := len(rt.errors) > 0; failed != tt.fails {
+				t.Errorf("AssertAuthorization failed %v, want %v: %q", failed, tt.fails, rt.errors)
+			}
+		})
+	}
+}
+
+func TestServerStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *gpttest.Response
+		usage    bool
+		want     []string
+	}{
+		{"default chunks", nil, false, strings.SplitAfter(gpttest.DefaultReply, " ")},
+		{"default chunks with usage", nil, true, strings.SplitAfter(gpttest.DefaultReply, " ")},
+		{"scripted chunks", &gpttest.Response{Chunks: gpttest.ChatChunks(gpt.GPT4oMini, "Hel", "lo")}, false, []string{"Hel", "lo"}},
+		{"delayed chunks", &gpttest.Response{Chunks: gpttest.ChatChunks(gpt.GPT4oMini, "a", "b"), ChunkDelay: 10 * time.Millisecond}, false, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			if tt.response != nil {
+				server.Enqueue(gpttest.EndpointChatCompletions, *tt.response)
+			}
+			request := &gpt.ChatCompletionRequest{
+				Model:    gpt.GPT4oMini,
+				Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+			}
+			if tt.usage {
+				request.StreamOptions = &gpt.StreamOptions{IncludeUsage: true}
+			}
+			var deltas []string
+			var usage gpt.ChatCompletionsResponseUsage
+			start := time.Now()
+			err := server.Client().ChatCompletionStream(context.Background(), request, func(rsp *gpt.ChatCompletionStreamResponse) {
+				if len(rsp.Choices) == 0 {
+					usage = rsp.Usage
+					return
+				}
+				if content := rsp.Choices[0].Delta.Content; content != "" {
+					deltas = append(deltas, content)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("deltas %q, want %q", deltas, tt.want)
+			}
+			if (usage.TotalTokens > 0) != tt.usage {
+				t.Errorf("usage %+v, want a usage chunk %v", usage, tt.usage)
+			}
+			if tt.response != nil && time.Since(start) < tt.response.ChunkDelay*time.Duration(len(tt.response.Chunks)) {
+				t.Errorf("stream took %v, want a delay of %v before each chunk", time.Since(start), tt.response.ChunkDelay)
+			}
+			if req, _ := server.LastRequest(gpttest.EndpointChatCompletions); !req.Stream {
+				t.Error("request not recorded as a stream")
+			}
+		})
+	}
+}
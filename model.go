@@ -1,7 +1,10 @@
 // Package gpt provides a client for the OpenAI GPT-3 API
 package gpt
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 // APIError represents an error that occurred on an API
 type APIError struct {
@@ -40,6 +43,8 @@ type ChatCompletionRequestMessage struct {
 	Role string `json:"role"`
 	// Content is the content of the message
 	Content string `json:"content"`
+	// Name is an optional name for the participant, used to distinguish participants of the same role
+	Name string `json:"name,omitempty"`
 }
 
 // ChatCompletionRequest is a request for the chat completion API
@@ -58,6 +63,8 @@ type ChatCompletionRequest struct {
 	N int `json:"n,omitempty"`
 	// Stream is whether to stream responses back as they are generated
 	Stream bool `json:"stream,omitempty"`
+	// StreamOptions are options of a streamed response, only sent by the streaming methods
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 	// Stop is up to 4 sequences where the API will stop generating further tokens.
 	Stop []string `json:"stop,omitempty"`
 	// MaxTokens is the maximum number of tokens to return.
@@ -72,6 +79,12 @@ type ChatCompletionRequest struct {
 	User string `json:"user,omitempty"`
 }
 
+// StreamOptions are options of a streamed completion.
+type StreamOptions struct {
+	// IncludeUsage adds a last chunk with the usage of the whole request and no choices
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
 // CompletionRequest is a request for the completions API
 type CompletionRequest struct {
 	Model string `json:"model"`
@@ -90,6 +103,8 @@ type CompletionRequest struct {
 	// Stream sets whether to stream back results or not. Don't set this value in the request yourself
 	// as it will be overridden depending on if you use CompletionStream or Completion methods.
 	Stream bool `json:"stream,omitempty"`
+	// StreamOptions are options of a streamed response, only sent by the streaming methods
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 	// LogProbs sets include the probabilities of most likely tokens
 	LogProbs *int `json:"logprobs"`
 	// Echo sets back the prompt in addition to the completion
@@ -133,6 +148,13 @@ type EmbeddingsRequest struct {
 	Input []string `json:"input"`
 	// Model is ID of the model to use
 	Model string `json:"model"`
+	// EncodingFormat is the format of the returned embeddings, EmbeddingEncodingFloat or
+	// EmbeddingEncodingBase64. Base64 embeddings are decoded into float32 vectors, see
+	// EmbeddingsResult.Float32.
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	// Dimensions is the number of dimensions of the returned embeddings. Only supported by
+	// text-embedding-3 and later models.
+	Dimensions int `json:"dimensions,omitempty"`
 	// User is the request user is an optional parameter meant to be used to trace abusive requests
 	// back to the originating user. OpenAI states:
 	// "The [user] IDs should be a string that uniquely identifies each user. We recommend hashing
@@ -175,6 +197,14 @@ type ChatCompletionsResponseUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// PromptTokensDetails breaks down the prompt tokens, if the API reported it
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails is the breakdown of the prompt tokens of a chat completion
+type PromptTokensDetails struct {
+	// CachedTokens is the number of prompt tokens served from the prompt cache
+	CachedTokens int `json:"cached_tokens"`
 }
 
 // ChatCompletionResponse is the full response from a request to the Chat Completions API
@@ -233,9 +263,12 @@ type EditsResponse struct {
 type EmbeddingsResult struct {
 	// The type of object returned (e.g., "list", "object")
 	Object string `json:"object"`
-	// The embedding data for the input
+	// The embedding data for the input. It is nil for embeddings requested with EmbeddingEncodingBase64,
+	// which are only available from Float32.
 	Embedding []float64 `json:"embedding"`
 	Index     int       `json:"index"`
+
+	embedding32 []float32
 }
 
 // EmbeddingsUsage The usage stats for an embeddings response
@@ -284,6 +317,10 @@ type SearchData struct {
 type SearchResponse struct {
 	Data   []SearchData `json:"data"`
 	Object string       `json:"object"`
+	// Model is the embedding model the documents were scored with
+	Model string `json:"model,omitempty"`
+	// Usage is the tokens embedded for the search; embeddings taken from the search cache are not counted
+	Usage EmbeddingsUsage `json:"usage"`
 }
 
 // ImageRequest represents the request structure for the image API.
@@ -306,3 +343,65 @@ type ImageResponseDataInner struct {
 	URL     string `json:"url,omitempty"`
 	B64JSON string `json:"b64_json,omitempty"`
 }
+
+// ModerationRequest represents the request structure for the moderation API.
+type ModerationRequest struct {
+	// Input are the texts to classify
+	Input []string `json:"input"`
+	// Model is the moderation model, OmniModerationLatest when empty
+	Model string `json:"model,omitempty"`
+}
+
+// ModerationResponse represents a response structure for the moderation API.
+type ModerationResponse struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	// Results holds a result for every input, in order
+	Results []ModerationResult `json:"results"`
+}
+
+// ModerationResult is the classification of a single input.
+type ModerationResult struct {
+	// Flagged is whether any category was detected
+	Flagged bool `json:"flagged"`
+	// Categories tells by category name, e.g. "hate" or "violence", whether it was detected
+	Categories map[string]bool `json:"categories"`
+	// CategoryScores are the confidences of the categories between 0 and 1
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// TranscriptionRequest represents the request structure for the audio transcription API.
+type TranscriptionRequest struct {
+	// Audio is read to the end and uploaded
+	Audio io.Reader `json:"-"`
+	// FileName is the name of the audio file. Its extension tells the API the format, e.g. speech.mp3.
+	FileName string `json:"-"`
+	// Model is the transcription model, Whisper1 when empty
+	Model string `json:"model,omitempty"`
+	// Language is the ISO-639-1 language of the audio, which improves accuracy and latency
+	Language string `json:"language,omitempty"`
+	// Prompt guides the style of the transcript or continues a previous segment
+	Prompt string `json:"prompt,omitempty"`
+	// ResponseFormat is one of the TranscriptionFormat constants, TranscriptionFormatJSON when empty
+	ResponseFormat string `json:"response_format,omitempty"`
+	// Temperature sets sampling temperature to use
+	Temperature float32 `json:"temperature,omitempty"`
+}
+
+// TranscriptionResponse represents a response structure for the audio transcription API.
+type TranscriptionResponse struct {
+	// Text is the transcript, or the whole response for text, srt and vtt formats
+	Text string `json:"text"`
+	// Language, Duration in seconds and Segments are only returned with TranscriptionFormatVerboseJSON
+	Language string                 `json:"language,omitempty"`
+	Duration float64                `json:"duration,omitempty"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+}
+
+// TranscriptionSegment is a timed part of a transcript.
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
@@ -26,6 +26,24 @@ func WithOrg(id string) ClientOption {
 	}
 }
 
+// WithCredentialProvider is a client option that replaces the API key given to NewClient with a provider
+// that is asked for a token on every request
+func WithCredentialProvider(provider CredentialProvider) ClientOption {
+	return func(cli *client) *client {
+		cli.credentials = provider
+		return cli
+	}
+}
+
+// WithCredentialPool is a client option that spreads requests across the API keys and organizations
+// of a pool instead of the single key given to NewClient
+func WithCredentialPool(pool *CredentialPool) ClientOption {
+	return func(cli *client) *client {
+		cli.pool = pool
+		return cli
+	}
+}
+
 // WithDefaultEngine is a client option that allows you to override the default engine of the client
 func WithDefaultEngine(engine string) ClientOption {
 	return func(cli *client) *client {
@@ -34,6 +52,24 @@ func WithDefaultEngine(engine string) ClientOption {
 	}
 }
 
+// WithSearchEmbeddingModel is a client option that sets the embedding model Search uses to score
+// documents. The default is text-embedding-ada-002.
+func WithSearchEmbeddingModel(model string) ClientOption {
+	return func(cli *client) *client {
+		cli.searchEmbeddingModel = model
+		return cli
+	}
+}
+
+// WithSearchCache is a client option that keeps the embeddings Search computes for queries and documents
+// in cache, so documents searched again are not embedded again
+func WithSearchCache(cache Cache) ClientOption {
+	return func(cli *client) *client {
+		cli.searchCache = cache
+		return cli
+	}
+}
+
 // WithUserAgent is a client option that allows you to override the default user agent of the client
 func WithUserAgent(userAgent string) ClientOption {
 	return func(cli *client) *client {
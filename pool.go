@@ -0,0 +1,239 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PoolStrategy decides which credential of a CredentialPool serves the next request.
+type PoolStrategy int
+
+// Define credential pool strategies
+const (
+	PoolRoundRobin             PoolStrategy = iota // PoolRoundRobin cycles through the keys in order
+	PoolLeastRecentlyThrottled                     // PoolLeastRecentlyThrottled prefers the key throttled longest ago
+	PoolWeighted                                   // PoolWeighted distributes calls proportionally to PoolCredential.Weight
+)
+
+const (
+	defaultBenchDuration      = time.Minute
+	defaultQuotaBenchDuration = time.Hour
+	insufficientQuotaType     = "insufficient_quota"
+)
+
+// PoolCredential is one API key and organization pair in a CredentialPool.
+type PoolCredential struct {
+	APIKey string
+	Org    string
+	// Weight is the relative share of calls this key receives with PoolWeighted. Defaults to 1.
+	Weight int
+}
+
+// PoolKeyUsage is a snapshot of the counters kept for one key of a CredentialPool.
+type PoolKeyUsage struct {
+	// Key is the API key with everything except its last four characters redacted
+	Key              string
+	Org              string
+	Requests         int64
+	Throttled        int64
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	BenchedUntil     time.Time
+}
+
+// CredentialPool distributes requests across several API keys and organizations. A key that is
+// rate limited (429) is benched for BenchDuration, or for the Retry-After period the API asked for,
+// and a key that runs out of quota is benched for QuotaBenchDuration. Use it with WithCredentialPool.
+// Streamed completions count tokens only when they are requested with StreamOptions.IncludeUsage.
+type CredentialPool struct {
+	// BenchDuration is how long a rate limited key is skipped when the response has no Retry-After header
+	BenchDuration time.Duration
+	// QuotaBenchDuration is how long a key that returned insufficient_quota is skipped
+	QuotaBenchDuration time.Duration
+
+	strategy PoolStrategy
+	mu       sync.Mutex
+	members  []*poolMember
+	next     int
+}
+
+type poolMember struct {
+	pool          *CredentialPool
+	credential    PoolCredential
+	lastThrottled time.Time
+	currentWeight int
+	usage         PoolKeyUsage
+}
+
+type poolMemberKey struct{}
+
+// NewCredentialPool returns a pool that selects among credentials with the given strategy.
+func NewCredentialPool(strategy PoolStrategy, credentials ...PoolCredential) *CredentialPool {
+	pool := &CredentialPool{
+		BenchDuration:      defaultBenchDuration,
+		QuotaBenchDuration: defaultQuotaBenchDuration,
+		strategy:           strategy,
+	}
+	for _, cred := range credentials {
+		if cred.Weight <= 0 {
+			cred.Weight = 1
+		}
+		pool.members = append(pool.members, &poolMember{
+			pool:       pool,
+			credential: cred,
+			usage:      PoolKeyUsage{Key: redactKey(cred.APIKey), Org: cred.Org},
+		})
+	}
+	return pool
+}
+
+// Usage returns the counters of every key in the pool, in the order the credentials were given.
+func (p *CredentialPool) Usage() []PoolKeyUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	usage := make([]PoolKeyUsage, 0, len(p.members))
+	for _, m := range p.members {
+		usage = append(usage, m.usage)
+	}
+	return usage
+}
+
+// pick selects the member that serves the next request. Benched members are skipped unless every
+// member is benched, in which case the one that becomes available first is used.
+func (p *CredentialPool) pick() *poolMember {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.members) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var available []*poolMember
+	for _, m := range p.members {
+		if !now.Before(m.usage.BenchedUntil) {
+			available = append(available, m)
+		}
+	}
+	var chosen *poolMember
+	switch {
+	case len(available) == 0:
+		chosen = p.members[0]
+		for _, m := range p.members[1:] {
+			if m.usage.BenchedUntil.Before(chosen.usage.BenchedUntil) {
+				chosen = m
+			}
+		}
+	case p.strategy == PoolLeastRecentlyThrottled:
+		chosen = available[0]
+		for _, m := range available[1:] {
+			if m.lastThrottled.Before(chosen.lastThrottled) ||
+				(m.lastThrottled.Equal(chosen.lastThrottled) && m.usage.Requests < chosen.usage.Requests) {
+				chosen = m
+			}
+		}
+	case p.strategy == PoolWeighted:
+		// smooth weighted round-robin, see nginx's upstream balancer
+		total := 0
+		for _, m := range available {
+			m.currentWeight += m.credential.Weight
+			total += m.credential.Weight
+			if chosen == nil || m.currentWeight > chosen.currentWeight {
+				chosen = m
+			}
+		}
+		chosen.currentWeight -= total
+	default:
+		for i := 0; i < len(p.members); i++ {
+			m := p.members[(p.next+i)%len(p.members)]
+			if !now.Before(m.usage.BenchedUntil) {
+				chosen = m
+				p.next = (p.next + i + 1) % len(p.members)
+				break
+			}
+		}
+	}
+	chosen.usage.Requests++
+	return chosen
+}
+
+// throttled benches a member after the API rejected one of its requests with 429.
+func (p *CredentialPool) throttled(m *poolMember, rsp *http.Response, apiErr APIError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	bench := p.BenchDuration
+	if apiErr.Type == insufficientQuotaType {
+		bench = p.QuotaBenchDuration
+	} else if seconds, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		bench = time.Duration(seconds) * time.Second
+	}
+	m.lastThrottled = now
+	m.usage.Throttled++
+	m.usage.BenchedUntil = now.Add(bench)
+}
+
+// record adds the token usage of a decoded response to the member's counters.
+func (p *CredentialPool) record(m *poolMember, output interface{}) {
+	usage, ok := usageOf(output)
+	if !ok || usage.TotalTokens == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m.usage.PromptTokens += int64(usage.PromptTokens)
+	m.usage.CompletionTokens += int64(usage.CompletionTokens)
+	m.usage.TotalTokens += int64(usage.TotalTokens)
+}
+
+// recordUsage adds the token usage of a response, or of a stream chunk, to the counters of the pool
+// member the request was issued with.
+func recordUsage(ctx context.Context, output interface{}) {
+	if member := poolMemberFromContext(ctx); member != nil {
+		member.pool.record(member, output)
+	}
+}
+
+// poolMemberFromContext returns the pool member a request was issued with, if any.
+func poolMemberFromContext(ctx context.Context) *poolMember {
+	m, _ := ctx.Value(poolMemberKey{}).(*poolMember)
+	return m
+}
+
+// usageOf extracts the token usage reported by any of the API response types.
+func usageOf(output interface{}) (CompletionResponseUsage, bool) {
+	switch v := output.(type) {
+	case *ChatCompletionResponse:
+		return CompletionResponseUsage{
+			PromptTokens:     v.Usage.PromptTokens,
+			CompletionTokens: v.Usage.CompletionTokens,
+			TotalTokens:      v.Usage.TotalTokens,
+		}, true
+	case *ChatCompletionStreamResponse:
+		return CompletionResponseUsage{
+			PromptTokens:     v.Usage.PromptTokens,
+			CompletionTokens: v.Usage.CompletionTokens,
+			TotalTokens:      v.Usage.TotalTokens,
+		}, true
+	case *CompletionResponse:
+		return v.Usage, true
+	case *EditsResponse:
+		return CompletionResponseUsage(v.Usage), true
+	case *EmbeddingsResponse:
+		return CompletionResponseUsage{PromptTokens: v.Usage.PromptTokens, TotalTokens: v.Usage.TotalTokens}, true
+	}
+	return CompletionResponseUsage{}, false
+}
+
+func redactKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
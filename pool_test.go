@@ -0,0 +1,181 @@
+package gpt_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func poolClient(server *gpttest.Server, pool *gpt.CredentialPool) gpt.Client {
+	return gpt.NewClient("", gpt.WithBaseURL(server.BaseURL()), gpt.WithCredentialPool(pool))
+}
+
+func chat(client gpt.Client, content string) (*gpt.ChatCompletionResponse, error) {
+	return client.ChatCompletion(context.Background(), &gpt.ChatCompletionRequest{
+		Model:    gpt.GPT4oMini,
+		Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: content}},
+	})
+}
+
+// usedKeys returns the API key of every chat request the server received, without the sk- prefix.
+func usedKeys(server *gpttest.Server) string {
+	var keys []string
+	for _, req := range server.Requests(gpttest.EndpointChatCompletions) {
+		keys = append(keys, strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer sk-"))
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestCredentialPoolStrategies(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  gpt.PoolStrategy
+		weights   []int
+		throttled bool // whether the first request is rate limited
+		want      string
+	}{
+		{"round robin", gpt.PoolRoundRobin, []int{1, 1, 1}, false, "a b c a b c"},
+		{"round robin after a throttled key", gpt.PoolRoundRobin, []int{1, 1}, true, "a b a b a b"},
+		{"least recently throttled", gpt.PoolLeastRecentlyThrottled, []int{1, 1, 1}, false, "a b c a b c"},
+		{"least recently throttled after a throttled key", gpt.PoolLeastRecentlyThrottled, []int{1, 1}, true, "a b b b b b"},
+		{"weighted", gpt.PoolWeighted, []int{3, 1}, false, "a a b a a a"},
+		{"weights default to one", gpt.PoolWeighted, []int{0, 1}, false, "a b a b a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var credentials []gpt.PoolCredential
+			for i, weight := range tt.weights {
+				credentials = append(credentials, gpt.PoolCredential{APIKey: "sk-" + string(rune('a'+i)), Weight: weight})
+			}
+			pool := gpt.NewCredentialPool(tt.strategy, credentials...)
+			// throttled keys are available again right away, so only the strategy decides
+			pool.BenchDuration = 0
+			server := gpttest.New(t)
+			if tt.throttled {
+				server.Enqueue(gpttest.EndpointChatCompletions, gpttest.RateLimited(0))
+			}
+			client := poolClient(server, pool)
+			for i := 0; i < 6; i++ {
+				if _, err := chat(client, "hi"); err != nil && !(tt.throttled && i == 0) {
+					t.Fatalf("call %d: %v", i, err)
+				}
+			}
+			if got := usedKeys(server); got != tt.want {
+				t.Errorf("keys %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialPoolBenchesThrottledKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		response gpttest.Response
+		bench    time.Duration
+	}{
+		{"rate limited", gpttest.RateLimited(0), time.Minute},
+		{"rate limited with retry after", gpttest.RateLimited(30 * time.Second), 30 * time.Second},
+		{"out of quota", gpttest.ErrorResponse(http.StatusTooManyRequests, "insufficient_quota", "quota"), time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := gpt.NewCredentialPool(gpt.PoolRoundRobin, gpt.PoolCredential{APIKey: "sk-a"}, gpt.PoolCredential{APIKey: "sk-b"})
+			server := gpttest.New(t)
+			server.Enqueue(gpttest.EndpointChatCompletions, tt.response)
+			client := poolClient(server, pool)
+			start := time.Now()
+			for i := 0; i < 4; i++ {
+				if _, err := chat(client, "hi"); (err != nil) != (i == 0) {
+					t.Fatalf("call %d: %v", i, err)
+				}
+			}
+			if got := usedKeys(server); got != "a b b b" {
+				t.Errorf("keys %q, want the throttled key skipped", got)
+			}
+			usage := pool.Usage()
+			benched := usage[0].BenchedUntil.Sub(start)
+			if usage[0].Throttled != 1 || benched < tt.bench || benched > tt.bench+time.Second {
+				t.Errorf("throttled key %+v benched for %v, want %v", usage[0], benched, tt.bench)
+			}
+			if usage[0].Requests != 1 || usage[1].Requests != 3 || usage[1].Throttled != 0 || !usage[1].BenchedUntil.IsZero() {
+				t.Errorf("usage %+v", usage)
+			}
+		})
+	}
+}
+
+func TestCredentialPoolUsesKeyBenchedShortest(t *testing.T) {
+	pool := gpt.NewCredentialPool(gpt.PoolRoundRobin, gpt.PoolCredential{APIKey: "sk-a"}, gpt.PoolCredential{APIKey: "sk-b"})
+	server := gpttest.New(t)
+	server.Enqueue(gpttest.EndpointChatCompletions, gpttest.RateLimited(time.Hour), gpttest.RateLimited(time.Minute))
+	client := poolClient(server, pool)
+	for i := 0; i < 3; i++ {
+		_, _ = chat(client, "hi")
+	}
+	if got := usedKeys(server); got != "a b b" {
+		t.Errorf("keys %q, want the key benched for a minute when all are benched", got)
+	}
+}
+
+func TestCredentialPoolRecordsUsage(t *testing.T) {
+	pool := gpt.NewCredentialPool(gpt.PoolRoundRobin, gpt.PoolCredential{APIKey: "sk-0001", Org: "org-a"})
+	server := gpttest.New(t)
+	client := poolClient(server, pool)
+	ctx := context.Background()
+	var want gpt.PoolKeyUsage
+	add := func(prompt, completion, total int) {
+		want.PromptTokens += int64(prompt)
+		want.CompletionTokens += int64(completion)
+		want.TotalTokens += int64(total)
+	}
+
+	rsp, err := chat(client, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(rsp.Usage.PromptTokens, rsp.Usage.CompletionTokens, rsp.Usage.TotalTokens)
+	for _, includeUsage := range []bool{true, false} {
+		request := &gpt.ChatCompletionRequest{
+			Model:         gpt.GPT4oMini,
+			Messages:      []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "stream"}},
+			StreamOptions: &gpt.StreamOptions{IncludeUsage: includeUsage},
+		}
+		err := client.ChatCompletionStream(ctx, request, func(rsp *gpt.ChatCompletionStreamResponse) {
+			add(rsp.Usage.PromptTokens, rsp.Usage.CompletionTokens, rsp.Usage.TotalTokens)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	completion := &gpt.CompletionRequest{
+		Model:         "gpt-3.5-turbo-instruct",
+		Prompt:        []string{"stream a completion"},
+		StreamOptions: &gpt.StreamOptions{IncludeUsage: true},
+	}
+	err = client.CompletionStream(ctx, completion, func(rsp *gpt.CompletionResponse) {
+		add(rsp.Usage.PromptTokens, rsp.Usage.CompletionTokens, rsp.Usage.TotalTokens)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddings, err := client.Embeddings(ctx, &gpt.EmbeddingsRequest{Model: "text-embedding-3-small", Input: []string{"a b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(embeddings.Usage.PromptTokens, 0, embeddings.Usage.TotalTokens)
+
+	usage := pool.Usage()[0]
+	if usage.TotalTokens == 0 || usage.PromptTokens != want.PromptTokens ||
+		usage.CompletionTokens != want.CompletionTokens || usage.TotalTokens != want.TotalTokens {
+		t.Errorf("usage %+v, want the tokens the responses reported: %+v", usage, want)
+	}
+	if usage.Requests != 5 || usage.Key != "****0001" || usage.Org != "org-a" {
+		t.Errorf("usage %+v, want 5 requests of the redacted key", usage)
+	}
+	server.AssertAuthorization(t, "sk-0001")
+}
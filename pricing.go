@@ -0,0 +1,138 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the price of a model in US dollars per million tokens.
+type ModelPrice struct {
+	// Input is the price of prompt tokens
+	Input float64
+	// CachedInput is the price of prompt tokens served from the prompt cache. Zero means Input.
+	CachedInput float64
+	// Output is the price of completion tokens
+	Output float64
+}
+
+// defaultModelPrices holds the list prices of the known models.
+var defaultModelPrices = map[string]ModelPrice{
+	GPT4o:                {Input: 2.50, CachedInput: 1.25, Output: 10},
+	GPT4oMini:            {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	GPT4Turbo:            {Input: 10, Output: 30},
+	GPT4:                 {Input: 30, Output: 60},
+	"gpt-4-32k":          {Input: 60, Output: 120},
+	GPT3Dot5Turbo:        {Input: 0.50, Output: 1.50},
+	GPT3Dot5Turbo0301:    {Input: 2, Output: 2},
+	TextEmbeddingAda002:  {Input: 0.10},
+	TextEmbedding3Small:  {Input: 0.02},
+	TextEmbedding3Large:  {Input: 0.13},
+	TextDavinci003Engine: {Input: 20, Output: 20},
+	TextDavinci002Engine: {Input: 20, Output: 20},
+	TextDavinci001Engine: {Input: 20, Output: 20},
+	TextCurie001Engine:   {Input: 2, Output: 2},
+	TextBabbage001Engine: {Input: 0.50, Output: 0.50},
+	TextAda001Engine:     {Input: 0.40, Output: 0.40},
+	DavinciEngine:        {Input: 20, Output: 20},
+	CurieEngine:          {Input: 2, Output: 2},
+	BabbageEngine:        {Input: 0.50, Output: 0.50},
+	AdaEngine:            {Input: 0.40, Output: 0.40},
+}
+
+// defaultImagePrices holds the price of a single generated image by size.
+var defaultImagePrices = map[string]float64{
+	CreateImageSize256x256:   0.016,
+	CreateImageSize512x512:   0.018,
+	CreateImageSize1024x1024: 0.020,
+}
+
+// Pricing is a price list for models and images. Prices can be changed at runtime; a Pricing is safe
+// for concurrent use.
+type Pricing struct {
+	mu     sync.RWMutex
+	models map[string]ModelPrice
+	images map[string]float64
+}
+
+// DefaultPricing returns a Pricing with the list prices of the known models, which can be overridden.
+func DefaultPricing() *Pricing {
+	p := &Pricing{
+		models: make(map[string]ModelPrice, len(defaultModelPrices)),
+		images: make(map[string]float64, len(defaultImagePrices)),
+	}
+	for model, price := range defaultModelPrices {
+		p.models[model] = price
+	}
+	for size, price := range defaultImagePrices {
+		p.images[size] = price
+	}
+	return p
+}
+
+// SetModelPrice sets the price of a model. A price set for a model also applies to its dated versions,
+// e.g. a price for gpt-4o applies to gpt-4o-2024-08-06 unless that has a price of its own.
+func (p *Pricing) SetModelPrice(model string, price ModelPrice) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.models == nil {
+		p.models = make(map[string]ModelPrice)
+	}
+	p.models[model] = price
+}
+
+// SetImagePrice sets the price of a single image of the given size.
+func (p *Pricing) SetImagePrice(size string, price float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.images == nil {
+		p.images = make(map[string]float64)
+	}
+	p.images[size] = price
+}
+
+// ModelPrice returns the price of a model, falling back to the longest priced model name that is a
+// prefix of it followed by a dash.
+func (p *Pricing) ModelPrice(model string) (ModelPrice, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if price, ok := p.models[model]; ok {
+		return price, true
+	}
+	best, found := "", false
+	for name := range p.models {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best, found = name, true
+		}
+	}
+	return p.models[best], found
+}
+
+// ImagePrice returns the price of a single image of the given size.
+func (p *Pricing) ImagePrice(size string) (float64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.images[size]
+	return price, ok
+}
+
+// Cost returns the price in US dollars of a call to model that used the given tokens. cached is the part
+// of promptTokens served from the prompt cache. Unknown models cost nothing.
+func (p *Pricing) Cost(model string, promptTokens, cached, completionTokens int) float64 {
+	price, ok := p.ModelPrice(model)
+	if !ok {
+		return 0
+	}
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	return (float64(promptTokens-cached)*price.Input + float64(cached)*cachedPrice +
+		float64(completionTokens)*price.Output) / 1e6
+}
+
+// ImageCost returns the price in US dollars of n images of the given size. Unknown sizes cost nothing.
+func (p *Pricing) ImageCost(size string, n int) float64 {
+	price, _ := p.ImagePrice(size)
+	return price * float64(n)
+}
@@ -0,0 +1,321 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+// Document is a text to index.
+type Document struct {
+	// ID identifies the document; chunk IDs are derived from it
+	ID   string
+	Text string
+	// Metadata is copied to every chunk of the document
+	Metadata map[string]string
+}
+
+// Chunk is a part of a document that is embedded and retrieved on its own.
+type Chunk struct {
+	// ID is the document ID followed by # and the position of the chunk in the document
+	ID         string
+	DocumentID string
+	Index      int
+	Text       string
+	// Metadata holds the document's metadata, and MetadataSection for chunks of a markdown section
+	Metadata map[string]string
+}
+
+// MetadataSection is the metadata key of the heading path of a markdown chunk, e.g. "Install > Linux".
+const MetadataSection = "section"
+
+// Chunker splits a document into chunks.
+type Chunker interface {
+	Chunk(doc Document) []Chunk
+}
+
+// chunks turns the texts of a document into chunks.
+func chunks(doc Document, texts []string, metadata []map[string]string) []Chunk {
+	out := make([]Chunk, 0, len(texts))
+	for i, text := range texts {
+		md := make(map[string]string, len(doc.Metadata)+1)
+		for k, v := range doc.Metadata {
+			md[k] = v
+		}
+		if metadata != nil {
+			for k, v := range metadata[i] {
+				md[k] = v
+			}
+		}
+		out = append(out, Chunk{
+			ID:         fmt.Sprintf("%s#%d", doc.ID, i),
+			DocumentID: doc.ID,
+			Index:      i,
+			Text:       text,
+			Metadata:   md,
+		})
+	}
+	return out
+}
+
+// encoding returns enc, or cl100k_base, the encoding of the embedding models, if enc is nil.
+func encoding(enc *tokenizer.Encoding) *tokenizer.Encoding {
+	if enc != nil {
+		return enc
+	}
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		// the rank files are embedded, so this only fails if the package is broken
+		panic(err)
+	}
+	return enc
+}
+
+// TokenChunker splits documents into windows of Size tokens, each starting Overlap tokens before the
+// previous one ended. Windows are cut at character boundaries, so a chunk may be a token shorter.
+type TokenChunker struct {
+	// Encoding counts the tokens. Defaults to cl100k_base.
+	Encoding *tokenizer.Encoding
+	Size     int
+	Overlap  int
+}
+
+// NewTokenChunker returns a TokenChunker with windows of size tokens overlapping by overlap tokens.
+func NewTokenChunker(enc *tokenizer.Encoding, size, overlap int) *TokenChunker {
+	return &TokenChunker{Encoding: enc, Size: size, Overlap: overlap}
+}
+
+// Chunk implements Chunker.
+func (c *TokenChunker) Chunk(doc Document) []Chunk {
+	return chunks(doc, c.split(doc.Text), nil)
+}
+
+func (c *TokenChunker) split(text string) []string {
+	enc := encoding(c.Encoding)
+	size, overlap := c.Size, c.Overlap
+	if size <= 0 {
+		size = 512
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	// offsets[i] is the byte offset in text where token i starts
+	tokens := enc.Encode(text)
+	offsets := make([]int, len(tokens)+1)
+	for i, token := range tokens {
+		b, _ := enc.TokenBytes(token)
+		offsets[i+1] = offsets[i] + len(b)
+	}
+	var texts []string
+	for start := 0; start < len(tokens); start += size - overlap {
+		end := start + size
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		if chunk := strings.TrimSpace(text[runeStart(text, offsets[start]):runeStart(text, offsets[end])]); chunk != "" {
+			texts = append(texts, chunk)
+		}
+		if end == len(tokens) {
+			break
+		}
+	}
+	return texts
+}
+
+// runeStart moves a byte offset forward to the start of the next character.
+func runeStart(text string, i int) int {
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// SentenceChunker splits documents into chunks of whole sentences of up to MaxTokens tokens. A sentence
+// longer than MaxTokens is split by tokens.
+type SentenceChunker struct {
+	// Encoding counts the tokens. Defaults to cl100k_base.
+	Encoding  *tokenizer.Encoding
+	MaxTokens int
+}
+
+// NewSentenceChunker returns a SentenceChunker with chunks of up to maxTokens tokens.
+func NewSentenceChunker(enc *tokenizer.Encoding, maxTokens int) *SentenceChunker {
+	return &SentenceChunker{Encoding: enc, MaxTokens: maxTokens}
+}
+
+// Chunk implements Chunker.
+func (c *SentenceChunker) Chunk(doc Document) []Chunk {
+	return chunks(doc, c.split(doc.Text), nil)
+}
+
+func (c *SentenceChunker) split(text string) []string {
+	enc := encoding(c.Encoding)
+	maxTokens := c.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 512
+	}
+	var texts []string
+	var current strings.Builder
+	tokens := 0
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			texts = append(texts, s)
+		}
+		current.Reset()
+		tokens = 0
+	}
+	for _, sentence := range Sentences(text) {
+		n := enc.Count(sentence)
+		if n > maxTokens {
+			flush()
+			texts = append(texts, (&TokenChunker{Encoding: enc, Size: maxTokens}).split(sentence)...)
+			continue
+		}
+		if tokens+n+1 > maxTokens {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+			tokens++
+		}
+		current.WriteString(sentence)
+		tokens += n
+	}
+	flush()
+	return texts
+}
+
+// Sentences splits text into sentences, ending a sentence at ., ! or ? followed by a space, and at a
+// blank line. Full-width stops end a sentence without a space.
+func Sentences(text string) []string {
+	var sentences []string
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			sentences = append(sentences, strings.Join(strings.Fields(s), " "))
+		}
+		start = end
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := i + size
+		switch {
+		case r == '。' || r == '！' || r == '？':
+			add(next)
+		case r == '.' || r == '!' || r == '?':
+			// include closing quotes and brackets in the sentence
+			for next < len(text) {
+				closing, size := utf8.DecodeRuneInString(text[next:])
+				if !strings.ContainsRune(`"')]”’`, closing) {
+					break
+				}
+				next += size
+			}
+			if following, _ := utf8.DecodeRuneInString(text[next:]); next == len(text) || unicode.IsSpace(following) {
+				add(next)
+			}
+		case r == '\n' && strings.HasPrefix(strings.TrimLeft(text[next:], " \t\r"), "\n"):
+			add(next)
+		}
+		i = next
+	}
+	add(len(text))
+	return sentences
+}
+
+// MarkdownChunker splits markdown documents at their headings. Every chunk starts with the path of
+// headings it is under, which is also stored as MetadataSection. Sections longer than MaxTokens are
+// split by sentences.
+type MarkdownChunker struct {
+	// Encoding counts the tokens. Defaults to cl100k_base.
+	Encoding  *tokenizer.Encoding
+	MaxTokens int
+}
+
+// NewMarkdownChunker returns a MarkdownChunker with chunks of up to maxTokens tokens.
+func NewMarkdownChunker(enc *tokenizer.Encoding, maxTokens int) *MarkdownChunker {
+	return &MarkdownChunker{Encoding: enc, MaxTokens: maxTokens}
+}
+
+// Chunk implements Chunker.
+func (c *MarkdownChunker) Chunk(doc Document) []Chunk {
+	enc := encoding(c.Encoding)
+	maxTokens := c.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 512
+	}
+	var texts []string
+	var metadata []map[string]string
+	for _, section := range markdownSections(doc.Text) {
+		path := strings.Join(section.headings, " > ")
+		prefix := ""
+		if path != "" {
+			prefix = path + "\n\n"
+		}
+		parts := []string{section.body}
+		if enc.Count(prefix+section.body) > maxTokens {
+			budget := maxTokens - enc.Count(prefix)
+			if budget < maxTokens/2 {
+				budget = maxTokens / 2
+			}
+			parts = (&SentenceChunker{Encoding: enc, MaxTokens: budget}).split(section.body)
+		}
+		for _, part := range parts {
+			texts = append(texts, prefix+part)
+			metadata = append(metadata, map[string]string{MetadataSection: path})
+		}
+	}
+	return chunks(doc, texts, metadata)
+}
+
+type markdownSection struct {
+	headings []string
+	body     string
+}
+
+// markdownSections splits markdown at ATX headings outside of code fences. Sections without text are
+// dropped.
+func markdownSections(text string) []markdownSection {
+	var sections []markdownSection
+	var headings []string
+	var body []string
+	fenced := false
+	flush := func() {
+		if b := strings.TrimSpace(strings.Join(body, "\n")); b != "" {
+			sections = append(sections, markdownSection{headings: append([]string(nil), headings...), body: b})
+		}
+		body = body[:0]
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if level, title := headingOf(line); level > 0 && !fenced {
+			flush()
+			if level > len(headings) {
+				level = len(headings) + 1
+			}
+			headings = append(headings[:level-1], title)
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return sections
+}
+
+// headingOf returns the level and title of an ATX heading line, or 0.
+func headingOf(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+}
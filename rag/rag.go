@@ -0,0 +1,287 @@
+// Package rag answers questions from your own documents: documents are split into chunks, embedded with
+// the Embeddings API and stored in a vector store, and the chunks most similar to a question are sent to
+// the chat model as numbered sources it cites in its answer.
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Define pipeline defaults
+const (
+	DefaultTopK           = 4   // DefaultTopK is the number of chunks retrieved for a question
+	DefaultChunkTokens    = 512 // DefaultChunkTokens is the size of the chunks of the default chunker
+	DefaultOverlapTokens  = 64  // DefaultOverlapTokens is the overlap of the chunks of the default chunker
+	DefaultEmbeddingModel = gpt.TextEmbeddingAda002
+)
+
+// DefaultPrompt is the system message of the chat requests, telling the model to answer from the
+// sources and cite them.
+const DefaultPrompt = "Answer the question using only the numbered sources below. " +
+	"Cite every source you use by its number in square brackets, like [1]. " +
+	"If the sources don't contain the answer, say that you don't know."
+
+// ErrNoSources is returned by Ask when the store has no chunks to answer from.
+var ErrNoSources = errors.New("rag: no sources found")
+
+// Option are options that can be passed when creating a new pipeline
+type Option func(*Pipeline) *Pipeline
+
+// WithChunker is a pipeline option that sets how documents are split. The default is a TokenChunker of
+// DefaultChunkTokens tokens overlapping by DefaultOverlapTokens.
+func WithChunker(chunker Chunker) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.chunker = chunker
+		return p
+	}
+}
+
+// WithEmbeddingModel is a pipeline option that sets the embedding model of the chunks and questions.
+func WithEmbeddingModel(model string) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.embedding.Model = model
+		return p
+	}
+}
+
+// WithEmbedOptions is a pipeline option that sets how chunks are embedded, see gpt.EmbedAll. An empty
+// Model keeps the pipeline's embedding model.
+func WithEmbedOptions(opts gpt.EmbedOptions) Option {
+	return func(p *Pipeline) *Pipeline {
+		if opts.Model == "" {
+			opts.Model = p.embedding.Model
+		}
+		p.embedding = opts
+		return p
+	}
+}
+
+// WithTopK is a pipeline option that sets the number of chunks retrieved for a question.
+func WithTopK(k int) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.topK = k
+		return p
+	}
+}
+
+// WithMinScore is a pipeline option that drops retrieved chunks less similar to the question than score.
+func WithMinScore(score float64) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.minScore = &score
+		return p
+	}
+}
+
+// WithContextTokens is a pipeline option that limits the tokens of the sources sent with a question.
+// The least similar chunks are left out first.
+func WithContextTokens(tokens int) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.contextTokens = tokens
+		return p
+	}
+}
+
+// WithPrompt is a pipeline option that replaces DefaultPrompt.
+func WithPrompt(prompt string) Option {
+	return func(p *Pipeline) *Pipeline {
+		p.prompt = prompt
+		return p
+	}
+}
+
+// Pipeline indexes documents and answers questions from them. It is safe for concurrent use if its
+// Store is.
+type Pipeline struct {
+	client        gpt.Client
+	store         Store
+	chunker       Chunker
+	embedding     gpt.EmbedOptions
+	topK          int
+	minScore      *float64
+	contextTokens int
+	prompt        string
+}
+
+// New returns a pipeline that embeds with client and keeps the chunks in store, or in an exact in-memory
+// VectorStore if store is nil.
+func New(client gpt.Client, store Store, options ...Option) *Pipeline {
+	if store == nil {
+		store = NewVectorStore(nil)
+	}
+	p := &Pipeline{
+		client:    client,
+		store:     store,
+		chunker:   NewTokenChunker(nil, DefaultChunkTokens, DefaultOverlapTokens),
+		embedding: gpt.EmbedOptions{Model: DefaultEmbeddingModel},
+		topK:      DefaultTopK,
+		prompt:    DefaultPrompt,
+	}
+	for _, opt := range options {
+		p = opt(p)
+	}
+	return p
+}
+
+// Store returns the store of the pipeline.
+func (p *Pipeline) Store() Store {
+	return p.store
+}
+
+// Index chunks and embeds documents and adds them to the store, returning the chunks added.
+// Re-indexing a document replaces all of its chunks.
+func (p *Pipeline) Index(ctx context.Context, docs ...Document) ([]Chunk, error) {
+	var all []Chunk
+	for _, doc := range docs {
+		all = append(all, p.chunker.Chunk(doc)...)
+	}
+	var vectors [][]float32
+	if len(all) > 0 {
+		texts := make([]string, len(all))
+		for i, chunk := range all {
+			texts[i] = chunk.Text
+		}
+		rsp, err := gpt.EmbedAll(ctx, p.client, texts, p.embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		vectors = make([][]float32, len(rsp.Data))
+		for i := range rsp.Data {
+			vectors[i] = rsp.Data[i].Float32()
+		}
+	}
+	// the old chunks are removed once the new ones are embedded, so a failed embedding keeps them
+	for _, doc := range docs {
+		if err := p.store.DeleteDocument(ctx, doc.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete chunks: %w", err)
+		}
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	if err := p.store.Add(ctx, all, vectors); err != nil {
+		return nil, fmt.Errorf("failed to store chunks: %w", err)
+	}
+	return all, nil
+}
+
+// Retrieve returns the chunks most similar to question, most similar first.
+func (p *Pipeline) Retrieve(ctx context.Context, question string) ([]Match, error) {
+	rsp, err := p.client.Embeddings(ctx, &gpt.EmbeddingsRequest{
+		Input:          []string{question},
+		Model:          p.embedding.Model,
+		User:           p.embedding.User,
+		EncodingFormat: p.embedding.EncodingFormat,
+		Dimensions:     p.embedding.Dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	if len(rsp.Data) == 0 {
+		return nil, fmt.Errorf("failed to embed question: empty response")
+	}
+	matches, err := p.store.Search(ctx, rsp.Data[0].Float32(), p.topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	if p.minScore != nil {
+		kept := matches[:0]
+		for _, m := range matches {
+			if m.Score >= *p.minScore {
+				kept = append(kept, m)
+			}
+		}
+		matches = kept
+	}
+	if p.contextTokens > 0 {
+		enc := encoding(nil)
+		tokens := 0
+		for i, m := range matches {
+			if tokens += enc.Count(m.Text); tokens > p.contextTokens && i > 0 {
+				matches = matches[:i]
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Request assembles the chat request answering question from sources: the prompt as system message,
+// then the sources numbered from 1 in order, followed by the question. request sets the model and the
+// sampling parameters; its messages are replaced. A nil request uses gpt.GPT4oMini.
+func (p *Pipeline) Request(request *gpt.ChatCompletionRequest, question string, sources []Match) *gpt.ChatCompletionRequest {
+	out := gpt.ChatCompletionRequest{Model: gpt.GPT4oMini}
+	if request != nil {
+		out = *request
+	}
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	for i, m := range sources {
+		fmt.Fprintf(&b, "\n[%d]\n%s\n", i+1, m.Text)
+	}
+	fmt.Fprintf(&b, "\nQuestion: %s", question)
+	out.Messages = []gpt.ChatCompletionRequestMessage{
+		{Role: "system", Content: p.prompt},
+		{Role: "user", Content: b.String()},
+	}
+	return &out
+}
+
+// Answer is the answer to a question.
+type Answer struct {
+	// Text is the reply of the model, citing sources as [n]
+	Text string
+	// Sources are the chunks sent to the model; [n] in Text refers to Sources[n-1]
+	Sources []Match
+	// ChunkIDs are the IDs of the sources cited in Text, in the order first cited
+	ChunkIDs []string
+	Response *gpt.ChatCompletionResponse
+}
+
+// Ask answers question from the indexed documents. request sets the model and the sampling parameters,
+// see Request.
+func (p *Pipeline) Ask(ctx context.Context, request *gpt.ChatCompletionRequest, question string) (*Answer, error) {
+	sources, err := p.Retrieve(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, ErrNoSources
+	}
+	rsp, err := p.client.ChatCompletion(ctx, p.Request(request, question, sources))
+	if err != nil {
+		return nil, fmt.Errorf("failed to answer question: %w", err)
+	}
+	if len(rsp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to answer question: empty response")
+	}
+	text := rsp.Choices[0].Message.Content
+	return &Answer{Text: text, Sources: sources, ChunkIDs: Cited(text, sources), Response: rsp}, nil
+}
+
+// citation matches [1] and [1, 3].
+var citation = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Cited returns the IDs of the sources cited in text as [n], in the order first cited. Numbers that
+// aren't sources are ignored.
+func Cited(text string, sources []Match) []string {
+	var ids []string
+	seen := make(map[int]bool)
+	for _, m := range citation.FindAllStringSubmatch(text, -1) {
+		for _, s := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 || n > len(sources) || seen[n] {
+				continue
+			}
+			seen[n] = true
+			ids = append(ids, sources[n-1].ID)
+		}
+	}
+	return ids
+}
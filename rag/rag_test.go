@@ -0,0 +1,61 @@
+package rag_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/gpttest"
+	"github.com/hanyuancheung/gpt-go/rag"
+	"github.com/hanyuancheung/gpt-go/vectorstore"
+)
+
+func TestIndexReplacesDocument(t *testing.T) {
+	server := gpttest.New(t)
+	store := vectorstore.New()
+	pipeline := rag.New(server.Client(), rag.NewVectorStore(store), rag.WithChunker(rag.NewTokenChunker(nil, 4, 0)))
+	ctx := context.Background()
+
+	long := rag.Document{ID: "doc", Text: strings.Repeat("the quick brown fox jumps. ", 6)}
+	chunks, err := pipeline.Index(ctx, long, rag.Document{ID: "other", Text: "another document"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 4 {
+		t.Fatalf("indexed %d chunks, want a long document", len(chunks))
+	}
+	if _, err := pipeline.Index(ctx, rag.Document{ID: "doc", Text: "short now"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range chunks {
+		_, ok := store.Get(chunk.ID)
+		if want := chunk.DocumentID == "other" || chunk.Index == 0; ok != want {
+			t.Errorf("chunk %s stored: %v, want %v", chunk.ID, ok, want)
+		}
+	}
+	if store.Len() != 2 {
+		t.Errorf("%d chunks stored, want 2", store.Len())
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"One. Two! Three?", []string{"One.", "Two!", "Three?"}},
+		{"Version 1.2 is out. Get it", []string{"Version 1.2 is out.", "Get it"}},
+		{`He said "stop." Then left.`, []string{`He said "stop."`, "Then left."}},
+		{"He said “stop.” Then left.", []string{"He said “stop.”", "Then left."}},
+		{"It’s ‘done.’ Next (really.) Last", []string{"It’s ‘done.’", "Next (really.)", "Last"}},
+		{"Stop.　Next", []string{"Stop.", "Next"}},
+		{"首先。然后！最后", []string{"首先。", "然后！", "最后"}},
+		{"first paragraph\n\nsecond\nline", []string{"first paragraph", "second line"}},
+	}
+	for _, tt := range tests {
+		if got := rag.Sentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Sentences(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
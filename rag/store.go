@@ -0,0 +1,100 @@
+package rag
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go/vectorstore"
+)
+
+// Match is a chunk found by a Store.
+type Match struct {
+	Chunk
+	// Score is the similarity to the question; higher is more similar
+	Score float64
+}
+
+// Store keeps the embedded chunks of a Pipeline. Implementations must be safe for concurrent use.
+type Store interface {
+	// Add stores chunks with their embeddings, replacing chunks stored under the same IDs
+	Add(ctx context.Context, chunks []Chunk, vectors [][]float32) error
+	// Search returns the k chunks most similar to vector, most similar first
+	Search(ctx context.Context, vector []float32, k int) ([]Match, error)
+	// DeleteDocument removes the chunks of a document
+	DeleteDocument(ctx context.Context, documentID string) error
+}
+
+// metadata keys of the chunk fields in a VectorStore, prefixed so they don't collide with document metadata
+const (
+	keyDocument = "rag.document"
+	keyIndex    = "rag.index"
+	keyText     = "rag.text"
+)
+
+// VectorStore is a Store backed by a vectorstore.Store, keeping the chunk texts in the item metadata.
+// The underlying store can be saved and loaded with its Save and Load.
+type VectorStore struct {
+	Store *vectorstore.Store
+	// Filter restricts the searches, matching the metadata of the documents
+	Filter vectorstore.Filter
+}
+
+// NewVectorStore returns a VectorStore over store, or over a new exact cosine store if store is nil.
+func NewVectorStore(store *vectorstore.Store) *VectorStore {
+	if store == nil {
+		store = vectorstore.New()
+	}
+	return &VectorStore{Store: store}
+}
+
+// Add implements Store.
+func (s *VectorStore) Add(_ context.Context, chunks []Chunk, vectors [][]float32) error {
+	for i, chunk := range chunks {
+		md := make(map[string]string, len(chunk.Metadata)+3)
+		for k, v := range chunk.Metadata {
+			md[k] = v
+		}
+		md[keyDocument] = chunk.DocumentID
+		md[keyIndex] = strconv.Itoa(chunk.Index)
+		md[keyText] = chunk.Text
+		if err := s.Store.Add(chunk.ID, vectors[i], md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteDocument implements Store.
+func (s *VectorStore) DeleteDocument(_ context.Context, documentID string) error {
+	s.Store.DeleteMatching(vectorstore.Equals(keyDocument, documentID))
+	return nil
+}
+
+// Search implements Store.
+func (s *VectorStore) Search(_ context.Context, vector []float32, k int) ([]Match, error) {
+	results, err := s.Store.Search(vector, k, s.Filter)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]Match, len(results))
+	for i, r := range results {
+		chunk := Chunk{ID: r.ID, Metadata: make(map[string]string, len(r.Metadata))}
+		for k, v := range r.Metadata {
+			switch k {
+			case keyDocument:
+				chunk.DocumentID = v
+			case keyIndex:
+				chunk.Index, _ = strconv.Atoi(v)
+			case keyText:
+				chunk.Text = v
+			default:
+				if !strings.HasPrefix(k, "rag.") {
+					chunk.Metadata[k] = v
+				}
+			}
+		}
+		matches[i] = Match{Chunk: chunk, Score: r.Score}
+	}
+	return matches, nil
+}
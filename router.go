@@ -0,0 +1,398 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RoutePolicy decides the order in which a Router tries its backends.
+type RoutePolicy int
+
+// Define router policies
+const (
+	RouteFallback RoutePolicy = iota // RouteFallback tries the backends in the order they were given
+	RouteLatency                     // RouteLatency tries the backend with the lowest observed latency first
+	RouteCost                        // RouteCost tries the cheapest backend first
+	RouteCanary                      // RouteCanary picks the first backend randomly by RouteBackend.Percent
+)
+
+// latencyDecay is the weight of the newest sample in the moving average used by RouteLatency.
+const latencyDecay = 0.2
+
+// failurePenalty is added to the latency sample of a failed attempt, so RouteLatency tries failing
+// backends after healthy ones.
+const failurePenalty = 10 * time.Second
+
+// ErrNoBackend is returned by a Router that has no backends to route to.
+var ErrNoBackend = errors.New("router has no backends")
+
+// RouteBackend is one OpenAI-compatible backend behind a Router.
+type RouteBackend struct {
+	// Name identifies the backend in RouteRecords
+	Name string
+	// Client is the client used to talk to the backend
+	Client Client
+	// Models maps a requested model name to the name used by this backend, e.g. an Azure deployment name.
+	// Models missing from the map are sent unchanged.
+	Models map[string]string
+	// Cost is the relative price of the backend used by RouteCost
+	Cost float64
+	// Percent is the share of calls that go to this backend first with RouteCanary
+	Percent float64
+}
+
+// RouteRecord describes how a Router served a single call.
+type RouteRecord struct {
+	// Method is the name of the Client method that was called
+	Method string
+	// Model is the requested model, before any mapping
+	Model string
+	// Backend is the name of the backend that served the call, or of the last one tried if all failed
+	Backend string
+	// Attempts is the number of backends that were tried
+	Attempts int
+	// Latency is the duration of the final attempt
+	Latency time.Duration
+	// Err is the error returned to the caller
+	Err error
+}
+
+// RouterOption are options that can be passed when creating a new router
+type RouterOption func(*Router) *Router
+
+// WithRouteRecorder is a router option that calls fn after every routed call
+func WithRouteRecorder(fn func(RouteRecord)) RouterOption {
+	return func(r *Router) *Router {
+		r.recorder = fn
+		return r
+	}
+}
+
+// WithRetryClassifier is a router option that overrides which errors move on to the next backend.
+// The default is IsRetryable.
+func WithRetryClassifier(fn func(error) bool) RouterOption {
+	return func(r *Router) *Router {
+		r.retryable = fn
+		return r
+	}
+}
+
+// Router is a Client that spreads calls over several OpenAI-compatible backends according to a
+// RoutePolicy, moving on to the next backend when a call fails with a retryable error.
+type Router struct {
+	policy    RoutePolicy
+	backends  []RouteBackend
+	recorder  func(RouteRecord)
+	retryable func(error) bool
+
+	mu      sync.Mutex
+	latency []time.Duration
+	rand    *rand.Rand
+}
+
+var _ Client = (*Router)(nil)
+
+// NewRouter returns a Router over the given backends.
+func NewRouter(policy RoutePolicy, backends []RouteBackend, options ...RouterOption) *Router {
+	r := &Router{
+		policy:    policy,
+		backends:  backends,
+		retryable: IsRetryable,
+		latency:   make([]time.Duration, len(backends)),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range options {
+		r = opt(r)
+	}
+	return r
+}
+
+// order returns the indexes of the backends in the order they should be tried.
+func (r *Router) order() []int {
+	order := make([]int, len(r.backends))
+	for i := range order {
+		order[i] = i
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.policy {
+	case RouteLatency:
+		// backends without samples sort first so they get measured
+		sort.SliceStable(order, func(i, j int) bool {
+			return r.latency[order[i]] < r.latency[order[j]]
+		})
+	case RouteCost:
+		sort.SliceStable(order, func(i, j int) bool {
+			return r.backends[order[i]].Cost < r.backends[order[j]].Cost
+		})
+	case RouteCanary:
+		total, last := 0.0, 0
+		for i, b := range r.backends {
+			total += b.Percent
+			if b.Percent > 0 {
+				last = i
+			}
+		}
+		if total <= 0 {
+			break
+		}
+		// rounding can leave pick above the sum of the shares, so it falls back to the last weighted backend
+		pick, n := r.rand.Float64()*total, last
+		for i, b := range r.backends {
+			if pick < b.Percent {
+				n = i
+				break
+			}
+			pick -= b.Percent
+		}
+		copy(order[1:n+1], order[:n])
+		order[0] = n
+	}
+	return order
+}
+
+func (r *Router) observe(i int, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.latency[i] == 0 {
+		r.latency[i] = d
+		return
+	}
+	r.latency[i] = time.Duration(latencyDecay*float64(d) + (1-latencyDecay)*float64(r.latency[i]))
+}
+
+// route calls fn with each backend in policy order until one succeeds or fails with an error that is
+// not retryable. model is mapped through the backend's Models before it is passed to fn.
+func (r *Router) route(ctx context.Context, method, model string, fn func(b RouteBackend, model string) error) error {
+	if len(r.backends) == 0 {
+		return ErrNoBackend
+	}
+	record := RouteRecord{Method: method, Model: model}
+	for _, i := range r.order() {
+		b := r.backends[i]
+		mapped := model
+		if m, ok := b.Models[model]; ok {
+			mapped = m
+		}
+		start := time.Now()
+		record.Err = fn(b, mapped)
+		record.Latency = time.Since(start)
+		record.Backend = b.Name
+		record.Attempts++
+		if record.Err == nil {
+			r.observe(i, record.Latency)
+			break
+		}
+		if final, ok := record.Err.(finalError); ok {
+			record.Err = final.error
+			break
+		}
+		if ctx.Err() != nil || !r.retryable(record.Err) {
+			break
+		}
+		r.observe(i, record.Latency+failurePenalty)
+	}
+	if r.recorder != nil {
+		r.recorder(record)
+	}
+	return record.Err
+}
+
+// Engines lists the engines of the first backend that answers.
+func (r *Router) Engines(ctx context.Context) (*EnginesResponse, error) {
+	var output *EnginesResponse
+	err := r.route(ctx, "Engines", "", func(b RouteBackend, _ string) (err error) {
+		output, err = b.Client.Engines(ctx)
+		return err
+	})
+	return output, err
+}
+
+// Engine retrieves an engine from the first backend that answers.
+func (r *Router) Engine(ctx context.Context, engine string) (*EngineObject, error) {
+	var output *EngineObject
+	err := r.route(ctx, "Engine", engine, func(b RouteBackend, engine string) (err error) {
+		output, err = b.Client.Engine(ctx, engine)
+		return err
+	})
+	return output, err
+}
+
+// ChatCompletion creates a chat completion on the first backend that answers.
+func (r *Router) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	var output *ChatCompletionResponse
+	err := r.route(ctx, "ChatCompletion", chatModel(request), func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		output, err = b.Client.ChatCompletion(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// ChatCompletionStream streams a chat completion from the first backend that answers. Once a backend
+// has delivered data the call is no longer moved to another backend.
+func (r *Router) ChatCompletionStream(ctx context.Context, request *ChatCompletionRequest, onData func(*ChatCompletionStreamResponse)) error {
+	streamed := false
+	return r.route(ctx, "ChatCompletionStream", chatModel(request), func(b RouteBackend, model string) error {
+		req := *request
+		req.Model = model
+		err := b.Client.ChatCompletionStream(ctx, &req, func(rsp *ChatCompletionStreamResponse) {
+			streamed = true
+			onData(rsp)
+		})
+		if err != nil && streamed {
+			return finalError{err}
+		}
+		return err
+	})
+}
+
+// Completion creates a completion on the first backend that answers.
+func (r *Router) Completion(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	var output *CompletionResponse
+	err := r.route(ctx, "Completion", request.Model, func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		output, err = b.Client.Completion(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// CompletionStream streams a completion from the first backend that answers.
+func (r *Router) CompletionStream(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	streamed := false
+	return r.route(ctx, "CompletionStream", request.Model, func(b RouteBackend, model string) error {
+		req := *request
+		req.Model = model
+		err := b.Client.CompletionStream(ctx, &req, func(rsp *CompletionResponse) {
+			streamed = true
+			onData(rsp)
+		})
+		if err != nil && streamed {
+			return finalError{err}
+		}
+		return err
+	})
+}
+
+// CompletionWithEngine is the same as Completion.
+func (r *Router) CompletionWithEngine(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return r.Completion(ctx, request)
+}
+
+// CompletionStreamWithEngine is the same as CompletionStream.
+func (r *Router) CompletionStreamWithEngine(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return r.CompletionStream(ctx, request, onData)
+}
+
+// Edits creates an edit on the first backend that answers.
+func (r *Router) Edits(ctx context.Context, request *EditsRequest) (*EditsResponse, error) {
+	var output *EditsResponse
+	err := r.route(ctx, "Edits", request.Model, func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		output, err = b.Client.Edits(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// Search performs a search with the default engine of the first backend that answers.
+func (r *Router) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
+	var output *SearchResponse
+	err := r.route(ctx, "Search", "", func(b RouteBackend, _ string) (err error) {
+		output, err = b.Client.Search(ctx, request)
+		return err
+	})
+	return output, err
+}
+
+// SearchWithEngine performs a search with the specified engine on the first backend that answers.
+func (r *Router) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
+	var output *SearchResponse
+	err := r.route(ctx, "SearchWithEngine", engine, func(b RouteBackend, engine string) (err error) {
+		output, err = b.Client.SearchWithEngine(ctx, engine, request)
+		return err
+	})
+	return output, err
+}
+
+// Embeddings creates embeddings on the first backend that answers.
+func (r *Router) Embeddings(ctx context.Context, request *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	var output *EmbeddingsResponse
+	err := r.route(ctx, "Embeddings", request.Model, func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		output, err = b.Client.Embeddings(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// Image creates an image on the first backend that answers.
+func (r *Router) Image(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	var output *ImageResponse
+	err := r.route(ctx, "Image", "", func(b RouteBackend, _ string) (err error) {
+		output, err = b.Client.Image(ctx, request)
+		return err
+	})
+	return output, err
+}
+
+// Moderation classifies texts on the first backend that answers.
+func (r *Router) Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error) {
+	var output *ModerationResponse
+	err := r.route(ctx, "Moderation", request.Model, func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		output, err = b.Client.Moderation(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// Transcription transcribes audio on the first backend that answers. The audio is read once, so it can
+// be sent again to the next backend.
+func (r *Router) Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error) {
+	var audio []byte
+	if request.Audio != nil {
+		var err error
+		if audio, err = io.ReadAll(request.Audio); err != nil {
+			return nil, fmt.Errorf("failed to read audio: %w", err)
+		}
+	}
+	var output *TranscriptionResponse
+	err := r.route(ctx, "Transcription", request.Model, func(b RouteBackend, model string) (err error) {
+		req := *request
+		req.Model = model
+		if request.Audio != nil {
+			req.Audio = bytes.NewReader(audio)
+		}
+		output, err = b.Client.Transcription(ctx, &req)
+		return err
+	})
+	return output, err
+}
+
+// finalError stops a Router from trying further backends, e.g. after a stream has delivered partial data.
+type finalError struct {
+	error
+}
+
+// chatModel returns the model a chat request will use, applying the client default.
+func chatModel(request *ChatCompletionRequest) string {
+	if request.Model == "" {
+		return GPT3Dot5Turbo
+	}
+	return request.Model
+}
@@ -0,0 +1,75 @@
+package gpt_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func TestRouterLatencySkipsFailingBackend(t *testing.T) {
+	failing, healthy := gpttest.New(t), gpttest.New(t)
+	failing.Handle(gpttest.EndpointChatCompletions, func(gpttest.Request) gpttest.Response {
+		return gpttest.ErrorResponse(http.StatusInternalServerError, "server_error", "down")
+	})
+	var records []gpt.RouteRecord
+	router := gpt.NewRouter(gpt.RouteLatency, []gpt.RouteBackend{
+		{Name: "failing", Client: failing.Client()},
+		{Name: "healthy", Client: healthy.Client()},
+	}, gpt.WithRouteRecorder(func(r gpt.RouteRecord) { records = append(records, r) }))
+
+	request := &gpt.ChatCompletionRequest{
+		Model:    gpt.GPT4oMini,
+		Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := router.ChatCompletion(context.Background(), request); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	for i, want := range []int{2, 1, 1} {
+		if records[i].Backend != "healthy" || records[i].Attempts != want {
+			t.Errorf("call %d: served by %s after %d attempts, want healthy after %d",
+				i, records[i].Backend, records[i].Attempts, want)
+		}
+	}
+	failing.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+}
+
+func TestRouterCanaryPicksWeightedBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		percents []float64
+		want     string
+	}{
+		{"first", []float64{100, 0}, "a"},
+		{"last", []float64{0, 100}, "b"},
+		{"zero share at the end", []float64{0, 100, 0}, "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			var backends []gpt.RouteBackend
+			for i, percent := range tt.percents {
+				backends = append(backends, gpt.RouteBackend{
+					Name:    string(rune('a' + i)),
+					Client:  server.Client(),
+					Percent: percent,
+				})
+			}
+			var got string
+			router := gpt.NewRouter(gpt.RouteCanary, backends,
+				gpt.WithRouteRecorder(func(r gpt.RouteRecord) { got = r.Backend }))
+			for i := 0; i < 20; i++ {
+				if _, err := router.Engines(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Fatalf("served by %s, want %s", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// searchModel returns the embedding model used by SearchWithEngine. Engines that are embedding models
+// are used as is; the retired search engines fall back to the client's search model.
+func (c *client) searchModel(engine string) string {
+	if strings.HasPrefix(engine, "text-embedding-") {
+		return engine
+	}
+	if c.searchEmbeddingModel != "" {
+		return c.searchEmbeddingModel
+	}
+	return TextEmbeddingAda002
+}
+
+// Search creates a search with the default engine.
+func (c *client) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
+	return c.SearchWithEngine(ctx, c.defaultEngine, request)
+}
+
+// SearchWithEngine performs a semantic search over a list of documents. The search endpoint has been
+// retired, so the query and the documents are embedded with the Embeddings API and every document is
+// scored by the cosine similarity of its embedding to the query's, between -1 and 1. If engine is an
+// embedding model it is used for the embeddings, otherwise the model set with WithSearchEmbeddingModel.
+// The results are in the order of the documents.
+func (c *client) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
+	model := c.searchModel(engine)
+	texts := append([]string{request.Query}, request.Documents...)
+	vectors, usage, err := c.searchEmbeddings(ctx, model, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+	query := normalize(vectors[0])
+	output := &SearchResponse{Object: "list", Data: make([]SearchData, len(request.Documents)), Model: model, Usage: usage}
+	for i := range request.Documents {
+		output.Data[i] = SearchData{
+			Document: i,
+			Object:   "search_result",
+			Score:    dot(query, normalize(vectors[i+1])),
+		}
+	}
+	return output, nil
+}
+
+// searchEmbeddings returns the embeddings of texts and the usage of embedding them, taking the ones in the
+// search cache from there and adding the others to it.
+func (c *client) searchEmbeddings(ctx context.Context, model string, texts []string) ([][]float64, EmbeddingsUsage, error) {
+	vectors := make([][]float64, len(texts))
+	keys := make([]string, len(texts))
+	var missing []int
+	for i, text := range texts {
+		if c.searchCache != nil {
+			keys[i], _ = cacheKey("SearchEmbedding", &EmbeddingsRequest{Input: []string{text}, Model: model})
+			if data, ok, err := c.searchCache.Get(ctx, keys[i]); err == nil && ok {
+				if v, err := DecodeEmbeddingBase64(string(data)); err == nil {
+					vectors[i] = EmbeddingsResult{embedding32: v}.Float64()
+					continue
+				}
+			}
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return vectors, EmbeddingsUsage{}, nil
+	}
+
+	inputs := make([]string, len(missing))
+	for j, i := range missing {
+		inputs[j] = texts[i]
+	}
+	rsp, err := EmbedAll(ctx, c, inputs, EmbedOptions{Model: model})
+	if err != nil {
+		return nil, EmbeddingsUsage{}, err
+	}
+	for j, i := range missing {
+		vectors[i] = rsp.Data[j].Float64()
+		if c.searchCache != nil {
+			encoded := EncodeEmbeddingBase64(rsp.Data[j].Float32())
+			_ = c.searchCache.Set(ctx, keys[i], []byte(encoded), 0)
+		}
+	}
+	return vectors, rsp.Usage, nil
+}
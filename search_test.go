@@ -0,0 +1,140 @@
+package gpt_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func cosine(a, b []float64) float64 {
+	var ab, aa, bb float64
+	for i := range a {
+		ab += a[i] * b[i]
+		aa += a[i] * a[i]
+		bb += b[i] * b[i]
+	}
+	return ab / math.Sqrt(aa*bb)
+}
+
+func TestSearchRanksDocuments(t *testing.T) {
+	server := gpttest.New(t)
+	client := server.Client()
+	request := &gpt.SearchRequest{
+		Query:     "orange cat",
+		Documents: []string{"a red car", "orange cat", "the cat sleeps", "orange juice"},
+	}
+	rsp, err := client.Search(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Data) != len(request.Documents) || rsp.Object != "list" || rsp.Model != gpt.TextEmbeddingAda002 {
+		t.Fatalf("response %+v, want a result per document scored with the default model", rsp)
+	}
+	best := 0
+	for i, result := range rsp.Data {
+		want := cosine(gpttest.Embedding(request.Query), gpttest.Embedding(request.Documents[i]))
+		if result.Document != i || result.Object != "search_result" || math.Abs(result.Score-want) > 1e-6 {
+			t.Errorf("result %d = %+v, want document %d with score %v", i, result, i, want)
+		}
+		if result.Score > rsp.Data[best].Score {
+			best = i
+		}
+	}
+	if best != 1 || math.Abs(rsp.Data[1].Score-1) > 1e-6 {
+		t.Errorf("best document %d with score %v, want the query itself with score 1", best, rsp.Data[best].Score)
+	}
+	if rsp.Usage.PromptTokens != 12 || rsp.Usage.TotalTokens != 12 {
+		t.Errorf("usage %+v, want the tokens of the query and the documents", rsp.Usage)
+	}
+	server.AssertCalled(t, gpttest.EndpointEmbeddings, 1)
+}
+
+func TestSearchModel(t *testing.T) {
+	tests := []struct {
+		name, engine string
+		options      []gpt.ClientOption
+		want         string
+	}{
+		{"retired engine", "davinci", nil, gpt.TextEmbeddingAda002},
+		{"embedding model as the engine", gpt.TextEmbedding3Small, nil, gpt.TextEmbedding3Small},
+		{"search embedding model", "davinci", []gpt.ClientOption{gpt.WithSearchEmbeddingModel(gpt.TextEmbedding3Large)}, gpt.TextEmbedding3Large},
+		{"embedding model as the engine over the search model", gpt.TextEmbedding3Small,
+			[]gpt.ClientOption{gpt.WithSearchEmbeddingModel(gpt.TextEmbedding3Large)}, gpt.TextEmbedding3Small},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			request := &gpt.SearchRequest{Query: "q", Documents: []string{"d"}}
+			rsp, err := server.Client(tt.options...).SearchWithEngine(context.Background(), tt.engine, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sent gpt.EmbeddingsRequest
+			if req, _ := server.LastRequest(gpttest.EndpointEmbeddings); req.Decode(&sent) != nil || sent.Model != tt.want {
+				t.Errorf("embedded with %q, want %q", sent.Model, tt.want)
+			}
+			if rsp.Model != tt.want {
+				t.Errorf("response model %q, want %q", rsp.Model, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	server := gpttest.New(t)
+	cache := gpt.NewLRUCache(16)
+	client := server.Client(gpt.WithSearchCache(cache))
+	searches := []struct {
+		request  *gpt.SearchRequest
+		embedded []string // the texts sent to the embeddings endpoint, nil if none
+		entries  int
+	}{
+		{&gpt.SearchRequest{Query: "cat", Documents: []string{"dog", "kitten"}}, []string{"cat", "dog", "kitten"}, 3},
+		{&gpt.SearchRequest{Query: "cat", Documents: []string{"kitten", "lion"}}, []string{"lion"}, 4},
+		{&gpt.SearchRequest{Query: "dog", Documents: []string{"cat", "lion"}}, nil, 4},
+	}
+	for i, search := range searches {
+		before := len(server.Requests(gpttest.EndpointEmbeddings))
+		rsp, err := client.Search(context.Background(), search.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests := server.Requests(gpttest.EndpointEmbeddings)[before:]
+		var embedded []string
+		for _, req := range requests {
+			var sent gpt.EmbeddingsRequest
+			if err := req.Decode(&sent); err != nil {
+				t.Fatal(err)
+			}
+			embedded = append(embedded, sent.Input...)
+		}
+		if strings.Join(embedded, "|") != strings.Join(search.embedded, "|") {
+			t.Errorf("search %d embedded %q, want %q", i, embedded, search.embedded)
+		}
+		if rsp.Usage.PromptTokens != len(search.embedded) {
+			t.Errorf("search %d usage %+v, want the tokens of the embedded texts only", i, rsp.Usage)
+		}
+		if cache.Len() != search.entries {
+			t.Errorf("search %d left %d cache entries, want %d", i, cache.Len(), search.entries)
+		}
+		for j, result := range rsp.Data {
+			want := cosine(gpttest.Embedding(search.request.Query), gpttest.Embedding(search.request.Documents[j]))
+			// cached embeddings are kept as float32
+			if math.Abs(result.Score-want) > 1e-6 {
+				t.Errorf("search %d: document %d scored %v, want %v", i, j, result.Score, want)
+			}
+		}
+	}
+
+	// the same text embedded with another model is another entry
+	if _, err := client.SearchWithEngine(context.Background(), gpt.TextEmbedding3Small, searches[0].request); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 7 {
+		t.Errorf("%d cache entries, want the texts of both models", cache.Len())
+	}
+}
@@ -0,0 +1,308 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+)
+
+// DefaultSimilarityThreshold is the cosine similarity above which a SemanticCache treats two prompts as
+// the same question.
+const DefaultSimilarityThreshold = 0.95
+
+// SemanticOption are options that can be passed when creating a new semantic cache
+type SemanticOption func(*SemanticCache) *SemanticCache
+
+// WithSimilarityThreshold is a semantic cache option that overrides DefaultSimilarityThreshold
+func WithSimilarityThreshold(threshold float64) SemanticOption {
+	return func(c *SemanticCache) *SemanticCache {
+		c.threshold = threshold
+		return c
+	}
+}
+
+// WithSemanticEmbeddingModel is a semantic cache option that overrides the model used to embed prompts,
+// text-embedding-ada-002 by default
+func WithSemanticEmbeddingModel(model string) SemanticOption {
+	return func(c *SemanticCache) *SemanticCache {
+		c.model = model
+		return c
+	}
+}
+
+// WithSemanticCapacity is a semantic cache option that limits the number of cached responses. The
+// oldest response is evicted first. The default is no limit.
+func WithSemanticCapacity(capacity int) SemanticOption {
+	return func(c *SemanticCache) *SemanticCache {
+		c.capacity = capacity
+		return c
+	}
+}
+
+// SemanticStats counts the lookups of a SemanticCache.
+type SemanticStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// SemanticCache is a Client that wraps another Client and answers a chat completion with a stored
+// response when its last user message is similar enough to a previous one. Prompts are embedded with
+// the wrapped client's Embeddings and compared by cosine similarity against the previous prompts of
+// the same namespace: the model, the sampling parameters and the system messages and earlier turns, so
+// answers never leak across contexts or settings. Requests whose last message is not from the user are not cached, and calls
+// with a context from WithCacheBypass skip the lookup. Other methods are passed through.
+type SemanticCache struct {
+	client    Client
+	model     string
+	threshold float64
+	capacity  int
+
+	mu         sync.Mutex
+	namespaces map[string][]*semanticEntry
+	order      *list.List
+	stats      SemanticStats
+}
+
+type semanticEntry struct {
+	namespace string
+	vector    []float64
+	response  ChatCompletionResponse
+	element   *list.Element
+}
+
+var _ Client = (*SemanticCache)(nil)
+
+// NewSemanticCache returns a SemanticCache around client.
+func NewSemanticCache(client Client, options ...SemanticOption) *SemanticCache {
+	c := &SemanticCache{
+		client:     client,
+		model:      TextEmbeddingAda002,
+		threshold:  DefaultSimilarityThreshold,
+		namespaces: make(map[string][]*semanticEntry),
+		order:      list.New(),
+	}
+	for _, opt := range options {
+		c = opt(c)
+	}
+	return c
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *SemanticCache) Stats() SemanticStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len returns the number of cached responses.
+func (c *SemanticCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// semanticNamespace returns the namespace and the prompt of a chat request, or false if the request
+// does not end with a user message. The namespace covers the whole request except the prompt, so
+// requests that differ in their sampling parameters, such as N, MaxTokens, Temperature or Stop, never
+// share responses.
+func semanticNamespace(request *ChatCompletionRequest) (string, string, bool) {
+	n := len(request.Messages)
+	if n == 0 || request.Messages[n-1].Role != "user" {
+		return "", "", false
+	}
+	req := *request
+	req.Model, req.Messages, req.Stream, req.StreamOptions, req.User = chatModel(request), request.Messages[:n-1], false, nil, ""
+	namespace, err := cacheKey("ChatCompletion", &req)
+	if err != nil {
+		return "", "", false
+	}
+	return namespace, request.Messages[n-1].Content, true
+}
+
+// lookup embeds the prompt of request and returns the closest cached response. The vector is returned
+// for storing the response on a miss; it is nil if the request can't be cached.
+func (c *SemanticCache) lookup(ctx context.Context, request *ChatCompletionRequest) (string, []float64, *ChatCompletionResponse) {
+	namespace, prompt, ok := semanticNamespace(request)
+	if !ok {
+		return "", nil, nil
+	}
+	rsp, err := c.client.Embeddings(ctx, &EmbeddingsRequest{Input: []string{prompt}, Model: c.model, User: request.User})
+	if err != nil || len(rsp.Data) == 0 {
+		return "", nil, nil
+	}
+	vector := normalize(rsp.Data[0].Float64())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cacheBypassed(ctx) {
+		return namespace, vector, nil
+	}
+	var best *semanticEntry
+	bestScore := c.threshold
+	for _, e := range c.namespaces[namespace] {
+		if score := dot(vector, e.vector); score >= bestScore {
+			best, bestScore = e, score
+		}
+	}
+	if best == nil {
+		c.stats.Misses++
+		return namespace, vector, nil
+	}
+	c.stats.Hits++
+	output := best.response
+	output.Choices = append([]ChatCompletionResponseChoice(nil), best.response.Choices...)
+	return namespace, vector, &output
+}
+
+// store adds a response to the namespace, evicting the oldest responses over capacity.
+func (c *SemanticCache) store(namespace string, vector []float64, rsp *ChatCompletionResponse) {
+	if vector == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &semanticEntry{namespace: namespace, vector: vector, response: *rsp}
+	e.element = c.order.PushBack(e)
+	c.namespaces[namespace] = append(c.namespaces[namespace], e)
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Remove(c.order.Front()).(*semanticEntry)
+		entries := c.namespaces[oldest.namespace]
+		for i := range entries {
+			if entries[i] == oldest {
+				entries = append(entries[:i], entries[i+1:]...)
+				break
+			}
+		}
+		if len(entries) == 0 {
+			delete(c.namespaces, oldest.namespace)
+		} else {
+			c.namespaces[oldest.namespace] = entries
+		}
+	}
+}
+
+// normalize returns v scaled to unit length, so cosine similarity is a dot product.
+func normalize(v []float64) []float64 {
+	norm := math.Sqrt(dot(v, v))
+	out := make([]float64, len(v))
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func dot(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// Engines lists the engines.
+func (c *SemanticCache) Engines(ctx context.Context) (*EnginesResponse, error) {
+	return c.client.Engines(ctx)
+}
+
+// Engine retrieves an engine.
+func (c *SemanticCache) Engine(ctx context.Context, engine string) (*EngineObject, error) {
+	return c.client.Engine(ctx, engine)
+}
+
+// ChatCompletion returns the cached response to a similar prompt, or creates a chat completion and
+// caches it.
+func (c *SemanticCache) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	namespace, vector, cached := c.lookup(ctx, request)
+	if cached != nil {
+		return cached, nil
+	}
+	rsp, err := c.client.ChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	c.store(namespace, vector, rsp)
+	return rsp, nil
+}
+
+// ChatCompletionStream replays the cached response to a similar prompt as synthesized chunks, or streams
+// a chat completion and caches it once the stream ends without error.
+func (c *SemanticCache) ChatCompletionStream(ctx context.Context, request *ChatCompletionRequest, onData func(*ChatCompletionStreamResponse)) error {
+	namespace, vector, cached := c.lookup(ctx, request)
+	if cached != nil {
+		replayChatCompletion(cached, onData)
+		return nil
+	}
+	acc := &ChatCompletionResponse{Object: "chat.completion"}
+	err := c.client.ChatCompletionStream(ctx, request, func(rsp *ChatCompletionStreamResponse) {
+		accumulateChatCompletion(acc, rsp)
+		onData(rsp)
+	})
+	if err != nil {
+		return err
+	}
+	c.store(namespace, vector, acc)
+	return nil
+}
+
+// Completion creates a completion.
+func (c *SemanticCache) Completion(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return c.client.Completion(ctx, request)
+}
+
+// CompletionStream streams a completion.
+func (c *SemanticCache) CompletionStream(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return c.client.CompletionStream(ctx, request, onData)
+}
+
+// CompletionWithEngine creates a completion with the default engine.
+func (c *SemanticCache) CompletionWithEngine(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return c.client.CompletionWithEngine(ctx, request)
+}
+
+// CompletionStreamWithEngine streams a completion with the default engine.
+func (c *SemanticCache) CompletionStreamWithEngine(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return c.client.CompletionStreamWithEngine(ctx, request, onData)
+}
+
+// Edits creates an edit.
+func (c *SemanticCache) Edits(ctx context.Context, request *EditsRequest) (*EditsResponse, error) {
+	return c.client.Edits(ctx, request)
+}
+
+// Search performs a search with the default engine.
+func (c *SemanticCache) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
+	return c.client.Search(ctx, request)
+}
+
+// SearchWithEngine performs a search with the specified engine.
+func (c *SemanticCache) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
+	return c.client.SearchWithEngine(ctx, engine, request)
+}
+
+// Embeddings creates embeddings.
+func (c *SemanticCache) Embeddings(ctx context.Context, request *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	return c.client.Embeddings(ctx, request)
+}
+
+// Image creates images.
+func (c *SemanticCache) Image(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	return c.client.Image(ctx, request)
+}
+
+// Moderation classifies texts.
+func (c *SemanticCache) Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error) {
+	return c.client.Moderation(ctx, request)
+}
+
+// Transcription transcribes audio.
+func (c *SemanticCache) Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error) {
+	return c.client.Transcription(ctx, request)
+}
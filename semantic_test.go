@@ -0,0 +1,129 @@
+package gpt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func semanticRequest(prompt string, change func(*gpt.ChatCompletionRequest)) *gpt.ChatCompletionRequest {
+	request := &gpt.ChatCompletionRequest{
+		Model: gpt.GPT4oMini,
+		Messages: []gpt.ChatCompletionRequestMessage{
+			{Role: "system", Content: "You are a geography teacher."},
+			{Role: "user", Content: prompt},
+		},
+	}
+	if change != nil {
+		change(request)
+	}
+	return request
+}
+
+func TestSemanticCacheNamespaces(t *testing.T) {
+	const prompt = "What is the capital of France?"
+	tests := []struct {
+		name   string
+		prompt string
+		change func(*gpt.ChatCompletionRequest)
+		hit    bool
+	}{
+		{"same request", prompt, nil, true},
+		{"similar prompt", "what is the capital of france?", nil, true},
+		{"other user", prompt, func(r *gpt.ChatCompletionRequest) { r.User = "other" }, true},
+		{"other prompt", "How do I bake sourdough bread at home?", nil, false},
+		{"other model", prompt, func(r *gpt.ChatCompletionRequest) { r.Model = gpt.GPT4o }, false},
+		{"other system message", prompt, func(r *gpt.ChatCompletionRequest) { r.Messages[0].Content = "Answer in French." }, false},
+		{"earlier turn", prompt, func(r *gpt.ChatCompletionRequest) {
+			r.Messages = append([]gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}, r.Messages...)
+		}, false},
+		{"n", prompt, func(r *gpt.ChatCompletionRequest) { r.N = 3 }, false},
+		{"max tokens", prompt, func(r *gpt.ChatCompletionRequest) { r.MaxTokens = 5 }, false},
+		{"temperature", prompt, func(r *gpt.ChatCompletionRequest) { r.Temperature = 1.5 }, false},
+		{"top p", prompt, func(r *gpt.ChatCompletionRequest) { r.TopP = 0.1 }, false},
+		{"stop", prompt, func(r *gpt.ChatCompletionRequest) { r.Stop = []string{"."} }, false},
+		{"penalties", prompt, func(r *gpt.ChatCompletionRequest) { r.PresencePenalty = 1 }, false},
+		{"logit bias", prompt, func(r *gpt.ChatCompletionRequest) { r.LogitBias = map[string]float32{"42": -100} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			cache := gpt.NewSemanticCache(server.Client())
+			ctx := context.Background()
+			if _, err := cache.ChatCompletion(ctx, semanticRequest(prompt, nil)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cache.ChatCompletion(ctx, semanticRequest(tt.prompt, tt.change)); err != nil {
+				t.Fatal(err)
+			}
+			calls, want := 2, gpt.SemanticStats{Misses: 2}
+			if tt.hit {
+				calls, want = 1, gpt.SemanticStats{Hits: 1, Misses: 1}
+			}
+			server.AssertCalled(t, gpttest.EndpointChatCompletions, calls)
+			if stats := cache.Stats(); stats != want {
+				t.Errorf("stats %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
+
+func TestSemanticCacheStreams(t *testing.T) {
+	server := gpttest.New(t)
+	cache := gpt.NewSemanticCache(server.Client(), gpt.WithSemanticCapacity(1))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		var text string
+		err := cache.ChatCompletionStream(ctx, semanticRequest("Name a river.", nil), func(rsp *gpt.ChatCompletionStreamResponse) {
+			if len(rsp.Choices) > 0 {
+				text += rsp.Choices[0].Delta.Content
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != gpttest.DefaultReply {
+			t.Errorf("stream %d: %q, want the default reply", i, text)
+		}
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+
+	// the capacity of one evicts the river
+	if _, err := cache.ChatCompletion(ctx, semanticRequest("Name a mountain.", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.ChatCompletion(ctx, semanticRequest("Name a river.", nil)); err != nil {
+		t.Fatal(err)
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 3)
+	if cache.Len() != 1 {
+		t.Errorf("Len = %d, want the capacity", cache.Len())
+	}
+}
+
+func TestSemanticCacheSkips(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    func() context.Context
+		change func(*gpt.ChatCompletionRequest)
+	}{
+		{"bypassed", func() context.Context { return gpt.WithCacheBypass(context.Background()) }, nil},
+		{"last message not from the user", context.Background, func(r *gpt.ChatCompletionRequest) {
+			r.Messages = append(r.Messages, gpt.ChatCompletionRequestMessage{Role: "assistant", Content: "Paris"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			cache := gpt.NewSemanticCache(server.Client())
+			for i := 0; i < 2; i++ {
+				if _, err := cache.ChatCompletion(tt.ctx(), semanticRequest("What is the capital of France?", tt.change)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			server.AssertCalled(t, gpttest.EndpointChatCompletions, 2)
+		})
+	}
+}
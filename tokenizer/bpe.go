@@ -0,0 +1,54 @@
+package tokenizer
+
+import "math"
+
+// part is a boundary between tokens of a piece during byte pair merging, together with the rank of
+// merging it with the next two parts.
+type part struct {
+	start int
+	rank  int
+}
+
+// bytePairMerge splits piece into tokens by repeatedly merging the adjacent pair with the lowest rank,
+// following tiktoken's algorithm. It calls emit with the start and end offset of each resulting token
+// and returns the number of tokens. buf provides scratch space so short pieces don't allocate.
+func bytePairMerge(ranks map[string]int, piece string, buf []part, emit func(start, end int)) int {
+	parts := buf[:0]
+	for i := 0; i <= len(piece); i++ {
+		parts = append(parts, part{start: i, rank: math.MaxInt})
+	}
+	rankOf := func(i int) int {
+		if i+2 < len(parts) {
+			if rank, ok := ranks[piece[parts[i].start:parts[i+2].start]]; ok {
+				return rank
+			}
+		}
+		return math.MaxInt
+	}
+	for i := 0; i < len(parts)-2; i++ {
+		parts[i].rank = rankOf(i)
+	}
+	for len(parts) > 1 {
+		minRank, minIndex := math.MaxInt, -1
+		for i := 0; i < len(parts)-1; i++ {
+			if parts[i].rank < minRank {
+				minRank, minIndex = parts[i].rank, i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+		// merge parts[minIndex] with parts[minIndex+1] and update the ranks around it
+		parts = append(parts[:minIndex+1], parts[minIndex+2:]...)
+		parts[minIndex].rank = rankOf(minIndex)
+		if minIndex > 0 {
+			parts[minIndex-1].rank = rankOf(minIndex - 1)
+		}
+	}
+	if emit != nil {
+		for i := 0; i < len(parts)-1; i++ {
+			emit(parts[i].start, parts[i+1].start)
+		}
+	}
+	return len(parts) - 1
+}
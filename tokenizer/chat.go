@@ -0,0 +1,51 @@
+package tokenizer
+
+import (
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// replyPriming is the number of tokens the API adds to prime every reply with
+// <|start|>assistant<|message|>.
+const replyPriming = 3
+
+// chatOverhead returns the tokens the chat format adds around every message, and for a message with a
+// name. gpt-3.5-turbo-0301 wrapped messages as <|start|>{role/name}\n{content}<|end|>\n, so a name
+// replaces the role; later models add one token for the name instead.
+func chatOverhead(model string) (perMessage, perName int) {
+	if model == gpt.GPT3Dot5Turbo0301 {
+		return 4, -1
+	}
+	return 3, 1
+}
+
+// CountChatTokens returns the number of prompt tokens the API reports in
+// ChatCompletionsResponseUsage.PromptTokens for a chat completion request with the given messages.
+// An empty model is counted as gpt-3.5-turbo, the default of ChatCompletion.
+func CountChatTokens(model string, messages []gpt.ChatCompletionRequestMessage) (int, error) {
+	if model == "" {
+		model = gpt.GPT3Dot5Turbo
+	}
+	enc, err := ForModel(model)
+	if err != nil {
+		return 0, err
+	}
+	perMessage, perName := chatOverhead(model)
+	n := replyPriming
+	for _, msg := range messages {
+		n += perMessage + enc.Count(msg.Role) + enc.Count(msg.Content)
+		if msg.Name != "" {
+			n += perName + enc.Count(msg.Name)
+		}
+	}
+	return n, nil
+}
+
+// CountMessageTokens returns the tokens a single message adds to a chat prompt, excluding the reply
+// priming counted once per request by CountChatTokens.
+func CountMessageTokens(model string, msg gpt.ChatCompletionRequestMessage) (int, error) {
+	n, err := CountChatTokens(model, []gpt.ChatCompletionRequestMessage{msg})
+	if err != nil {
+		return 0, err
+	}
+	return n - replyPriming, nil
+}
@@ -0,0 +1,120 @@
+package tokenizer_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+// chatGolden is a file of testdata/chat: messages sent to the API with the prompt_tokens it reported
+// for each model.
+type chatGolden struct {
+	Source       string                             `json:"source"`
+	Messages     []gpt.ChatCompletionRequestMessage `json:"messages"`
+	PromptTokens map[string]int                     `json:"prompt_tokens"`
+}
+
+func TestCountChatTokensGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "chat", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden files in testdata/chat")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var golden chatGolden
+		if err := json.Unmarshal(data, &golden); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		models := make([]string, 0, len(golden.PromptTokens))
+		for model := range golden.PromptTokens {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		for _, model := range models {
+			t.Run(filepath.Base(file)+"/"+model, func(t *testing.T) {
+				got, err := tokenizer.CountChatTokens(model, golden.Messages)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := golden.PromptTokens[model]; got != want {
+					t.Errorf("CountChatTokens = %d, want %d recorded prompt_tokens", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCountMessageTokens(t *testing.T) {
+	msg := gpt.ChatCompletionRequestMessage{Role: "user", Content: "hello world"}
+	named := msg
+	named.Name = "example_user"
+	tests := []struct {
+		model string
+		msg   gpt.ChatCompletionRequestMessage
+		want  int
+	}{
+		// 3 tokens of overhead, the role and the content
+		{"gpt-4", msg, 3 + 1 + 2},
+		// plus a token for the name and the name itself
+		{"gpt-4", named, 3 + 1 + 2 + 1 + 2},
+		// 4 tokens of overhead, and the name replaces the role
+		{gpt.GPT3Dot5Turbo0301, msg, 4 + 1 + 2},
+		{gpt.GPT3Dot5Turbo0301, named, 4 + 1 + 2 - 1 + 2},
+	}
+	for _, tt := range tests {
+		got, err := tokenizer.CountMessageTokens(tt.model, tt.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CountMessageTokens(%s, name %q) = %d, want %d", tt.model, tt.msg.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCountChatTokensMultiTurn(t *testing.T) {
+	conversation := []gpt.ChatCompletionRequestMessage{
+		{Role: "system", Content: "You answer questions about the weather."},
+		{Role: "user", Name: "alice", Content: "Will it rain in Paris tomorrow?"},
+		{Role: "assistant", Content: "Light rain is expected in the afternoon."},
+		{Role: "user", Name: "alice", Content: "And on Sunday?"},
+	}
+	for _, model := range []string{gpt.GPT3Dot5Turbo0301, gpt.GPT3Dot5Turbo, gpt.GPT4, gpt.GPT4o, gpt.GPT4oMini} {
+		t.Run(model, func(t *testing.T) {
+			got, err := tokenizer.CountChatTokens(model, conversation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// every turn adds its own tokens, and the reply priming is counted once
+			want := 3
+			for _, msg := range conversation {
+				n, err := tokenizer.CountMessageTokens(model, msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want += n
+			}
+			if got != want {
+				t.Errorf("CountChatTokens = %d, want %d, the sum of the turns and the reply priming", got, want)
+			}
+			shorter, err := tokenizer.CountChatTokens(model, conversation[:2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shorter >= got {
+				t.Errorf("two turns count %d tokens, four %d", shorter, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// modelEncodings maps the model constants of package gpt to their encoding.
+var modelEncodings = map[string]string{
+	gpt.GPT4o:               O200kBase,
+	gpt.GPT4oMini:           O200kBase,
+	gpt.GPT4Turbo:           Cl100kBase,
+	gpt.GPT4:                Cl100kBase,
+	gpt.GPT3Dot5Turbo:       Cl100kBase,
+	gpt.GPT3Dot5Turbo0301:   Cl100kBase,
+	gpt.TextEmbeddingAda002: Cl100kBase,
+}
+
+// modelPrefixEncodings maps families of dated or fine-tuned model names to their encoding. Longer
+// prefixes are listed first.
+var modelPrefixEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{"ft:gpt-4o", O200kBase},
+	{"ft:gpt-4", Cl100kBase},
+	{"ft:gpt-3.5-turbo", Cl100kBase},
+	{"gpt-4o-", O200kBase},
+	{"gpt-4.1", O200kBase},
+	{"gpt-4.5", O200kBase},
+	{"gpt-4-", Cl100kBase},
+	{"gpt-3.5-turbo-", Cl100kBase},
+	{"gpt-35-turbo", Cl100kBase},
+	{"o1", O200kBase},
+	{"o3", O200kBase},
+	{"o4", O200kBase},
+	{"text-embedding-3-", Cl100kBase},
+}
+
+// contextWindows holds the context length of the model constants of package gpt, in tokens.
+var contextWindows = map[string]int{
+	gpt.GPT4o:             128000,
+	gpt.GPT4oMini:         128000,
+	gpt.GPT4Turbo:         128000,
+	gpt.GPT4:              8192,
+	gpt.GPT3Dot5Turbo:     16385,
+	gpt.GPT3Dot5Turbo0301: 4096,
+}
+
+// contextWindowPrefixes holds the context length of model families. Longer prefixes are listed first.
+var contextWindowPrefixes = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4.1", 1047576},
+	{"gpt-4-32k", 32768},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-1106", 128000},
+	{"gpt-4-0125", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-16k", 16385},
+	{"gpt-3.5-turbo-0613", 4096},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+}
+
+// ContextWindow returns the maximum number of tokens, prompt and completion together, a model accepts.
+func ContextWindow(model string) (int, error) {
+	if tokens, ok := contextWindows[model]; ok {
+		return tokens, nil
+	}
+	for _, p := range contextWindowPrefixes {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.tokens, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown context window for model %q", model)
+}
+
+// EncodingNameForModel returns the name of the encoding used by a model.
+func EncodingNameForModel(model string) (string, error) {
+	if name, ok := modelEncodings[model]; ok {
+		return name, nil
+	}
+	for _, p := range modelPrefixEncodings {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.encoding, nil
+		}
+	}
+	return "", fmt.Errorf("no known encoding for model %q", model)
+}
+
+// ForModel returns the encoding used by a model.
+func ForModel(model string) (*Encoding, error) {
+	name, err := EncodingNameForModel(model)
+	if err != nil {
+		return nil, err
+	}
+	return Get(name)
+}
+
+// Count returns the number of tokens text takes for a model.
+func Count(model, text string) (int, error) {
+	enc, err := ForModel(model)
+	if err != nil {
+		return 0, err
+	}
+	return enc.Count(text), nil
+}
@@ -0,0 +1,280 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// The pre-tokenization patterns used by tiktoken rely on a negative lookahead (\s+(?!\S)) which Go's
+// regexp package doesn't support, so they are implemented by hand below. Each splitter follows the
+// leftmost-first alternation and backtracking semantics of the original pattern exactly.
+
+// splitFunc calls yield with each pre-token of text in order.
+type splitFunc func(text string, yield func(piece string))
+
+// splitCl100k implements the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitCl100k(text string, yield func(piece string)) {
+	for i := 0; i < len(text); {
+		end := contraction(text, i)
+		if end < 0 {
+			end = cl100kLetters(text, i)
+		}
+		if end < 0 {
+			end = numbers(text, i)
+		}
+		if end < 0 {
+			end = punctuation(text, i, false)
+		}
+		if end < 0 {
+			end = whitespace(text, i)
+		}
+		yield(text[i:end])
+		i = end
+	}
+}
+
+// splitO200k implements the o200k_base pattern:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitO200k(text string, yield func(piece string)) {
+	for i := 0; i < len(text); {
+		end := withPrefix(text, i, o200kLowerWord)
+		if end < 0 {
+			end = withPrefix(text, i, o200kUpperWord)
+		}
+		if end < 0 {
+			end = numbers(text, i)
+		}
+		if end < 0 {
+			end = punctuation(text, i, true)
+		}
+		if end < 0 {
+			end = whitespace(text, i)
+		}
+		yield(text[i:end])
+		i = end
+	}
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r)
+}
+
+func isNumber(r rune) bool {
+	return unicode.IsNumber(r)
+}
+
+func isSpace(r rune) bool {
+	return unicode.Is(unicode.White_Space, r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// isPrefix matches [^\r\n\p{L}\p{N}].
+func isPrefix(r rune) bool {
+	return !isNewline(r) && !isLetter(r) && !isNumber(r)
+}
+
+// isPunct matches [^\s\p{L}\p{N}].
+func isPunct(r rune) bool {
+	return !isSpace(r) && !isLetter(r) && !isNumber(r)
+}
+
+// isUpper matches [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}].
+func isUpper(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLower matches [\p{Ll}\p{Lm}\p{Lo}\p{M}].
+func isLower(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// runeAt decodes the rune at i, returning utf8.RuneError with width 1 for invalid bytes and 0 at the end.
+func runeAt(text string, i int) (rune, int) {
+	if i >= len(text) {
+		return 0, 0
+	}
+	if c := text[i]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(text[i:])
+}
+
+// span returns the end of the run of runes matching class starting at i.
+func span(text string, i int, class func(rune) bool) int {
+	for i < len(text) {
+		r, w := runeAt(text, i)
+		if !class(r) {
+			break
+		}
+		i += w
+	}
+	return i
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d) at i and returns its end, or -1.
+func contraction(text string, i int) int {
+	if i >= len(text) || text[i] != '\'' {
+		return -1
+	}
+	r1, w1 := runeAt(text, i+1)
+	switch {
+	case foldEqual(r1, 's'), foldEqual(r1, 't'), foldEqual(r1, 'm'), foldEqual(r1, 'd'):
+		return i + 1 + w1
+	case foldEqual(r1, 'r'), foldEqual(r1, 'v'):
+		if r2, w2 := runeAt(text, i+1+w1); foldEqual(r2, 'e') {
+			return i + 1 + w1 + w2
+		}
+	case foldEqual(r1, 'l'):
+		if r2, w2 := runeAt(text, i+1+w1); foldEqual(r2, 'l') {
+			return i + 1 + w1 + w2
+		}
+	}
+	return -1
+}
+
+// foldEqual reports whether r equals the ASCII letter c under simple case folding, like (?i).
+func foldEqual(r rune, c rune) bool {
+	if r == c {
+		return true
+	}
+	for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+		if r == f {
+			return true
+		}
+	}
+	return false
+}
+
+// cl100kLetters matches [^\r\n\p{L}\p{N}]?\p{L}+ at i.
+func cl100kLetters(text string, i int) int {
+	r, w := runeAt(text, i)
+	if isPrefix(r) {
+		if next, _ := runeAt(text, i+w); isLetter(next) {
+			return span(text, i+w, isLetter)
+		}
+		return -1
+	}
+	if isLetter(r) {
+		return span(text, i, isLetter)
+	}
+	return -1
+}
+
+// withPrefix matches [^\r\n\p{L}\p{N}]? followed by word at i, trying the prefix first.
+func withPrefix(text string, i int, word func(string, int) int) int {
+	if r, w := runeAt(text, i); isPrefix(r) {
+		if end := word(text, i+w); end >= 0 {
+			return end
+		}
+	}
+	return word(text, i)
+}
+
+// o200kLowerWord matches [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+ followed by an
+// optional contraction at i. The classes overlap, so the upper run backtracks until a lower rune follows.
+func o200kLowerWord(text string, i int) int {
+	var starts [32]int
+	positions := starts[:0]
+	j := i
+	for j < len(text) {
+		r, w := runeAt(text, j)
+		if !isUpper(r) {
+			break
+		}
+		positions = append(positions, j)
+		j += w
+	}
+	for k := len(positions); k >= 0; k-- {
+		at := j
+		if k < len(positions) {
+			at = positions[k]
+		}
+		if r, _ := runeAt(text, at); at < len(text) && isLower(r) {
+			end := span(text, at, isLower)
+			if c := contraction(text, end); c >= 0 {
+				return c
+			}
+			return end
+		}
+	}
+	return -1
+}
+
+// o200kUpperWord matches [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]* followed by an
+// optional contraction at i.
+func o200kUpperWord(text string, i int) int {
+	j := span(text, i, isUpper)
+	if j == i {
+		return -1
+	}
+	end := span(text, j, isLower)
+	if c := contraction(text, end); c >= 0 {
+		return c
+	}
+	return end
+}
+
+// numbers matches \p{N}{1,3} at i.
+func numbers(text string, i int) int {
+	j := i
+	for n := 0; n < 3; n++ {
+		r, w := runeAt(text, j)
+		if w == 0 || !isNumber(r) {
+			break
+		}
+		j += w
+	}
+	if j == i {
+		return -1
+	}
+	return j
+}
+
+// punctuation matches ` ?[^\s\p{L}\p{N}]+[\r\n]*` at i, also allowing '/' in the trailing run for o200k.
+func punctuation(text string, i int, slash bool) int {
+	j := i
+	if text[j] == ' ' {
+		if r, _ := runeAt(text, j+1); j+1 < len(text) && isPunct(r) {
+			j++
+		}
+	}
+	r, _ := runeAt(text, j)
+	if j >= len(text) || !isPunct(r) {
+		return -1
+	}
+	j = span(text, j, isPunct)
+	return span(text, j, func(r rune) bool { return isNewline(r) || (slash && r == '/') })
+}
+
+// whitespace matches \s*[\r\n]+|\s+(?!\S)|\s+ at i. Every other alternative has been tried, so the
+// rune at i is whitespace.
+func whitespace(text string, i int) int {
+	end := span(text, i, isSpace)
+	if end == i {
+		// unreachable for valid patterns, but never stall on unexpected input
+		_, w := runeAt(text, i)
+		return i + w
+	}
+	// \s*[\r\n]+ ends after the last newline of the run
+	for j := end - 1; j >= i; j-- {
+		if isNewline(rune(text[j])) {
+			return j + 1
+		}
+	}
+	// \s+(?!\S) leaves the last whitespace rune to prefix the following word
+	if end < len(text) {
+		_, w := utf8.DecodeLastRuneInString(text[i:end])
+		if end-w > i {
+			return end - w
+		}
+	}
+	return end
+}
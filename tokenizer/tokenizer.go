@@ -0,0 +1,230 @@
+// Package tokenizer implements tiktoken-compatible byte pair encoding for the cl100k_base and o200k_base
+// encodings, so prompts can be measured against MaxTokens and context limits before they are sent.
+// The rank files are embedded in the package and loaded the first time an encoding is used.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Define encoding names
+const (
+	Cl100kBase = "cl100k_base" // Cl100kBase is used by GPT-4, GPT-3.5 Turbo and text-embedding-ada-002
+	O200kBase  = "o200k_base"  // O200kBase is used by GPT-4o
+)
+
+// Define special tokens
+const (
+	EndOfText   = "<|endoftext|>"   // EndOfText marks the end of a document
+	FimPrefix   = "<|fim_prefix|>"  // FimPrefix starts the prefix of a fill-in-the-middle prompt
+	FimMiddle   = "<|fim_middle|>"  // FimMiddle starts the middle of a fill-in-the-middle prompt
+	FimSuffix   = "<|fim_suffix|>"  // FimSuffix starts the suffix of a fill-in-the-middle prompt
+	EndOfPrompt = "<|endofprompt|>" // EndOfPrompt marks the end of a prompt
+)
+
+//go:embed assets/*.tiktoken.gz
+var assets embed.FS
+
+// Encoding is a byte pair encoding. It is safe for concurrent use.
+type Encoding struct {
+	name    string
+	split   splitFunc
+	special map[string]int
+
+	once    sync.Once
+	err     error
+	ranks   map[string]int
+	decoder []string
+}
+
+var encodings = map[string]*Encoding{
+	Cl100kBase: {
+		name:  Cl100kBase,
+		split: splitCl100k,
+		special: map[string]int{
+			EndOfText:   100257,
+			FimPrefix:   100258,
+			FimMiddle:   100259,
+			FimSuffix:   100260,
+			EndOfPrompt: 100276,
+		},
+	},
+	O200kBase: {
+		name:  O200kBase,
+		split: splitO200k,
+		special: map[string]int{
+			EndOfText:   199999,
+			EndOfPrompt: 200018,
+		},
+	},
+}
+
+// Get returns the encoding with the given name.
+func Get(name string) (*Encoding, error) {
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	if err := enc.load(); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// load reads the embedded rank file once.
+func (e *Encoding) load() error {
+	e.once.Do(func() {
+		e.ranks, e.decoder, e.err = loadRanks(e.name)
+		if e.err == nil {
+			for text, token := range e.special {
+				e.decoder = grow(e.decoder, token)
+				e.decoder[token] = text
+			}
+		}
+	})
+	return e.err
+}
+
+func loadRanks(name string) (map[string]int, []string, error) {
+	file, err := assets.Open("assets/" + name + ".tiktoken.gz")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s ranks: %w", name, err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress %s ranks: %w", name, err)
+	}
+	ranks := make(map[string]int, 200000)
+	var decoder []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		sep := bytes.IndexByte(line, ' ')
+		if sep < 0 {
+			continue
+		}
+		token := make([]byte, base64.StdEncoding.DecodedLen(sep))
+		n, err := base64.StdEncoding.Decode(token, line[:sep])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s rank %q: %w", name, line, err)
+		}
+		rank, err := strconv.Atoi(string(line[sep+1:]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s rank %q: %w", name, line, err)
+		}
+		text := string(token[:n])
+		ranks[text] = rank
+		decoder = grow(decoder, rank)
+		decoder[rank] = text
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s ranks: %w", name, err)
+	}
+	return ranks, decoder, nil
+}
+
+func grow(s []string, index int) []string {
+	for len(s) <= index {
+		s = append(s, "")
+	}
+	return s
+}
+
+// Encode returns the tokens of text. Special tokens in text are encoded as ordinary text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	e.encodeOrdinary(text, func(token int) { tokens = append(tokens, token) })
+	return tokens
+}
+
+// EncodeWithSpecial returns the tokens of text, encoding special tokens such as <|endoftext|> as their
+// reserved token instead of as ordinary text.
+func (e *Encoding) EncodeWithSpecial(text string) []int {
+	var tokens []int
+	for len(text) > 0 {
+		start, end, token := e.nextSpecial(text)
+		e.encodeOrdinary(text[:start], func(token int) { tokens = append(tokens, token) })
+		if end < 0 {
+			break
+		}
+		tokens = append(tokens, token)
+		text = text[end:]
+	}
+	return tokens
+}
+
+// Count returns the number of tokens Encode would return for text, without allocating them.
+func (e *Encoding) Count(text string) int {
+	var buf [64]part
+	n := 0
+	e.split(text, func(piece string) {
+		if _, ok := e.ranks[piece]; ok {
+			n++
+			return
+		}
+		n += bytePairMerge(e.ranks, piece, buf[:0], nil)
+	})
+	return n
+}
+
+// Decode returns the text of tokens. Tokens that don't end on a UTF-8 boundary produce invalid UTF-8,
+// like tiktoken's decode_bytes; unknown tokens are skipped.
+func (e *Encoding) Decode(tokens []int) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		if token >= 0 && token < len(e.decoder) {
+			sb.WriteString(e.decoder[token])
+		}
+	}
+	return sb.String()
+}
+
+// TokenBytes returns the bytes of a single token and whether the token exists.
+func (e *Encoding) TokenBytes(token int) ([]byte, bool) {
+	if token < 0 || token >= len(e.decoder) {
+		return nil, false
+	}
+	text := e.decoder[token]
+	if text == "" {
+		return nil, false
+	}
+	return []byte(text), true
+}
+
+func (e *Encoding) encodeOrdinary(text string, emit func(token int)) {
+	var buf [64]part
+	e.split(text, func(piece string) {
+		if token, ok := e.ranks[piece]; ok {
+			emit(token)
+			return
+		}
+		bytePairMerge(e.ranks, piece, buf[:0], func(start, end int) {
+			emit(e.ranks[piece[start:end]])
+		})
+	})
+}
+
+// nextSpecial finds the first special token in text, returning its offsets and token, or -1 offsets.
+func (e *Encoding) nextSpecial(text string) (int, int, int) {
+	start, end, token := len(text), -1, 0
+	for special, t := range e.special {
+		if i := strings.Index(text, special); i >= 0 && i < start {
+			start, end, token = i, i+len(special), t
+		}
+	}
+	return start, end, token
+}
@@ -0,0 +1,109 @@
+package tokenizer_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/tokenizer"
+)
+
+// The expected tokens are the examples of the OpenAI cookbook How to count tokens with tiktoken.
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{tokenizer.Cl100kBase, "hello world", []int{15339, 1917}},
+		{tokenizer.Cl100kBase, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{tokenizer.Cl100kBase, "antidisestablishmentarianism", []int{519, 85342, 34500, 479, 8997, 2191}},
+		{tokenizer.Cl100kBase, "2 + 2 = 4", []int{17, 489, 220, 17, 284, 220, 19}},
+		{tokenizer.Cl100kBase, "お誕生日おめでとう", []int{33334, 45918, 243, 21990, 9080, 33334, 62004, 16556, 78699}},
+		{tokenizer.O200kBase, "hello world", []int{24912, 2375}},
+		{tokenizer.O200kBase, "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+		{tokenizer.O200kBase, "antidisestablishmentarianism", []int{493, 129901, 376, 160388, 21203, 2367}},
+		{tokenizer.O200kBase, "2 + 2 = 4", []int{17, 659, 220, 17, 314, 220, 19}},
+		{tokenizer.O200kBase, "お誕生日おめでとう", []int{8930, 9697, 243, 128225, 8930, 17693, 4344, 48669}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+"/"+tt.text, func(t *testing.T) {
+			enc, err := tokenizer.Get(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := enc.Encode(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			if n := enc.Count(tt.text); n != len(tt.want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, n, len(tt.want))
+			}
+			if text := enc.Decode(got); text != tt.text {
+				t.Errorf("Decode(Encode(%q)) = %q", tt.text, text)
+			}
+		})
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"  indented\n\n\tcode {\n}\r\n",
+		"I'm HAPPY they've WON'T we'll",
+		"price: $1,234.56 (≈ €1.1k) 🚀🚀",
+		"mixed Ελληνικά, русский, 中文 and العربية",
+		"<|endoftext|> is not special in ordinary text",
+	}
+	for _, name := range []string{tokenizer.Cl100kBase, tokenizer.O200kBase} {
+		enc, err := tokenizer.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range texts {
+			if got := enc.Decode(enc.Encode(text)); got != text {
+				t.Errorf("%s: Decode(Encode(%q)) = %q", name, text, got)
+			}
+		}
+	}
+}
+
+func TestEncodeWithSpecial(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     []int
+	}{
+		{tokenizer.Cl100kBase, []int{15339, 100257, 1917}},
+		{tokenizer.O200kBase, []int{24912, 199999, 2375}},
+	}
+	for _, tt := range tests {
+		enc, err := tokenizer.Get(tt.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := enc.EncodeWithSpecial("hello" + tokenizer.EndOfText + " world"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: EncodeWithSpecial = %v, want %v", tt.encoding, got, tt.want)
+		}
+		if got := enc.Encode(tokenizer.EndOfText); len(got) == 1 {
+			t.Errorf("%s: Encode treats %s as a special token", tt.encoding, tokenizer.EndOfText)
+		}
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-3.5-turbo", tokenizer.Cl100kBase},
+		{"gpt-4-0613", tokenizer.Cl100kBase},
+		{"text-embedding-3-small", tokenizer.Cl100kBase},
+		{"gpt-4o", tokenizer.O200kBase},
+		{"gpt-4o-mini-2024-07-18", tokenizer.O200kBase},
+	}
+	for _, tt := range tests {
+		got, err := tokenizer.EncodingNameForModel(tt.model)
+		if err != nil || got != tt.want {
+			t.Errorf("EncodingNameForModel(%q) = %q, %v, want %q", tt.model, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+// Package gpt provides a client for the OpenAI GPT-3 API
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BudgetExceededError is returned by a UsageTracker instead of sending a call once the spend has
+// reached its budget.
+type BudgetExceededError struct {
+	// Budget is the configured limit in US dollars
+	Budget float64
+	// Spent is the cost of the calls tracked so far in US dollars
+	Spent float64
+}
+
+// Error returns a string representation of the error
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget of $%.4f exceeded: spent $%.4f", e.Budget, e.Spent)
+}
+
+// UsageTotals is the usage aggregated over a set of calls.
+type UsageTotals struct {
+	Calls            int64
+	PromptTokens     int64
+	CachedTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	Images           int64
+	// Cost is the price of the calls in US dollars according to the tracker's Pricing
+	Cost float64
+}
+
+func (t *UsageTotals) add(r UsageRecord) {
+	t.Calls++
+	t.PromptTokens += int64(r.PromptTokens)
+	t.CachedTokens += int64(r.CachedTokens)
+	t.CompletionTokens += int64(r.CompletionTokens)
+	t.TotalTokens += int64(r.PromptTokens + r.CompletionTokens)
+	t.Images += int64(r.Images)
+	t.Cost += r.Cost
+}
+
+// UsageRecord is the usage of a single call seen by a UsageTracker.
+type UsageRecord struct {
+	// Method is the name of the Client method that was called
+	Method string
+	// Model is the model the response reported, or the requested one
+	Model string
+	// User is the user tag of the call, see WithUsageUser
+	User string
+	// Labels are the labels of the call, see WithUsageLabels
+	Labels           map[string]string
+	PromptTokens     int
+	CachedTokens     int
+	CompletionTokens int
+	// Images is the number of images generated, ImageSize their size
+	Images    int
+	ImageSize string
+	// Cost is the price of the call in US dollars
+	Cost float64
+}
+
+// imageModel is the model the image API uses.
+const imageModel = "dall-e-2"
+
+type usageUserKey struct{}
+
+type usageLabelsKey struct{}
+
+// WithUsageUser returns a context that attributes the calls made with it to user. Without it, calls are
+// attributed to the User field of the request.
+func WithUsageUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, usageUserKey{}, user)
+}
+
+// WithUsageLabels returns a context that adds labels, such as the feature making the call, to the calls
+// made with it. Labels are merged with the labels already in ctx.
+func WithUsageLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range usageLabelsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, usageLabelsKey{}, merged)
+}
+
+func usageLabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(usageLabelsKey{}).(map[string]string)
+	return labels
+}
+
+// UsageTrackerOption are options that can be passed when creating a new usage tracker
+type UsageTrackerOption func(*UsageTracker) *UsageTracker
+
+// WithPricing is a usage tracker option that overrides the default pricing
+func WithPricing(pricing *Pricing) UsageTrackerOption {
+	return func(t *UsageTracker) *UsageTracker {
+		t.pricing = pricing
+		return t
+	}
+}
+
+// WithBudget is a usage tracker option that fails calls with a *BudgetExceededError once the tracked
+// cost reaches budget US dollars. The call that crosses the budget still completes.
+func WithBudget(budget float64) UsageTrackerOption {
+	return func(t *UsageTracker) *UsageTracker {
+		t.budget = budget
+		return t
+	}
+}
+
+// WithUsageRecorder is a usage tracker option that calls fn after every tracked call
+func WithUsageRecorder(fn func(UsageRecord)) UsageTrackerOption {
+	return func(t *UsageTracker) *UsageTracker {
+		t.recorder = fn
+		return t
+	}
+}
+
+// UsageTracker is a Client that wraps another Client and aggregates the usage and cost reported by its
+// responses by model, user and label. Streams are sent with StreamOptions.IncludeUsage so their usage
+// is reported in a last chunk, unless the server rejects the option; such streams are tracked without
+// tokens.
+type UsageTracker struct {
+	client   Client
+	pricing  *Pricing
+	budget   float64
+	recorder func(UsageRecord)
+
+	mu      sync.Mutex
+	total   UsageTotals
+	entries map[usageEntryKey]*usageEntry
+}
+
+type usageEntryKey struct {
+	model, user, labels string
+}
+
+type usageEntry struct {
+	model, user string
+	labels      map[string]string
+	totals      UsageTotals
+}
+
+var _ Client = (*UsageTracker)(nil)
+
+// NewUsageTracker returns a UsageTracker around client.
+func NewUsageTracker(client Client, options ...UsageTrackerOption) *UsageTracker {
+	t := &UsageTracker{
+		client:  client,
+		pricing: DefaultPricing(),
+	}
+	for _, opt := range options {
+		t = opt(t)
+	}
+	return t
+}
+
+// Total returns the usage of all tracked calls.
+func (t *UsageTracker) Total() UsageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// ByModel returns the usage of the tracked calls by model.
+func (t *UsageTracker) ByModel() map[string]UsageTotals {
+	return t.group(func(e *usageEntry) string { return e.model })
+}
+
+// ByUser returns the usage of the tracked calls by user. Calls without a user are under "".
+func (t *UsageTracker) ByUser() map[string]UsageTotals {
+	return t.group(func(e *usageEntry) string { return e.user })
+}
+
+// ByLabel returns the usage of the tracked calls by the value of a label. Calls without the label are
+// under "".
+func (t *UsageTracker) ByLabel(name string) map[string]UsageTotals {
+	return t.group(func(e *usageEntry) string { return e.labels[name] })
+}
+
+// Reset clears the tracked usage, which also lifts an exceeded budget.
+func (t *UsageTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total = UsageTotals{}
+	t.entries = nil
+}
+
+func (t *UsageTracker) group(key func(*usageEntry) string) map[string]UsageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	groups := make(map[string]UsageTotals)
+	for _, e := range t.entries {
+		g := groups[key(e)]
+		g.Calls += e.totals.Calls
+		g.PromptTokens += e.totals.PromptTokens
+		g.CachedTokens += e.totals.CachedTokens
+		g.CompletionTokens += e.totals.CompletionTokens
+		g.TotalTokens += e.totals.TotalTokens
+		g.Images += e.totals.Images
+		g.Cost += e.totals.Cost
+		groups[key(e)] = g
+	}
+	return groups
+}
+
+// check fails with a *BudgetExceededError when the budget is used up.
+func (t *UsageTracker) check() error {
+	if t.budget <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.total.Cost >= t.budget {
+		return &BudgetExceededError{Budget: t.budget, Spent: t.total.Cost}
+	}
+	return nil
+}
+
+// track prices a record and adds it to the totals.
+func (t *UsageTracker) track(ctx context.Context, r UsageRecord, requestUser string) {
+	r.User = requestUser
+	if user, ok := ctx.Value(usageUserKey{}).(string); ok {
+		r.User = user
+	}
+	r.Labels = usageLabelsFromContext(ctx)
+	if r.Images > 0 {
+		r.Cost = t.pricing.ImageCost(r.ImageSize, r.Images)
+	} else {
+		r.Cost = t.pricing.Cost(r.Model, r.PromptTokens, r.CachedTokens, r.CompletionTokens)
+	}
+
+	t.mu.Lock()
+	t.total.add(r)
+	key := usageEntryKey{model: r.Model, user: r.User, labels: labelsKey(r.Labels)}
+	e, ok := t.entries[key]
+	if !ok {
+		if t.entries == nil {
+			t.entries = make(map[usageEntryKey]*usageEntry)
+		}
+		e = &usageEntry{model: r.Model, user: r.User, labels: r.Labels}
+		t.entries[key] = e
+	}
+	e.totals.add(r)
+	t.mu.Unlock()
+
+	if t.recorder != nil {
+		t.recorder(r)
+	}
+}
+
+// labelsKey returns a canonical string for a set of labels.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%q=%q,", k, labels[k])
+	}
+	return sb.String()
+}
+
+func chatRecord(method, model string, usage ChatCompletionsResponseUsage) UsageRecord {
+	r := UsageRecord{Method: method, Model: model, PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens}
+	if usage.PromptTokensDetails != nil {
+		r.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	return r
+}
+
+// responseModel returns the model reported by a response, or the requested one.
+func responseModel(reported, requested string) string {
+	if reported != "" {
+		return reported
+	}
+	return requested
+}
+
+// Engines lists the engines. The call is not tracked.
+func (t *UsageTracker) Engines(ctx context.Context) (*EnginesResponse, error) {
+	return t.client.Engines(ctx)
+}
+
+// Engine retrieves an engine. The call is not tracked.
+func (t *UsageTracker) Engine(ctx context.Context, engine string) (*EngineObject, error) {
+	return t.client.Engine(ctx, engine)
+}
+
+// ChatCompletion creates a chat completion and tracks its usage.
+func (t *UsageTracker) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.ChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, chatRecord("ChatCompletion", responseModel(rsp.Model, chatModel(request)), rsp.Usage), request.User)
+	return rsp, nil
+}
+
+// ChatCompletionStream streams a chat completion and tracks its usage. The usage is requested with
+// StreamOptions.IncludeUsage; its chunk, which has no choices, is passed to onData only if the request
+// asked for it. A stream that fails before reporting its usage is not tracked.
+func (t *UsageTracker) ChatCompletionStream(ctx context.Context, request *ChatCompletionRequest, onData func(*ChatCompletionStreamResponse)) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	record := UsageRecord{Method: "ChatCompletionStream", Model: chatModel(request)}
+	reported := false
+	withUsage := *request
+	err := streamWithUsage(&withUsage.StreamOptions, func(asked bool) error {
+		return t.client.ChatCompletionStream(ctx, &withUsage, func(rsp *ChatCompletionStreamResponse) {
+			if rsp.Usage.TotalTokens > 0 {
+				record = chatRecord(record.Method, responseModel(rsp.Model, record.Model), rsp.Usage)
+				reported = true
+			}
+			if len(rsp.Choices) > 0 || asked {
+				onData(rsp)
+			}
+		})
+	})
+	if err == nil || reported {
+		t.track(ctx, record, request.User)
+	}
+	return err
+}
+
+// streamWithUsage sends a stream with StreamOptions.IncludeUsage and tells send whether the request had
+// asked for the usage already. If the server rejects stream_options, as some compatible APIs do, and
+// the request hadn't asked for them, the stream is sent once more without them.
+func streamWithUsage(options **StreamOptions, send func(asked bool) error) error {
+	original := *options
+	asked := original != nil && original.IncludeUsage
+	*options = &StreamOptions{IncludeUsage: true}
+	err := send(asked)
+	if err != nil && !asked && rejectsStreamOptions(err) {
+		*options = original
+		err = send(asked)
+	}
+	return err
+}
+
+// rejectsStreamOptions reports whether err is the API refusing the stream_options parameter.
+func rejectsStreamOptions(err error) bool {
+	var apiErr APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest &&
+		strings.Contains(apiErr.Message, "stream_options")
+}
+
+// Completion creates a completion and tracks its usage.
+func (t *UsageTracker) Completion(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return t.completion(ctx, "Completion", request, t.client.Completion)
+}
+
+// CompletionStream streams a completion and tracks its usage, requested like ChatCompletionStream does.
+func (t *UsageTracker) CompletionStream(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return t.completionStream(ctx, "CompletionStream", request, onData, t.client.CompletionStream)
+}
+
+// CompletionWithEngine creates a completion with the default engine and tracks its usage.
+func (t *UsageTracker) CompletionWithEngine(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	return t.completion(ctx, "CompletionWithEngine", request, t.client.CompletionWithEngine)
+}
+
+// CompletionStreamWithEngine streams a completion with the default engine and tracks its usage.
+func (t *UsageTracker) CompletionStreamWithEngine(ctx context.Context, request *CompletionRequest, onData func(*CompletionResponse)) error {
+	return t.completionStream(ctx, "CompletionStreamWithEngine", request, onData, t.client.CompletionStreamWithEngine)
+}
+
+func (t *UsageTracker) completion(ctx context.Context, method string, request *CompletionRequest,
+	fn func(context.Context, *CompletionRequest) (*CompletionResponse, error)) (*CompletionResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := fn(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{
+		Method:           method,
+		Model:            responseModel(rsp.Model, request.Model),
+		PromptTokens:     rsp.Usage.PromptTokens,
+		CompletionTokens: rsp.Usage.CompletionTokens,
+	}, request.User)
+	return rsp, nil
+}
+
+func (t *UsageTracker) completionStream(ctx context.Context, method string, request *CompletionRequest, onData func(*CompletionResponse),
+	fn func(context.Context, *CompletionRequest, func(*CompletionResponse)) error) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	record := UsageRecord{Method: method, Model: request.Model}
+	reported := false
+	withUsage := *request
+	err := streamWithUsage(&withUsage.StreamOptions, func(asked bool) error {
+		return fn(ctx, &withUsage, func(rsp *CompletionResponse) {
+			if rsp.Usage.TotalTokens > 0 {
+				record.Model = responseModel(rsp.Model, record.Model)
+				record.PromptTokens = rsp.Usage.PromptTokens
+				record.CompletionTokens = rsp.Usage.CompletionTokens
+				reported = true
+			}
+			if len(rsp.Choices) > 0 || asked {
+				onData(rsp)
+			}
+		})
+	})
+	if err == nil || reported {
+		t.track(ctx, record, request.User)
+	}
+	return err
+}
+
+// Edits creates an edit and tracks its usage.
+func (t *UsageTracker) Edits(ctx context.Context, request *EditsRequest) (*EditsResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.Edits(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{
+		Method:           "Edits",
+		Model:            request.Model,
+		PromptTokens:     rsp.Usage.PromptTokens,
+		CompletionTokens: rsp.Usage.CompletionTokens,
+	}, "")
+	return rsp, nil
+}
+
+// Search performs a search with the default engine and tracks the tokens of its embeddings.
+func (t *UsageTracker) Search(ctx context.Context, request *SearchRequest) (*SearchResponse, error) {
+	return t.search(ctx, "Search", func() (*SearchResponse, error) { return t.client.Search(ctx, request) })
+}
+
+// SearchWithEngine performs a search with the specified engine and tracks the tokens of its embeddings.
+func (t *UsageTracker) SearchWithEngine(ctx context.Context, engine string, request *SearchRequest) (*SearchResponse, error) {
+	return t.search(ctx, "SearchWithEngine", func() (*SearchResponse, error) {
+		return t.client.SearchWithEngine(ctx, engine, request)
+	})
+}
+
+func (t *UsageTracker) search(ctx context.Context, method string, fn func() (*SearchResponse, error)) (*SearchResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{Method: method, Model: rsp.Model, PromptTokens: rsp.Usage.PromptTokens}, "")
+	return rsp, nil
+}
+
+// Embeddings creates embeddings and tracks their usage.
+func (t *UsageTracker) Embeddings(ctx context.Context, request *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.Embeddings(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{Method: "Embeddings", Model: request.Model, PromptTokens: rsp.Usage.PromptTokens}, request.User)
+	return rsp, nil
+}
+
+// Image creates images and tracks their count. Images are priced by size.
+func (t *UsageTracker) Image(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.Image(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	size := request.Size
+	if size == "" {
+		size = CreateImageSize1024x1024
+	}
+	t.track(ctx, UsageRecord{Method: "Image", Model: imageModel, Images: len(rsp.Data), ImageSize: size}, request.User)
+	return rsp, nil
+}
+
+// Moderation classifies texts. Moderation is free, so the call is tracked without tokens.
+func (t *UsageTracker) Moderation(ctx context.Context, request *ModerationRequest) (*ModerationResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.Moderation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{Method: "Moderation", Model: responseModel(rsp.Model, request.Model)}, "")
+	return rsp, nil
+}
+
+// Transcription transcribes audio. Audio is priced by duration, which the Pricing doesn't cover, so the
+// call is tracked without tokens or cost.
+func (t *UsageTracker) Transcription(ctx context.Context, request *TranscriptionRequest) (*TranscriptionResponse, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	rsp, err := t.client.Transcription(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	t.track(ctx, UsageRecord{Method: "Transcription", Model: request.Model}, "")
+	return rsp, nil
+}
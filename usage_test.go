@@ -0,0 +1,192 @@
+package gpt_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go"
+	"github.com/hanyuancheung/gpt-go/gpttest"
+)
+
+func TestUsageTrackerStreams(t *testing.T) {
+	tests := []struct {
+		name   string
+		asked  bool
+		chunks int
+	}{
+		{"usage not asked", false, 6},
+		{"usage asked", true, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			var records []gpt.UsageRecord
+			tracker := gpt.NewUsageTracker(server.Client(),
+				gpt.WithUsageRecorder(func(r gpt.UsageRecord) { records = append(records, r) }))
+			request := &gpt.ChatCompletionRequest{
+				Model:    gpt.GPT4oMini,
+				Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+			}
+			if tt.asked {
+				request.StreamOptions = &gpt.StreamOptions{IncludeUsage: true}
+			}
+			chunks := 0
+			err := tracker.ChatCompletionStream(context.Background(), request, func(*gpt.ChatCompletionStreamResponse) { chunks++ })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunks != tt.chunks {
+				t.Errorf("onData called %d times, want %d", chunks, tt.chunks)
+			}
+			if tt.asked != (request.StreamOptions != nil) {
+				t.Errorf("request changed: StreamOptions = %v", request.StreamOptions)
+			}
+			sent, _ := server.LastRequest(gpttest.EndpointChatCompletions)
+			var body struct {
+				StreamOptions gpt.StreamOptions `json:"stream_options"`
+			}
+			if err := sent.Decode(&body); err != nil || !body.StreamOptions.IncludeUsage {
+				t.Errorf("stream sent without include_usage: %s", sent.Body)
+			}
+			if len(records) != 1 || records[0].PromptTokens == 0 || records[0].CompletionTokens == 0 || records[0].Cost == 0 {
+				t.Errorf("records = %+v, want the usage of the stream", records)
+			}
+		})
+	}
+}
+
+func TestUsageTrackerCompletionStream(t *testing.T) {
+	server := gpttest.New(t)
+	tracker := gpt.NewUsageTracker(server.Client())
+	err := tracker.CompletionStream(context.Background(), &gpt.CompletionRequest{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"hi"}},
+		func(rsp *gpt.CompletionResponse) {
+			if len(rsp.Choices) == 0 {
+				t.Error("usage chunk passed to onData without being asked for")
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := tracker.Total(); total.Calls != 1 || total.TotalTokens == 0 {
+		t.Errorf("Total = %+v, want the usage of the stream", total)
+	}
+}
+
+func TestUsageTrackerStreamsWithoutStreamOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		asked   bool
+		calls   int
+		fails   bool
+		records int
+	}{
+		{"retried without stream options", false, 2, false, 1},
+		{"usage asked", true, 1, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Handle(gpttest.EndpointChatCompletions, func(req gpttest.Request) gpttest.Response {
+				if strings.Contains(string(req.Body), "stream_options") {
+					return gpttest.ErrorResponse(http.StatusBadRequest, "invalid_request_error", "Unrecognized request argument supplied: stream_options")
+				}
+				return gpttest.Response{Chunks: gpttest.ChatChunks(gpt.GPT4oMini, "Hel", "lo")}
+			})
+			var records []gpt.UsageRecord
+			tracker := gpt.NewUsageTracker(server.Client(),
+				gpt.WithUsageRecorder(func(r gpt.UsageRecord) { records = append(records, r) }))
+			request := &gpt.ChatCompletionRequest{
+				Model:    gpt.GPT4oMini,
+				Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+			}
+			if tt.asked {
+				request.StreamOptions = &gpt.StreamOptions{IncludeUsage: true}
+			}
+			var text string
+			err := tracker.ChatCompletionStream(context.Background(), request, func(rsp *gpt.ChatCompletionStreamResponse) {
+				text += rsp.Choices[0].Delta.Content
+			})
+			if (err != nil) != tt.fails {
+				t.Fatalf("error %v, want failure %v", err, tt.fails)
+			}
+			if !tt.fails && text != "Hello" {
+				t.Errorf("streamed %q, want Hello", text)
+			}
+			server.AssertCalled(t, gpttest.EndpointChatCompletions, tt.calls)
+			if len(records) != tt.records || tt.records > 0 && records[0].PromptTokens != 0 {
+				t.Errorf("records = %+v, want %d without tokens", records, tt.records)
+			}
+		})
+	}
+}
+
+func TestUsageTrackerSkipsFailedStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		response gpttest.Response
+	}{
+		{"server error", gpttest.ErrorResponse(http.StatusInternalServerError, "server_error", "down")},
+		{"rate limited", gpttest.RateLimited(0)},
+		{"other bad request", gpttest.ErrorResponse(http.StatusBadRequest, "invalid_request_error", "bad model")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gpttest.New(t)
+			server.Enqueue(gpttest.EndpointChatCompletions, tt.response)
+			server.Enqueue(gpttest.EndpointCompletions, tt.response)
+			tracker := gpt.NewUsageTracker(server.Client())
+			ctx := context.Background()
+			chat := &gpt.ChatCompletionRequest{
+				Model:    gpt.GPT4oMini,
+				Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+			}
+			if err := tracker.ChatCompletionStream(ctx, chat, func(*gpt.ChatCompletionStreamResponse) {}); err == nil {
+				t.Error("chat stream succeeded")
+			}
+			completion := &gpt.CompletionRequest{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"hi"}}
+			if err := tracker.CompletionStream(ctx, completion, func(*gpt.CompletionResponse) {}); err == nil {
+				t.Error("completion stream succeeded")
+			}
+			if total := tracker.Total(); total.Calls != 0 {
+				t.Errorf("Total = %+v, want failed streams not tracked", total)
+			}
+			server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+		})
+	}
+}
+
+func TestUsageTrackerBudgetStopsStreams(t *testing.T) {
+	server := gpttest.New(t)
+	tracker := gpt.NewUsageTracker(server.Client(), gpt.WithBudget(1e-9))
+	request := &gpt.ChatCompletionRequest{
+		Model:    gpt.GPT4o,
+		Messages: []gpt.ChatCompletionRequestMessage{{Role: "user", Content: "hi"}},
+	}
+	onData := func(*gpt.ChatCompletionStreamResponse) {}
+	if err := tracker.ChatCompletionStream(context.Background(), request, onData); err != nil {
+		t.Fatal(err)
+	}
+	var exceeded *gpt.BudgetExceededError
+	if err := tracker.ChatCompletionStream(context.Background(), request, onData); !errors.As(err, &exceeded) {
+		t.Fatalf("second stream error = %v, want *BudgetExceededError", err)
+	}
+	server.AssertCalled(t, gpttest.EndpointChatCompletions, 1)
+}
+
+func TestUsageTrackerSearch(t *testing.T) {
+	server := gpttest.New(t)
+	var records []gpt.UsageRecord
+	tracker := gpt.NewUsageTracker(server.Client(gpt.WithSearchEmbeddingModel(gpt.TextEmbedding3Small)),
+		gpt.WithUsageRecorder(func(r gpt.UsageRecord) { records = append(records, r) }))
+	rsp, err := tracker.Search(context.Background(), &gpt.SearchRequest{Query: "cat", Documents: []string{"dog", "kitten"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Model != gpt.TextEmbedding3Small || records[0].PromptTokens != rsp.Usage.PromptTokens ||
+		rsp.Usage.PromptTokens == 0 || records[0].Cost == 0 {
+		t.Errorf("records = %+v for usage %+v, want the embedding tokens of the search", records, rsp.Usage)
+	}
+}
@@ -0,0 +1,63 @@
+package vectorstore
+
+// Filter selects the items a search may return by their metadata.
+type Filter func(metadata map[string]string) bool
+
+// Equals returns a Filter matching items whose metadata has key set to value.
+func Equals(key, value string) Filter {
+	return func(metadata map[string]string) bool {
+		v, ok := metadata[key]
+		return ok && v == value
+	}
+}
+
+// In returns a Filter matching items whose metadata has key set to one of values.
+func In(key string, values ...string) Filter {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return func(metadata map[string]string) bool {
+		v, ok := metadata[key]
+		return ok && set[v]
+	}
+}
+
+// Has returns a Filter matching items whose metadata has key.
+func Has(key string) Filter {
+	return func(metadata map[string]string) bool {
+		_, ok := metadata[key]
+		return ok
+	}
+}
+
+// Not returns a Filter matching the items f doesn't match.
+func Not(f Filter) Filter {
+	return func(metadata map[string]string) bool {
+		return !f(metadata)
+	}
+}
+
+// And returns a Filter matching the items every filter matches.
+func And(filters ...Filter) Filter {
+	return func(metadata map[string]string) bool {
+		for _, f := range filters {
+			if !f(metadata) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Filter matching the items any filter matches.
+func Or(filters ...Filter) Filter {
+	return func(metadata map[string]string) bool {
+		for _, f := range filters {
+			if f(metadata) {
+				return true
+			}
+		}
+		return false
+	}
+}
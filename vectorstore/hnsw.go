@@ -0,0 +1,260 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"sync"
+)
+
+// HNSWParams tunes the HNSW graph of a Store. Larger values give better recall at the cost of memory
+// and insert or search time.
+type HNSWParams struct {
+	// M is the number of links per node on the upper layers, twice as many on the bottom layer.
+	// Defaults to 16.
+	M int
+	// EfConstruction is the number of candidates considered when linking a new node. Defaults to 200.
+	EfConstruction int
+	// EfSearch is the number of candidates considered by a search, at least k. Defaults to 64.
+	EfSearch int
+}
+
+func (p HNSWParams) withDefaults() HNSWParams {
+	if p.M <= 1 {
+		p.M = 16
+	}
+	if p.EfConstruction <= 0 {
+		p.EfConstruction = 200
+	}
+	if p.EfSearch <= 0 {
+		p.EfSearch = 64
+	}
+	return p
+}
+
+// graph is the entry point of the HNSW layers; the links are kept on the nodes.
+type graph struct {
+	entry    int
+	maxLevel int
+}
+
+// maxLinks returns the maximum number of links of a node on a layer.
+func (s *Store) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * s.hnsw.M
+	}
+	return s.hnsw.M
+}
+
+// insert links node i into the graph.
+func (s *Store) insert(i int) {
+	n := s.nodes[i]
+	n.level = int(math.Floor(-math.Log(1-s.rand.Float64()) / math.Log(float64(s.hnsw.M))))
+	n.neighbors = make([][]int32, n.level+1)
+	if s.graph.entry < 0 {
+		s.graph.entry, s.graph.maxLevel = i, n.level
+		return
+	}
+
+	query := n.Vector
+	entry := candidate{index: int32(s.graph.entry), similarity: s.similarity(query, s.nodes[s.graph.entry].Vector)}
+	for level := s.graph.maxLevel; level > n.level; level-- {
+		entry = s.greedy(query, entry, level)
+	}
+	entries := []candidate{entry}
+	for level := min(n.level, s.graph.maxLevel); level >= 0; level-- {
+		found := s.searchLayer(query, entries, s.hnsw.EfConstruction, level, nil)
+		n.neighbors[level] = s.selectNeighbors(found, s.hnsw.M)
+		for _, j := range n.neighbors[level] {
+			s.link(int(j), int32(i), level)
+		}
+		entries = found
+	}
+	if n.level > s.graph.maxLevel {
+		s.graph.entry, s.graph.maxLevel = i, n.level
+	}
+}
+
+// compactIfSparse rebuilds the graph once deleted nodes outnumber the live ones. Tombstones keep the
+// graph connected, but every search still walks them, and they are kept in memory and saved files.
+func (s *Store) compactIfSparse() {
+	if s.hnsw == nil || len(s.nodes)-s.live <= s.live {
+		return
+	}
+	live := make([]*node, 0, s.live)
+	for _, n := range s.nodes {
+		if !n.deleted {
+			live = append(live, n)
+		}
+	}
+	s.nodes, s.graph = live, graph{entry: -1}
+	for i, n := range s.nodes {
+		s.ids[n.ID] = i
+	}
+	for i := range s.nodes {
+		s.insert(i)
+	}
+}
+
+// link adds a link from node j to node i on a layer, pruning j's links if it has too many.
+func (s *Store) link(j int, i int32, level int) {
+	n := s.nodes[j]
+	n.neighbors[level] = append(n.neighbors[level], i)
+	if len(n.neighbors[level]) <= s.maxLinks(level) {
+		return
+	}
+	links := make([]candidate, len(n.neighbors[level]))
+	for k, l := range n.neighbors[level] {
+		links[k] = candidate{index: l, similarity: s.similarity(n.Vector, s.nodes[l].Vector)}
+	}
+	sort.Slice(links, func(a, b int) bool { return links[a].similarity > links[b].similarity })
+	n.neighbors[level] = s.selectNeighbors(links, s.maxLinks(level))
+}
+
+// selectNeighbors picks up to m of the candidates, sorted most similar first, preferring candidates
+// that are more similar to the query than to the ones already picked, so links spread in all
+// directions. Remaining slots are filled with the most similar of the others.
+func (s *Store) selectNeighbors(candidates []candidate, m int) []int32 {
+	picked := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range candidates {
+		if len(picked) == m {
+			break
+		}
+		diverse := true
+		for _, p := range picked {
+			if s.similarity(s.nodes[c.index].Vector, s.nodes[p].Vector) > c.similarity {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			picked = append(picked, c.index)
+		} else {
+			skipped = append(skipped, c.index)
+		}
+	}
+	for _, j := range skipped {
+		if len(picked) == m {
+			break
+		}
+		picked = append(picked, j)
+	}
+	return picked
+}
+
+// greedy walks a layer towards the query, returning the most similar node it reaches.
+func (s *Store) greedy(query []float32, entry candidate, level int) candidate {
+	for changed := true; changed; {
+		changed = false
+		for _, j := range s.nodes[entry.index].neighbors[level] {
+			if sim := s.similarity(query, s.nodes[j].Vector); sim > entry.similarity {
+				entry, changed = candidate{index: j, similarity: sim}, true
+			}
+		}
+	}
+	return entry
+}
+
+// visitedSet marks the nodes a search has seen. Sets are pooled and cleared by bumping the epoch, so a
+// search doesn't allocate a map.
+type visitedSet struct {
+	marks []uint32
+	epoch uint32
+}
+
+var visitedPool = sync.Pool{New: func() interface{} { return &visitedSet{} }}
+
+func getVisited(n int) *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < n {
+		v.marks = make([]uint32, n+n/4)
+		v.epoch = 0
+	}
+	v.epoch++
+	if v.epoch == 0 {
+		for i := range v.marks {
+			v.marks[i] = 0
+		}
+		v.epoch = 1
+	}
+	return v
+}
+
+// visit marks node i and reports whether it was not seen before.
+func (v *visitedSet) visit(i int32) bool {
+	if v.marks[i] == v.epoch {
+		return false
+	}
+	v.marks[i] = v.epoch
+	return true
+}
+
+// searchLayer returns the ef nodes of a layer most similar to the query that accept allows, most similar
+// first. Rejected nodes are still traversed, so a selective filter widens the search instead of cutting
+// it short. A nil accept allows every node, including deleted ones.
+func (s *Store) searchLayer(query []float32, entries []candidate, ef int, level int, accept func(int) bool) []candidate {
+	visited := getVisited(len(s.nodes))
+	defer visitedPool.Put(visited)
+	queue := &maxHeap{}
+	found := &minHeap{}
+	add := func(c candidate) {
+		if accept != nil && !accept(int(c.index)) {
+			return
+		}
+		heap.Push(found, c)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+	for _, e := range entries {
+		if visited.visit(e.index) {
+			heap.Push(queue, e)
+			add(e)
+		}
+	}
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(candidate)
+		if found.Len() >= ef && c.similarity < (*found)[0].similarity {
+			break
+		}
+		for _, j := range s.nodes[c.index].neighbors[level] {
+			if !visited.visit(j) {
+				continue
+			}
+			next := candidate{index: j, similarity: s.similarity(query, s.nodes[j].Vector)}
+			if found.Len() < ef || next.similarity > (*found)[0].similarity {
+				heap.Push(queue, next)
+				add(next)
+			}
+		}
+	}
+	return found.sorted()
+}
+
+// searchGraph returns the k accepted nodes most similar to the query.
+func (s *Store) searchGraph(query []float32, k int, accept func(int) bool) []candidate {
+	entry := candidate{index: int32(s.graph.entry), similarity: s.similarity(query, s.nodes[s.graph.entry].Vector)}
+	for level := s.graph.maxLevel; level > 0; level-- {
+		entry = s.greedy(query, entry, level)
+	}
+	found := s.searchLayer(query, []candidate{entry}, max(s.hnsw.EfSearch, k), 0, accept)
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
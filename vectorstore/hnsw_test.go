@@ -0,0 +1,153 @@
+package vectorstore_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/vectorstore"
+)
+
+func randomVectors(r *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(r.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const n, dim, k, queries = 2000, 16, 10, 50
+	r := rand.New(rand.NewSource(7))
+	vectors := randomVectors(r, n, dim)
+	for _, metric := range []vectorstore.Metric{vectorstore.Cosine, vectorstore.DotProduct, vectorstore.Euclidean} {
+		t.Run(metric.String(), func(t *testing.T) {
+			exact := vectorstore.New(vectorstore.WithMetric(metric))
+			approximate := vectorstore.New(vectorstore.WithMetric(metric), vectorstore.WithHNSW(vectorstore.HNSWParams{}))
+			for i, v := range vectors {
+				for _, store := range []*vectorstore.Store{exact, approximate} {
+					if err := store.Add(fmt.Sprint(i), v, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			found := 0
+			for _, query := range randomVectors(r, queries, dim) {
+				want, err := exact.Search(query, k, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := approximate.Search(query, k, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := make(map[string]bool, len(got))
+				for _, result := range got {
+					ids[result.ID] = true
+				}
+				for _, result := range want {
+					if ids[result.ID] {
+						found++
+					}
+				}
+			}
+			if recall := float64(found) / (k * queries); recall < 0.95 {
+				t.Errorf("recall %.3f, want at least 0.95", recall)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	vectors := map[string][]float32{"a": {1, 0}, "b": {2, 2}, "c": {0, 3}}
+	query := []float32{1, 0.1}
+	tests := []struct {
+		metric vectorstore.Metric
+		order  []string
+		best   float64
+	}{
+		{vectorstore.Cosine, []string{"a", "b", "c"}, 0.995037},
+		{vectorstore.DotProduct, []string{"b", "a", "c"}, 2.2},
+		{vectorstore.Euclidean, []string{"a", "b", "c"}, -0.1},
+	}
+	for _, tt := range tests {
+		for _, index := range []string{"exact", "hnsw"} {
+			t.Run(tt.metric.String()+" "+index, func(t *testing.T) {
+				options := []vectorstore.Option{vectorstore.WithMetric(tt.metric)}
+				if index == "hnsw" {
+					options = append(options, vectorstore.WithHNSW(vectorstore.HNSWParams{}))
+				}
+				store := vectorstore.New(options...)
+				for id, v := range vectors {
+					if err := store.Add(id, v, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+				results, err := store.Search(query, 3, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var order []string
+				for _, r := range results {
+					order = append(order, r.ID)
+				}
+				if fmt.Sprint(order) != fmt.Sprint(tt.order) {
+					t.Errorf("order %v, want %v", order, tt.order)
+				}
+				if len(results) > 0 && (results[0].Score < tt.best-1e-5 || results[0].Score > tt.best+1e-5) {
+					t.Errorf("best score %v, want %v", results[0].Score, tt.best)
+				}
+			})
+		}
+	}
+}
+
+func fileSize(t *testing.T, store *vectorstore.Store) int64 {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "store.bin")
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestHNSWCompactsDeletedNodes(t *testing.T) {
+	const n, dim = 400, 8
+	store := vectorstore.New(vectorstore.WithHNSW(vectorstore.HNSWParams{}))
+	for i, v := range randomVectors(rand.New(rand.NewSource(3)), n, dim) {
+		if err := store.Add(fmt.Sprint(i), v, map[string]string{"keep": fmt.Sprint(i%4 == 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := fileSize(t, store)
+	if deleted := store.DeleteMatching(vectorstore.Equals("keep", "false")); deleted != 3*n/4 {
+		t.Fatalf("deleted %d items, want %d", deleted, 3*n/4)
+	}
+	if size := fileSize(t, store); size > full/2 {
+		t.Errorf("store of a quarter of the items takes %d bytes, %d with all of them: tombstones kept", size, full)
+	}
+	results, err := store.Search(make([]float32, dim), n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != n/4 {
+		t.Errorf("search found %d items, want the %d left", len(results), n/4)
+	}
+	for _, r := range results {
+		if r.Metadata["keep"] != "true" {
+			t.Errorf("search found deleted item %s", r.ID)
+		}
+		if item, ok := store.Get(r.ID); !ok || item.ID != r.ID {
+			t.Errorf("Get(%s) = %+v, %v after compaction", r.ID, item, ok)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package vectorstore
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// fileVersion is the version of the file format written by Save.
+const fileVersion = 1
+
+// snapshot is the file format of a Store. The HNSW links are saved with the nodes, so a loaded store
+// doesn't rebuild its graph.
+type snapshot struct {
+	Version  int
+	Metric   Metric
+	HNSW     *HNSWParams
+	Dim      int
+	Entry    int
+	MaxLevel int
+	Nodes    []snapshotNode
+}
+
+type snapshotNode struct {
+	ID        string
+	Vector    []float32
+	Metadata  map[string]string
+	Deleted   bool
+	Level     int
+	Neighbors [][]int32
+}
+
+// Save writes the store to a single file at path. The file is written to a temporary file first, so an
+// interrupted save leaves the previous file intact.
+func (s *Store) Save(path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := snapshot{
+		Version:  fileVersion,
+		Metric:   s.metric,
+		HNSW:     s.hnsw,
+		Dim:      s.dim,
+		Entry:    s.graph.entry,
+		MaxLevel: s.graph.maxLevel,
+		Nodes:    make([]snapshotNode, len(s.nodes)),
+	}
+	for i, n := range s.nodes {
+		snap.Nodes[i] = snapshotNode{
+			ID:        n.ID,
+			Vector:    n.Vector,
+			Metadata:  n.Metadata,
+			Deleted:   n.deleted,
+			Level:     n.level,
+			Neighbors: n.neighbors,
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(&snap); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+	return nil
+}
+
+// Load reads a store written by Save. The metric and index of the file are kept.
+func Load(path string) (*Store, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vector store: %w", err)
+	}
+	defer file.Close()
+	var snap snapshot
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to load vector store: %w", err)
+	}
+	if snap.Version != fileVersion {
+		return nil, fmt.Errorf("failed to load vector store: unsupported version %d", snap.Version)
+	}
+	s := &Store{
+		metric: snap.Metric,
+		hnsw:   snap.HNSW,
+		dim:    snap.Dim,
+		nodes:  make([]*node, len(snap.Nodes)),
+		ids:    make(map[string]int, len(snap.Nodes)),
+		graph:  graph{entry: snap.Entry, maxLevel: snap.MaxLevel},
+		rand:   rand.New(rand.NewSource(1)),
+	}
+	for i, sn := range snap.Nodes {
+		s.nodes[i] = &node{
+			Item:      Item{ID: sn.ID, Vector: sn.Vector, Metadata: sn.Metadata},
+			deleted:   sn.Deleted,
+			level:     sn.Level,
+			neighbors: sn.Neighbors,
+		}
+		if !sn.Deleted {
+			s.ids[sn.ID] = i
+			s.live++
+		}
+	}
+	if s.hnsw != nil {
+		for _, n := range s.nodes {
+			if n.neighbors == nil {
+				n.neighbors = make([][]int32, n.level+1)
+			}
+		}
+	}
+	return s, nil
+}
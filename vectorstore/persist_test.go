@@ -0,0 +1,77 @@
+package vectorstore_test
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/vectorstore"
+)
+
+func TestSaveLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []vectorstore.Option
+	}{
+		{"exact", nil},
+		{"hnsw", []vectorstore.Option{vectorstore.WithHNSW(vectorstore.HNSWParams{M: 8})}},
+		{"hnsw euclidean", []vectorstore.Option{vectorstore.WithMetric(vectorstore.Euclidean), vectorstore.WithHNSW(vectorstore.HNSWParams{})}},
+	}
+	r := rand.New(rand.NewSource(5))
+	vectors := randomVectors(r, 300, 8)
+	queries := randomVectors(r, 10, 8)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := vectorstore.New(tt.options...)
+			for i, v := range vectors {
+				if err := store.Add(fmt.Sprint(i), v, map[string]string{"even": fmt.Sprint(i%2 == 0)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 30; i++ {
+				store.Delete(fmt.Sprint(i))
+			}
+			path := filepath.Join(t.TempDir(), "store.bin")
+			if err := store.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := vectorstore.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Metric() != store.Metric() || loaded.Len() != store.Len() {
+				t.Errorf("loaded %v store of %d items, want %v of %d", loaded.Metric(), loaded.Len(), store.Metric(), store.Len())
+			}
+			if _, ok := loaded.Get("0"); ok {
+				t.Error("deleted item loaded")
+			}
+			if item, ok := loaded.Get("31"); !ok || item.Metadata["even"] != "false" {
+				t.Errorf("Get(31) = %+v, %v", item, ok)
+			}
+			for _, query := range queries {
+				for _, filter := range []vectorstore.Filter{nil, vectorstore.Equals("even", "true")} {
+					want, err := store.Search(query, 5, filter)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := loaded.Search(query, 5, filter)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("loaded store found %v, want %v", got, want)
+					}
+				}
+			}
+			// the loaded graph takes new items
+			if err := loaded.Add("new", queries[0], nil); err != nil {
+				t.Fatal(err)
+			}
+			if results, err := loaded.Search(queries[0], 1, nil); err != nil || len(results) != 1 || results[0].ID != "new" {
+				t.Errorf("Search after Add = %v, %v, want the new item", results, err)
+			}
+		})
+	}
+}
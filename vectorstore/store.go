@@ -0,0 +1,413 @@
+// Package vectorstore keeps embedding vectors with IDs and metadata in memory and finds the ones most
+// similar to a query, exactly or approximately with an HNSW graph. A store can be saved to and loaded
+// from a single file, so semantic search works locally once the documents are embedded.
+package vectorstore
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/hanyuancheung/gpt-go"
+)
+
+// Metric is the similarity measure of a Store.
+type Metric int
+
+// Define similarity metrics
+const (
+	Cosine     Metric = iota // Cosine compares the angle between vectors, ignoring their length
+	DotProduct               // DotProduct is the inner product, equal to Cosine for unit vectors
+	Euclidean                // Euclidean is the straight-line distance; Result.Score is its negation
+)
+
+// String returns the name of the metric
+func (m Metric) String() string {
+	switch m {
+	case Cosine:
+		return "cosine"
+	case DotProduct:
+		return "dot"
+	case Euclidean:
+		return "euclidean"
+	}
+	return fmt.Sprintf("Metric(%d)", int(m))
+}
+
+var (
+	// ErrEmptyID is returned when an item is added without an ID.
+	ErrEmptyID = errors.New("vectorstore: empty id")
+	// ErrDimensionMismatch is returned when a vector's length differs from the vectors already stored.
+	ErrDimensionMismatch = errors.New("vectorstore: dimension mismatch")
+)
+
+// Item is a vector stored under an ID.
+type Item struct {
+	ID     string
+	Vector []float32
+	// Metadata is matched by search filters
+	Metadata map[string]string
+}
+
+// Result is an item found by Search.
+type Result struct {
+	Item
+	// Score is the similarity to the query; higher is more similar. For Euclidean it is the negated distance.
+	Score float64
+}
+
+// Option are options that can be passed when creating a new store
+type Option func(*Store) *Store
+
+// WithMetric is a store option that sets the similarity metric. The default is Cosine.
+func WithMetric(metric Metric) Option {
+	return func(s *Store) *Store {
+		s.metric = metric
+		return s
+	}
+}
+
+// WithHNSW is a store option that indexes the vectors in an HNSW graph for approximate search, which is
+// much faster than the default exact search for large stores at the cost of occasionally missing a
+// match. Zero parameters take their defaults.
+func WithHNSW(params HNSWParams) Option {
+	return func(s *Store) *Store {
+		params = params.withDefaults()
+		s.hnsw = &params
+		return s
+	}
+}
+
+// Store is an in-memory vector store. It is safe for concurrent use.
+type Store struct {
+	metric Metric
+	hnsw   *HNSWParams
+
+	mu    sync.RWMutex
+	dim   int
+	nodes []*node
+	ids   map[string]int
+	live  int
+	graph graph
+	rand  *rand.Rand
+}
+
+// node is a stored item. Deleted nodes stay in place as tombstones so the HNSW graph stays connected,
+// until they outnumber the live ones and the graph is rebuilt without them.
+type node struct {
+	Item
+	deleted bool
+	// level and neighbors are the node's HNSW layers, neighbors[l] being its links on layer l
+	level     int
+	neighbors [][]int32
+}
+
+// New returns an empty store.
+func New(options ...Option) *Store {
+	s := &Store{
+		ids:  make(map[string]int),
+		rand: rand.New(rand.NewSource(1)),
+	}
+	for _, opt := range options {
+		s = opt(s)
+	}
+	s.graph.entry = -1
+	return s
+}
+
+// Metric returns the similarity metric of the store.
+func (s *Store) Metric() Metric {
+	return s.metric
+}
+
+// Len returns the number of items in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.live
+}
+
+// Add stores a vector under id, replacing the item stored under id before. With Cosine the stored
+// vector is normalized to unit length.
+func (s *Store) Add(id string, vector []float32, metadata map[string]string) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dim == 0 {
+		s.dim = len(vector)
+	}
+	if len(vector) != s.dim || len(vector) == 0 {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(vector), s.dim)
+	}
+	if s.metric == Cosine {
+		vector = normalize(vector)
+	} else {
+		vector = append([]float32(nil), vector...)
+	}
+	s.remove(id)
+	s.compactIfSparse()
+	n := &node{Item: Item{ID: id, Vector: vector, Metadata: metadata}}
+	s.nodes = append(s.nodes, n)
+	s.ids[id] = len(s.nodes) - 1
+	s.live++
+	if s.hnsw != nil {
+		s.insert(len(s.nodes) - 1)
+	}
+	return nil
+}
+
+// AddEmbeddings stores the vectors of an embeddings response under the given IDs, matched by
+// EmbeddingsResult.Index. metadata may be nil, or hold the metadata of every ID.
+func (s *Store) AddEmbeddings(ids []string, results []gpt.EmbeddingsResult, metadata []map[string]string) error {
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(ids) {
+			return fmt.Errorf("vectorstore: embedding index %d out of range for %d ids", result.Index, len(ids))
+		}
+		var md map[string]string
+		if result.Index < len(metadata) {
+			md = metadata[result.Index]
+		}
+		if err := s.Add(ids[result.Index], result.Float32(), md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the item stored under id.
+func (s *Store) Get(id string) (Item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.ids[id]
+	if !ok {
+		return Item{}, false
+	}
+	return s.nodes[i].Item, true
+}
+
+// Delete removes the item stored under id and reports whether there was one.
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := s.remove(id)
+	s.compactIfSparse()
+	return removed
+}
+
+// DeleteMatching removes the items whose metadata matches filter and returns how many there were.
+func (s *Store) DeleteMatching(filter Filter) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, n := range s.nodes {
+		if !n.deleted && filter(n.Metadata) {
+			ids = append(ids, n.ID)
+		}
+	}
+	for _, id := range ids {
+		s.remove(id)
+	}
+	s.compactIfSparse()
+	return len(ids)
+}
+
+func (s *Store) remove(id string) bool {
+	i, ok := s.ids[id]
+	if !ok {
+		return false
+	}
+	delete(s.ids, id)
+	s.live--
+	if s.hnsw == nil {
+		// without a graph there is nothing to keep connected, so the slot is reused
+		last := len(s.nodes) - 1
+		s.nodes[i] = s.nodes[last]
+		s.nodes = s.nodes[:last]
+		if i < last {
+			s.ids[s.nodes[i].ID] = i
+		}
+		return true
+	}
+	s.nodes[i].deleted = true
+	s.nodes[i].Metadata = nil
+	return true
+}
+
+// Search returns the k items most similar to query that match filter, most similar first. A nil filter
+// matches every item.
+func (s *Store) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k <= 0 || s.live == 0 {
+		return nil, nil
+	}
+	if len(query) != s.dim {
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(query), s.dim)
+	}
+	if s.metric == Cosine {
+		query = normalize(query)
+	}
+	accept := func(i int) bool {
+		n := s.nodes[i]
+		return !n.deleted && (filter == nil || filter(n.Metadata))
+	}
+	var found []candidate
+	if s.hnsw != nil && !s.selective(filter) {
+		found = s.searchGraph(query, k, accept)
+	} else {
+		found = s.searchExact(query, k, accept)
+	}
+	results := make([]Result, len(found))
+	for i, c := range found {
+		results[i] = Result{Item: s.nodes[c.index].Item, Score: s.score(c.similarity)}
+	}
+	return results, nil
+}
+
+// selective reports whether filter matches so few items that comparing them all is cheaper than
+// walking the graph past the ones it rejects.
+func (s *Store) selective(filter Filter) bool {
+	if filter == nil {
+		return false
+	}
+	matches := 0
+	for _, n := range s.nodes {
+		if !n.deleted && filter(n.Metadata) {
+			matches++
+		}
+	}
+	return matches*4 <= s.live
+}
+
+// searchExact compares the query with every accepted item.
+func (s *Store) searchExact(query []float32, k int, accept func(int) bool) []candidate {
+	worst := &minHeap{}
+	for i := range s.nodes {
+		if !accept(i) {
+			continue
+		}
+		c := candidate{index: int32(i), similarity: s.similarity(query, s.nodes[i].Vector)}
+		if worst.Len() < k {
+			heap.Push(worst, c)
+		} else if c.similarity > (*worst)[0].similarity {
+			(*worst)[0] = c
+			heap.Fix(worst, 0)
+		}
+	}
+	return worst.sorted()
+}
+
+// similarity returns how similar two vectors are; higher is more similar. For Euclidean it is the
+// negated squared distance, which orders like the distance but is cheaper.
+func (s *Store) similarity(a, b []float32) float64 {
+	if s.metric == Euclidean {
+		return -float64(squaredDistance(a, b))
+	}
+	return float64(dot(a, b))
+}
+
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+func squaredDistance(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		d0, d1, d2, d3 := a[i]-b[i], a[i+1]-b[i+1], a[i+2]-b[i+2], a[i+3]-b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// score converts a similarity into a Result.Score.
+func (s *Store) score(similarity float64) float64 {
+	if s.metric == Euclidean {
+		return -math.Sqrt(-similarity)
+	}
+	return similarity
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// candidate is a node index with its similarity to a query.
+type candidate struct {
+	index      int32
+	similarity float64
+}
+
+// minHeap keeps the least similar candidate on top.
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].similarity < h[j].similarity }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sorted empties the heap and returns its candidates, most similar first.
+func (h *minHeap) sorted() []candidate {
+	out := make([]candidate, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(candidate)
+	}
+	return out
+}
+
+// maxHeap keeps the most similar candidate on top.
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].similarity > h[j].similarity }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
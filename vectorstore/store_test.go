@@ -0,0 +1,46 @@
+package vectorstore_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hanyuancheung/gpt-go/vectorstore"
+)
+
+func TestDeleteMatching(t *testing.T) {
+	stores := map[string]*vectorstore.Store{
+		"exact": vectorstore.New(),
+		"hnsw":  vectorstore.New(vectorstore.WithHNSW(vectorstore.HNSWParams{})),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				md := map[string]string{"doc": fmt.Sprint(i % 3)}
+				if err := store.Add(fmt.Sprintf("item%d", i), []float32{float32(i), 1, float32(i % 3)}, md); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := store.DeleteMatching(vectorstore.Equals("doc", "1")); n != 7 {
+				t.Errorf("DeleteMatching = %d, want 7", n)
+			}
+			if n := store.DeleteMatching(vectorstore.Equals("doc", "1")); n != 0 {
+				t.Errorf("DeleteMatching again = %d, want 0", n)
+			}
+			if store.Len() != 13 {
+				t.Errorf("Len = %d, want 13", store.Len())
+			}
+			results, err := store.Search([]float32{1, 1, 1}, 20, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 13 {
+				t.Errorf("Search found %d items, want 13", len(results))
+			}
+			for _, r := range results {
+				if r.Metadata["doc"] == "1" {
+					t.Errorf("Search found deleted item %s", r.ID)
+				}
+			}
+		})
+	}
+}